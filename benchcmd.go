@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gochess/engine"
+	"os"
+)
+
+func benchMain(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	depth := fs.Int("depth", engine.DefaultBenchDepth, "depth to search each position to")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gochess bench [options]")
+		fmt.Fprintln(os.Stderr, "searches a fixed set of positions, the node count is the same on every run of the same build")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *depth < 1 || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	engine.Bench(os.Stdout, *depth)
+}
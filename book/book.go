@@ -0,0 +1,164 @@
+package book
+
+import (
+	"encoding/binary"
+	"fmt"
+	"gochess/core"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+)
+
+// Entry is one record of a Polyglot book: a move seen in the position with
+// the given key, and how much the book likes it.
+type Entry struct {
+	Key    uint64
+	Move   uint16
+	Weight uint16
+	Learn  uint32
+}
+
+const entrySize = 16
+
+// Book is a Polyglot opening book held in memory, entries sorted by key.
+type Book struct {
+	entries []Entry
+
+	// Best always picks the highest weighted move instead of choosing
+	// between them at random in proportion to their weights.
+	Best bool
+
+	rng *rand.Rand
+}
+
+// Open reads the Polyglot .bin book at path.
+func Open(path string) (*Book, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%entrySize != 0 {
+		return nil, fmt.Errorf("%s: not a polyglot book, size %d isn't a multiple of %d", path, len(data), entrySize)
+	}
+
+	entries := make([]Entry, len(data)/entrySize)
+	for i := range entries {
+		rec := data[i*entrySize:]
+		entries[i] = Entry{
+			Key:    binary.BigEndian.Uint64(rec[0:8]),
+			Move:   binary.BigEndian.Uint16(rec[8:10]),
+			Weight: binary.BigEndian.Uint16(rec[10:12]),
+			Learn:  binary.BigEndian.Uint32(rec[12:16]),
+		}
+	}
+
+	// books are meant to be sorted already, but don't count on it
+	return newBook(entries), nil
+}
+
+func newBook(entries []Entry) *Book {
+	sortEntries(entries)
+	return &Book{
+		entries: entries,
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Len returns the number of entries in the book.
+func (bk *Book) Len() int {
+	return len(bk.entries)
+}
+
+// Entries returns the book's entries for the position on b, along with the
+// moves they decode to. Entries whose move isn't legal here are dropped.
+func (bk *Book) Entries(b *core.Board) ([]Entry, []core.Move) {
+	key := Key(b)
+	i := sort.Search(len(bk.entries), func(i int) bool { return bk.entries[i].Key >= key })
+
+	var entries []Entry
+	var moves []core.Move
+	for ; i < len(bk.entries) && bk.entries[i].Key == key; i++ {
+		if move, ok := DecodeMove(b, bk.entries[i].Move); ok {
+			entries = append(entries, bk.entries[i])
+			moves = append(moves, move)
+		}
+	}
+	return entries, moves
+}
+
+// Probe picks a book move for the position on b, false when it's out of book.
+func (bk *Book) Probe(b *core.Board) (core.Move, bool) {
+	entries, moves := bk.Entries(b)
+	if len(moves) == 0 {
+		return core.Move{}, false
+	}
+
+	best, total := 0, 0
+	for i, entry := range entries {
+		if entry.Weight > entries[best].Weight {
+			best = i
+		}
+		total += int(entry.Weight)
+	}
+	if bk.Best || total == 0 {
+		return moves[best], true
+	}
+
+	pick := bk.rng.Intn(total)
+	for i, entry := range entries {
+		pick -= int(entry.Weight)
+		if pick < 0 {
+			return moves[i], true
+		}
+	}
+	return moves[best], true
+}
+
+// DecodeMove turns a Polyglot move into the legal move it stands for on b.
+// The bits are, from the lowest: to file, to row, from file, from row (3
+// each) and the promotion piece, 1 knight to 4 queen. Castling is written
+// as the king taking its own rook.
+func DecodeMove(b *core.Board, pm uint16) (core.Move, bool) {
+	to := core.Position(pm & 0x3f)
+	from := core.Position(pm >> 6 & 0x3f)
+	promotion := pm >> 12 & 7
+
+	if piece := b.Pieces[from]; piece.Type() == core.PieceTypeKing && b.Pieces[to] == piece&core.PieceColorMask|core.PieceTypeRook {
+		switch {
+		case from == 4 && to == 7, from == 60 && to == 63:
+			to = from + 2
+		case from == 4 && to == 0, from == 60 && to == 56:
+			to = from - 2
+		}
+	}
+
+	move := core.Move{From: from, To: to, Promotion: core.PieceNone}
+	if promotion != 0 {
+		move.Promotion = core.Piece(b.Pieces[from].Color() | uint8(promotion+1))
+	}
+
+	if !b.IsMoveLegal(move) {
+		return core.Move{}, false
+	}
+	return move, true
+}
+
+// EncodeMove is the reverse of DecodeMove, for writing books.
+func EncodeMove(b *core.Board, move core.Move) uint16 {
+	from, to := move.From, move.To
+	if b.Pieces[from].Type() == core.PieceTypeKing && (from == 4 || from == 60) {
+		switch int(to) - int(from) {
+		case 2:
+			to = from + 3
+		case -2:
+			to = from - 4
+		}
+	}
+
+	pm := uint16(to) | uint16(from)<<6
+	if move.Promotion != core.PieceNone {
+		pm |= uint16(move.Promotion.Type()-1) << 12
+	}
+	return pm
+}
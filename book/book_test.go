@@ -0,0 +1,174 @@
+package book
+
+import (
+	"gochess/core"
+	"gochess/fen"
+	"testing"
+)
+
+func load(t *testing.T, s string) *core.Board {
+	t.Helper()
+	b, err := fen.LoadFromFEN(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// find returns the legal move on b written as from and to squares.
+func find(t *testing.T, b *core.Board, s string) core.Move {
+	t.Helper()
+	for _, m := range b.GenerateLegalMoves() {
+		if b.ToAlgebraNotation(m) == s {
+			return m
+		}
+	}
+	t.Fatalf("%s: no move %s", fen.BoardToFEN(b), s)
+	return core.Move{}
+}
+
+// The keys from the Polyglot book format description.
+func TestKey(t *testing.T) {
+	for _, tt := range []struct {
+		fen string
+		key uint64
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 0x463b96181691fc9c},
+		// e3 isn't in the key, no black pawn can take there
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", 0x823c9b50fd114196},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2", 0x0756b94461c50fb0},
+		{"rnbqkbnr/ppp1pppp/8/3pP3/8/8/PPPP1PPP/RNBQKBNR b KQkq - 0 2", 0x662fafb965db29d4},
+		// but f6 is, exf6 is legal
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", 0x22a48b5a8e47ff78},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPPKPPP/RNBQ1BNR b kq - 0 3", 0x652a607ca3f242c1},
+		{"rnbq1bnr/ppp1pkpp/8/3pPp2/8/8/PPPPKPPP/RNBQ1BNR w - - 0 4", 0x00fdd303c946bdd9},
+		// and so is c3, for black
+		{"rnbqkbnr/p1pppppp/8/8/PpP4P/8/1P1PPPP1/RNBQKBNR b KQkq c3 0 3", 0x3c8123ea7b067637},
+		{"rnbqkbnr/p1pppppp/8/8/P6P/R1p5/1P1PPPP1/1NBQKBNR b Kkq - 0 4", 0x5c3f9b829b279560},
+	} {
+		if key := Key(load(t, tt.fen)); key != tt.key {
+			t.Errorf("%s: key %016x, want %016x", tt.fen, key, tt.key)
+		}
+	}
+}
+
+func TestCastlingMoves(t *testing.T) {
+	for _, tt := range []struct {
+		fen, move string
+		pm        uint16
+	}{
+		// the king takes its own rook
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", 4<<6 | 7},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1c1", 4<<6 | 0},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8g8", 60<<6 | 63},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8", 60<<6 | 56},
+		// a plain king move next to the rook is left alone
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1f1", 4<<6 | 5},
+	} {
+		b := load(t, tt.fen)
+		move := find(t, b, tt.move)
+		if pm := EncodeMove(b, move); pm != tt.pm {
+			t.Errorf("%s %s: encoded %#04x, want %#04x", tt.fen, tt.move, pm, tt.pm)
+		}
+		if decoded, ok := DecodeMove(b, tt.pm); !ok || decoded != move {
+			t.Errorf("%s %#04x: decoded %s %v, want %s", tt.fen, tt.pm, b.ToAlgebraNotation(decoded), ok, tt.move)
+		}
+	}
+
+	// without the right the king can't take the rook
+	b := load(t, "r3k2r/8/8/8/8/8/8/R3K2R w Qkq - 0 1")
+	if move, ok := DecodeMove(b, 4<<6|7); ok {
+		t.Errorf("decoded e1h1 to %s with no kingside right", b.ToAlgebraNotation(move))
+	}
+}
+
+func TestPromotionMoves(t *testing.T) {
+	b := load(t, "8/1P6/8/8/8/8/8/k1K5 w - - 0 1")
+	for _, tt := range []struct {
+		move string
+		pm   uint16
+	}{
+		{"b7b8n", 1<<12 | 49<<6 | 57},
+		{"b7b8b", 2<<12 | 49<<6 | 57},
+		{"b7b8r", 3<<12 | 49<<6 | 57},
+		{"b7b8q", 4<<12 | 49<<6 | 57},
+	} {
+		move := find(t, b, tt.move)
+		if pm := EncodeMove(b, move); pm != tt.pm {
+			t.Errorf("%s: encoded %#04x, want %#04x", tt.move, pm, tt.pm)
+		}
+		if decoded, ok := DecodeMove(b, tt.pm); !ok || decoded != move {
+			t.Errorf("%#04x: decoded %s %v, want %s", tt.pm, b.ToAlgebraNotation(decoded), ok, tt.move)
+		}
+	}
+}
+
+// testdata/tiny.bin has e4 (10), d4 (5) and the illegal e2e5 (100) from
+// the start, and e5 (7) and c5 (3) after 1. e4.
+func TestProbe(t *testing.T) {
+	bk, err := Open("testdata/tiny.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bk.Len() != 5 {
+		t.Fatalf("%d entries, want 5", bk.Len())
+	}
+
+	b := load(t, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	entries, moves := bk.Entries(b)
+	if len(moves) != 2 || b.ToAlgebraNotation(moves[0]) != "e2e4" || b.ToAlgebraNotation(moves[1]) != "d2d4" {
+		t.Fatalf("start: moves %v", moves)
+	}
+	if entries[0].Weight != 10 || entries[1].Weight != 5 {
+		t.Errorf("start: entries %+v", entries)
+	}
+
+	bk.Best = true
+	move, ok := bk.Probe(b)
+	if !ok || b.ToAlgebraNotation(move) != "e2e4" {
+		t.Fatalf("start: best move %s %v, want e2e4", b.ToAlgebraNotation(move), ok)
+	}
+
+	b.Push(&move)
+	if move, ok := bk.Probe(b); !ok || b.ToAlgebraNotation(move) != "e7e5" {
+		t.Errorf("1. e4: best move %s %v, want e7e5", b.ToAlgebraNotation(move), ok)
+	}
+
+	bk.Best = false
+	seen := map[string]bool{}
+	for range 200 {
+		move, _ := bk.Probe(b)
+		seen[b.ToAlgebraNotation(move)] = true
+	}
+	if len(seen) != 2 || !seen["e7e5"] || !seen["c7c5"] {
+		t.Errorf("1. e4: weighted picks %v", seen)
+	}
+
+	b = load(t, "rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2")
+	if move, ok := bk.Probe(b); ok {
+		t.Errorf("out of book, got %s", b.ToAlgebraNotation(move))
+	}
+}
+
+func TestSaveOpen(t *testing.T) {
+	bk, err := Open("testdata/tiny.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir() + "/book.bin"
+	if err := bk.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.entries) != len(bk.entries) {
+		t.Fatalf("%d entries saved, want %d", len(saved.entries), len(bk.entries))
+	}
+	for i := range bk.entries {
+		if saved.entries[i] != bk.entries[i] {
+			t.Errorf("entry %d: %+v, want %+v", i, saved.entries[i], bk.entries[i])
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package book
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"gochess/core"
+	"os"
+	"slices"
+)
+
+// MoveStats is how a move has done in the games a book is built from,
+// counted from the side that played it.
+type MoveStats struct {
+	Games, Wins, Draws, Losses int
+}
+
+// Score is the Polyglot weighting of a move, two points a win and one a draw.
+func (s MoveStats) Score() int {
+	return 2*s.Wins + s.Draws
+}
+
+type bookMove struct {
+	key  uint64
+	move uint16
+}
+
+// Builder collects moves from games to turn into a book.
+type Builder struct {
+	stats map[bookMove]*MoveStats
+}
+
+func NewBuilder() *Builder {
+	return &Builder{stats: map[bookMove]*MoveStats{}}
+}
+
+// Add counts move being played on board in a game whose result, from
+// white's point of view, is 1 for a win, 0 for a draw and -1 for a loss.
+func (bb *Builder) Add(board *core.Board, move core.Move, result int) {
+	bm := bookMove{key: Key(board), move: EncodeMove(board, move)}
+	s := bb.stats[bm]
+	if s == nil {
+		s = &MoveStats{}
+		bb.stats[bm] = s
+	}
+
+	if !board.WhiteToMove {
+		result = -result
+	}
+	s.Games++
+	switch result {
+	case 1:
+		s.Wins++
+	case 0:
+		s.Draws++
+	default:
+		s.Losses++
+	}
+}
+
+// Positions returns the number of distinct positions seen so far.
+func (bb *Builder) Positions() int {
+	keys := map[uint64]struct{}{}
+	for bm := range bb.stats {
+		keys[bm.key] = struct{}{}
+	}
+	return len(keys)
+}
+
+// Book turns what has been collected into a book. Moves played in fewer
+// than minGames games and moves that never scored are left out. Weights are
+// scaled down per position when the scores don't fit in 16 bits.
+func (bb *Builder) Book(minGames int) *Book {
+	var entries []Entry
+	for bm, s := range bb.stats {
+		if s.Games < minGames || s.Score() == 0 {
+			continue
+		}
+		entries = append(entries, Entry{Key: bm.key, Move: bm.move, Learn: uint32(s.Score())})
+	}
+	sortEntries(entries)
+
+	// Learn holds the raw score until the weights are worked out
+	for i := 0; i < len(entries); {
+		j, best := i, uint32(0)
+		for ; j < len(entries) && entries[j].Key == entries[i].Key; j++ {
+			best = max(best, entries[j].Learn)
+		}
+		for k := i; k < j; k++ {
+			weight := entries[k].Learn
+			if best > 0xffff {
+				weight = max(uint32(uint64(weight)*0xffff/uint64(best)), 1)
+			}
+			entries[k].Weight = uint16(weight)
+			entries[k].Learn = 0
+		}
+		i = j
+	}
+
+	return newBook(entries)
+}
+
+// Merge makes one book out of two. Positions found in both get their moves
+// from a only, so the first book takes priority.
+func Merge(a, b *Book) *Book {
+	entries := slices.Clone(a.entries)
+	for i := 0; i < len(b.entries); {
+		j := i
+		for j < len(b.entries) && b.entries[j].Key == b.entries[i].Key {
+			j++
+		}
+		if !a.has(b.entries[i].Key) {
+			entries = append(entries, b.entries[i:j]...)
+		}
+		i = j
+	}
+	return newBook(entries)
+}
+
+func (bk *Book) has(key uint64) bool {
+	_, found := slices.BinarySearchFunc(bk.entries, key, func(e Entry, key uint64) int {
+		return cmp.Compare(e.Key, key)
+	})
+	return found
+}
+
+// Save writes the book to path in Polyglot format.
+func (bk *Book) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	var rec [entrySize]byte
+	for _, entry := range bk.entries {
+		binary.BigEndian.PutUint64(rec[0:8], entry.Key)
+		binary.BigEndian.PutUint16(rec[8:10], entry.Move)
+		binary.BigEndian.PutUint16(rec[10:12], entry.Weight)
+		binary.BigEndian.PutUint32(rec[12:16], entry.Learn)
+		if _, err := w.Write(rec[:]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// sortEntries puts entries in book order: by key, then best weight first.
+func sortEntries(entries []Entry) {
+	slices.SortStableFunc(entries, func(a, b Entry) int {
+		if c := cmp.Compare(a.Key, b.Key); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.Weight, a.Weight)
+	})
+}
@@ -0,0 +1,194 @@
+package book
+
+import (
+	"gochess/core"
+	"gochess/fen"
+	"gochess/pgn"
+	"io"
+	"maps"
+	"strings"
+	"testing"
+)
+
+const games = `[Result "1-0"]
+
+1. e4 e5 2. Nf3 1-0
+
+[Result "0-1"]
+
+1. e4 c5 0-1
+
+[Result "1/2-1/2"]
+
+1. e4 e5 1/2-1/2
+
+[Result "1-0"]
+
+1. d4 d5 1-0
+`
+
+// build adds every move of the games in s to a new builder, the way the book
+// command does.
+func build(t *testing.T, s string) *Builder {
+	t.Helper()
+	bb := NewBuilder()
+	r := pgn.NewReader(strings.NewReader(s))
+	for {
+		game, err := r.Next()
+		if err == io.EOF {
+			return bb
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := 0
+		switch game.Result {
+		case "1-0":
+			result = 1
+		case "0-1":
+			result = -1
+		}
+		if _, err := game.Replay(func(board *core.Board, move core.Move) bool {
+			bb.Add(board, move, result)
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// play returns the position after the moves, given in coordinate notation.
+func play(t *testing.T, moves ...string) *core.Board {
+	t.Helper()
+	b := load(t, fen.DefaultFEN())
+	for _, s := range moves {
+		move := find(t, b, s)
+		b.Push(&move)
+	}
+	return b
+}
+
+// weights returns the weight of each move the book has for b.
+func weights(bk *Book, b *core.Board) map[string]uint16 {
+	got := map[string]uint16{}
+	entries, moves := bk.Entries(b)
+	for i, move := range moves {
+		got[b.ToAlgebraNotation(move)] = entries[i].Weight
+	}
+	return got
+}
+
+func TestBuilderStats(t *testing.T) {
+	bb := build(t, games)
+	if n := bb.Positions(); n != 4 {
+		t.Errorf("%d positions, want 4", n)
+	}
+
+	for _, tt := range []struct {
+		moves []string
+		move  string
+		stats MoveStats
+	}{
+		{nil, "e2e4", MoveStats{Games: 3, Wins: 1, Draws: 1, Losses: 1}},
+		{nil, "d2d4", MoveStats{Games: 1, Wins: 1}},
+		// counted for the side that played them
+		{[]string{"e2e4"}, "e7e5", MoveStats{Games: 2, Draws: 1, Losses: 1}},
+		{[]string{"e2e4"}, "c7c5", MoveStats{Games: 1, Wins: 1}},
+		{[]string{"e2e4", "e7e5"}, "g1f3", MoveStats{Games: 1, Wins: 1}},
+		{[]string{"d2d4"}, "d7d5", MoveStats{Games: 1, Losses: 1}},
+	} {
+		b := play(t, tt.moves...)
+		s := bb.stats[bookMove{key: Key(b), move: EncodeMove(b, find(t, b, tt.move))}]
+		if s == nil || *s != tt.stats {
+			t.Errorf("%v %s: %+v, want %+v", tt.moves, tt.move, s, tt.stats)
+		}
+	}
+}
+
+func TestBuilderBook(t *testing.T) {
+	bb := build(t, games)
+
+	// weighted by score, and d7d5 never scored
+	bk := bb.Book(1)
+	for _, tt := range []struct {
+		moves []string
+		want  map[string]uint16
+	}{
+		{nil, map[string]uint16{"e2e4": 3, "d2d4": 2}},
+		{[]string{"e2e4"}, map[string]uint16{"e7e5": 1, "c7c5": 2}},
+		{[]string{"e2e4", "e7e5"}, map[string]uint16{"g1f3": 2}},
+		{[]string{"d2d4"}, map[string]uint16{}},
+	} {
+		if got := weights(bk, play(t, tt.moves...)); !maps.Equal(got, tt.want) {
+			t.Errorf("%v: weights %v, want %v", tt.moves, got, tt.want)
+		}
+	}
+
+	// only the moves played in two games or more
+	bk = bb.Book(2)
+	if bk.Len() != 2 {
+		t.Errorf("%d entries from at least two games, want 2", bk.Len())
+	}
+	if got := weights(bk, play(t, "e2e4")); !maps.Equal(got, map[string]uint16{"e7e5": 1}) {
+		t.Errorf("after e2e4: weights %v", got)
+	}
+}
+
+// Scores past 16 bits are scaled down so the best move of the position gets
+// the top weight, and none drop to nothing.
+func TestBuilderBookScaling(t *testing.T) {
+	bb := NewBuilder()
+	b := play(t)
+	e4, d4, c4 := find(t, b, "e2e4"), find(t, b, "d2d4"), find(t, b, "c2c4")
+	for range 40000 {
+		bb.Add(b, e4, 1)
+	}
+	for range 20000 {
+		bb.Add(b, d4, 1)
+	}
+	bb.Add(b, c4, 0)
+	// the position after e2e4 is left alone
+	after := play(t, "e2e4")
+	bb.Add(after, find(t, after, "c7c5"), -1)
+
+	bk := bb.Book(1)
+	if got, want := weights(bk, b), map[string]uint16{"e2e4": 0xffff, "d2d4": 0x7fff, "c2c4": 1}; !maps.Equal(got, want) {
+		t.Errorf("weights %v, want %v", got, want)
+	}
+	if got, want := weights(bk, after), map[string]uint16{"c7c5": 2}; !maps.Equal(got, want) {
+		t.Errorf("after e2e4: weights %v, want %v", got, want)
+	}
+	for _, entry := range bk.entries {
+		if entry.Learn != 0 {
+			t.Errorf("%+v: learn left set", entry)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := build(t, `[Result "1-0"]
+
+1. e4 e5 1-0
+`).Book(1)
+	b := build(t, games).Book(1)
+
+	merged := Merge(a, b)
+	for _, tt := range []struct {
+		moves []string
+		want  map[string]uint16
+	}{
+		// in both books, a's moves only
+		{nil, map[string]uint16{"e2e4": 2}},
+		// only in b
+		{[]string{"e2e4"}, map[string]uint16{"e7e5": 1, "c7c5": 2}},
+		{[]string{"e2e4", "e7e5"}, map[string]uint16{"g1f3": 2}},
+	} {
+		if got := weights(merged, play(t, tt.moves...)); !maps.Equal(got, tt.want) {
+			t.Errorf("%v: weights %v, want %v", tt.moves, got, tt.want)
+		}
+	}
+	if merged.Len() != 4 {
+		t.Errorf("%d entries merged, want 4", merged.Len())
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gochess/book"
+	"gochess/core"
+	"gochess/pgn"
+	"io"
+	"os"
+	"strings"
+)
+
+func bookMain(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: gochess book build|merge [options]")
+		os.Exit(2)
+	}
+
+	var err error
+	switch args[0] {
+	case "build":
+		err = bookBuild(args[1:])
+	case "merge":
+		err = bookMerge(args[1:])
+	default:
+		err = fmt.Errorf("unknown book command %q", args[0])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "book:", err)
+		os.Exit(1)
+	}
+}
+
+func bookBuild(args []string) error {
+	fs := flag.NewFlagSet("book build", flag.ExitOnError)
+	out := fs.String("o", "book.bin", "book to write")
+	minElo := fs.Int("min-elo", 0, "skip games where either player is rated below this")
+	results := fs.String("results", "1-0,0-1,1/2-1/2", "results of the games to use")
+	maxPly := fs.Int("max-ply", 30, "only take moves from this many plies into each game")
+	minGames := fs.Int("min-games", 1, "leave out moves played in fewer games than this")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gochess book build [options] games.pgn...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	wanted := map[string]bool{}
+	for _, r := range strings.Split(*results, ",") {
+		wanted[strings.TrimSpace(r)] = true
+	}
+
+	builder := book.NewBuilder()
+	used, skipped := 0, 0
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		r := pgn.NewReader(f)
+		for {
+			game, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				f.Close()
+				return fmt.Errorf("%s: %w", path, err)
+			}
+
+			if !wanted[game.Result] || game.Result == "*" ||
+				*minElo > 0 && (game.Rating(true) < *minElo || game.Rating(false) < *minElo) {
+				skipped++
+				continue
+			}
+
+			result := 0
+			switch game.Result {
+			case "1-0":
+				result = 1
+			case "0-1":
+				result = -1
+			}
+
+			// a game with a bad move is left out whole, check it before
+			// anything goes into the book
+			if _, err := game.Replay(nil); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: game %d: %v\n", path, used+skipped+1, err)
+				skipped++
+				continue
+			}
+
+			ply := 0
+			game.Replay(func(board *core.Board, move core.Move) bool {
+				if ply >= *maxPly {
+					return false
+				}
+				builder.Add(board, move, result)
+				ply++
+				return true
+			})
+			used++
+		}
+		f.Close()
+	}
+
+	bk := builder.Book(*minGames)
+	if err := bk.Save(*out); err != nil {
+		return err
+	}
+	fmt.Printf("%d games used, %d skipped, %d positions, %d entries written to %s\n",
+		used, skipped, builder.Positions(), bk.Len(), *out)
+	return nil
+}
+
+func bookMerge(args []string) error {
+	fs := flag.NewFlagSet("book merge", flag.ExitOnError)
+	out := fs.String("o", "book.bin", "book to write")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gochess book merge [options] first.bin second.bin")
+		fmt.Fprintln(os.Stderr, "positions in both books take their moves from the first")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	a, err := book.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := book.Open(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	merged := book.Merge(a, b)
+	if err := merged.Save(*out); err != nil {
+		return err
+	}
+	fmt.Printf("%d + %d entries merged into %d, written to %s\n", a.Len(), b.Len(), merged.Len(), *out)
+	return nil
+}
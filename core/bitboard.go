@@ -1,21 +1,31 @@
 package core
 
-import "math/bits"
+import (
+	"iter"
+	"math/bits"
+)
 
 type Bitboard uint64
 
 func (bb Bitboard) Squares() []uint8 {
 	squares := []uint8{}
-	b := bb
-	for b != 0 {
-		lsb := b & -b
-		sq := uint8(bits.TrailingZeros64(uint64(lsb)))
-		squares = append(squares, sq)
-		b &= b - 1
+	for sq := range bb.All() {
+		squares = append(squares, uint8(sq))
 	}
 	return squares
 }
 
+// All iterates over the squares set in bb, lowest first, without allocating.
+func (bb Bitboard) All() iter.Seq[Position] {
+	return func(yield func(Position) bool) {
+		for bb != 0 {
+			if !yield(Position(bb.PopLSB())) {
+				return
+			}
+		}
+	}
+}
+
 func (bb *Bitboard) PopLSB() int {
 	sq := bits.TrailingZeros64(uint64(*bb))
 	*bb &= *bb - 1
@@ -0,0 +1,406 @@
+package core
+
+var (
+	betweenTable = computeBetweenTable()
+	lineTable    = computeLineTable()
+)
+
+// castle describes one of the four castling moves.
+type castle struct {
+	right uint8
+	from  Position
+	to    Position
+	empty Bitboard // must be empty between king and rook
+	safe  Bitboard // the king passes through, must not be attacked
+}
+
+var castles = [2][2]castle{
+	{
+		{CastlingWhiteKingside, 4, 6, 1<<5 | 1<<6, 1<<5 | 1<<6},
+		{CastlingWhiteQueenside, 4, 2, 1<<1 | 1<<2 | 1<<3, 1<<2 | 1<<3},
+	},
+	{
+		{CastlingBlackKingside, 60, 62, 1<<61 | 1<<62, 1<<61 | 1<<62},
+		{CastlingBlackQueenside, 60, 58, 1<<57 | 1<<58 | 1<<59, 1<<58 | 1<<59},
+	},
+}
+
+func computeBetweenTable() (table [64][64]Bitboard) {
+	for a := range Position(64) {
+		for b := range Position(64) {
+			table[a][b] = betweenMask(a, b)
+		}
+	}
+	return table
+}
+
+// computeLineTable finds the whole rank, file or diagonal through every pair
+// of aligned squares, zero for squares that aren't aligned.
+func computeLineTable() (table [64][64]Bitboard) {
+	for a := range Position(64) {
+		for b := range Position(64) {
+			if a == b {
+				continue
+			}
+			ends := Bitboard(1)<<a | Bitboard(1)<<b
+			if zeroOccupancyRookAttacks[a]&(1<<b) != 0 {
+				table[a][b] = zeroOccupancyRookAttacks[a]&zeroOccupancyRookAttacks[b] | ends
+			} else if zeroOccupancyBishopAttacks[a]&(1<<b) != 0 {
+				table[a][b] = zeroOccupancyBishopAttacks[a]&zeroOccupancyBishopAttacks[b] | ends
+			}
+		}
+	}
+	return table
+}
+
+func sideIndex(white bool) int {
+	if white {
+		return 0
+	}
+	return 1
+}
+
+// sideBitboards returns the pieces of the side to move and of its opponent.
+func (b *Board) sideBitboards() (ours, theirs Bitboard) {
+	if b.WhiteToMove {
+		return b.WhitePieces, b.BlackPieces
+	}
+	return b.BlackPieces, b.WhitePieces
+}
+
+// AttackersTo returns the pieces of both colours attacking sq, with sliders
+// seeing through everything not in occ.
+func (b *Board) AttackersTo(sq Position, occ Bitboard) Bitboard {
+	white, black := &b.PieceBitboards[0], &b.PieceBitboards[1]
+
+	rooks := white[PieceTypeRook-1] | white[PieceTypeQueen-1] | black[PieceTypeRook-1] | black[PieceTypeQueen-1]
+	bishops := white[PieceTypeBishop-1] | white[PieceTypeQueen-1] | black[PieceTypeBishop-1] | black[PieceTypeQueen-1]
+
+	// a white pawn attacks sq from where a black pawn on sq would attack, and the other way around
+	return pawnAttacks[1][sq]&white[PieceTypePawn-1] |
+		pawnAttacks[0][sq]&black[PieceTypePawn-1] |
+		knightAttacks[sq]&(white[PieceTypeKnight-1]|black[PieceTypeKnight-1]) |
+		kingAttacks[sq]&(white[PieceTypeKing-1]|black[PieceTypeKing-1]) |
+		getSlidingAttacksWithOcc(slidingRook, int(sq), occ)&rooks |
+		getSlidingAttacksWithOcc(slidingBishop, int(sq), occ)&bishops
+}
+
+// Checkers returns the enemy pieces giving check to the side to move.
+func (b *Board) Checkers() Bitboard {
+	kingSq := b.KingSquare(b.WhiteToMove)
+	if kingSq >= 64 {
+		return 0
+	}
+	_, theirs := b.sideBitboards()
+	return b.AttackersTo(kingSq, b.AllPieces) & theirs
+}
+
+// Pinned returns the pieces of the side to move that can't leave the line
+// between their king and an enemy slider without exposing the king. A pinned
+// piece at sq may still move along LineThrough(king, sq).
+func (b *Board) Pinned() Bitboard {
+	kingSq := b.KingSquare(b.WhiteToMove)
+	if kingSq >= 64 {
+		return 0
+	}
+	return b.pinned(kingSq)
+}
+
+func (b *Board) pinned(kingSq Position) Bitboard {
+	ours, _ := b.sideBitboards()
+	enemy := &b.PieceBitboards[1-sideIndex(b.WhiteToMove)]
+
+	snipers := zeroOccupancyRookAttacks[kingSq]&(enemy[PieceTypeRook-1]|enemy[PieceTypeQueen-1]) |
+		zeroOccupancyBishopAttacks[kingSq]&(enemy[PieceTypeBishop-1]|enemy[PieceTypeQueen-1])
+
+	var pinned Bitboard
+	for sniper := range snipers.All() {
+		blockers := betweenTable[kingSq][sniper] & b.AllPieces
+		if blockers.PopCount() == 1 && blockers&ours != 0 {
+			pinned |= blockers
+		}
+	}
+	return pinned
+}
+
+// LineThrough returns the whole rank, file or diagonal through a and b, or
+// zero if they aren't on one.
+func LineThrough(a, b Position) Bitboard {
+	return lineTable[a][b]
+}
+
+// Attacks returns the squares a knight, bishop, rook, queen or king of
+// pieceType attacks from sq, sliders stopping at the first piece in occ.
+func Attacks(pieceType uint8, sq Position, occ Bitboard) Bitboard {
+	switch pieceType {
+	case PieceTypeKnight:
+		return knightAttacks[sq]
+	case PieceTypeBishop:
+		return getSlidingAttacksWithOcc(slidingBishop, int(sq), occ)
+	case PieceTypeRook:
+		return getSlidingAttacksWithOcc(slidingRook, int(sq), occ)
+	case PieceTypeQueen:
+		return getSlidingAttacksWithOcc(slidingBishop, int(sq), occ) | getSlidingAttacksWithOcc(slidingRook, int(sq), occ)
+	case PieceTypeKing:
+		return kingAttacks[sq]
+	}
+	return 0
+}
+
+// enPassantIsLegal plays the en passant capture from-to on the bitboards
+// only and checks whether it leaves the king attacked. This covers the
+// captured pawn having given check, pins, and the case where the capture
+// takes two pawns off the king's rank at once.
+func (b *Board) enPassantIsLegal(from, to, kingSq Position) bool {
+	captureSq := to - 8
+	if !b.WhiteToMove {
+		captureSq = to + 8
+	}
+
+	_, theirs := b.sideBitboards()
+	occ := b.AllPieces&^(1<<from)&^(1<<captureSq) | 1<<to
+	return b.AttackersTo(kingSq, occ)&theirs&^(1<<captureSq) == 0
+}
+
+// kingMoveIsLegal reports whether the king on from can step to to.
+func (b *Board) kingMoveIsLegal(from, to Position) bool {
+	_, theirs := b.sideBitboards()
+	return b.AttackersTo(to, b.AllPieces&^(1<<from))&theirs == 0
+}
+
+func (b *Board) canCastle(c castle) bool {
+	if b.CastlingRights&c.right == 0 || b.AllPieces&c.empty != 0 {
+		return false
+	}
+	_, theirs := b.sideBitboards()
+	for sq := range c.safe.All() {
+		if b.AttackersTo(sq, b.AllPieces)&theirs != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Kinds of moves generateLegal can be asked for.
+const (
+	genAll      = iota
+	genCaptures // regular captures, no en passant or promotions that don't capture
+	genTactical // every capture including en passant, and every promotion
+)
+
+// generateLegal writes the legal moves of the given kind to buf. Checkers
+// and pins are worked out once up front, so apart from king moves and en
+// passant no move needs to be tried on the board to know it's legal.
+func (b *Board) generateLegal(buf *[MaxMoves]Move, kind int) []Move {
+	moves := buf[:0]
+
+	kingSq := b.KingSquare(b.WhiteToMove)
+	if kingSq >= 64 {
+		return moves
+	}
+
+	us := sideIndex(b.WhiteToMove)
+	ours, theirs := b.sideBitboards()
+	occ := b.AllPieces
+
+	targets := ^ours
+	if kind != genAll {
+		targets = theirs
+	}
+
+	for to := range (kingAttacks[kingSq] & targets).All() {
+		if b.kingMoveIsLegal(kingSq, to) {
+			moves = append(moves, Move{From: kingSq, To: to})
+		}
+	}
+
+	checkers := b.AttackersTo(kingSq, occ) & theirs
+	if checkers.PopCount() > 1 {
+		return moves // only the king can get out of a double check
+	}
+
+	// In check every other move has to capture the checker or block it
+	checkMask := ^Bitboard(0)
+	if checkers != 0 {
+		checker := Position(checkers.LSB())
+		checkMask = betweenTable[kingSq][checker] | 1<<checker
+	} else if kind == genAll {
+		for _, c := range castles[us] {
+			if c.from == kingSq && b.canCastle(c) {
+				moves = append(moves, Move{From: kingSq, To: c.to})
+			}
+		}
+	}
+
+	pinned := b.pinned(kingSq)
+
+	for from := range (ours &^ (1 << kingSq)).All() {
+		allowed := targets & checkMask
+		if pinned&(1<<from) != 0 {
+			allowed &= lineTable[kingSq][from]
+		}
+
+		var attacks Bitboard
+		switch b.Pieces[from].Type() {
+		case PieceTypeKnight:
+			attacks = knightAttacks[from]
+		case PieceTypeBishop:
+			attacks = getSlidingAttacksWithOcc(slidingBishop, int(from), occ)
+		case PieceTypeRook:
+			attacks = getSlidingAttacksWithOcc(slidingRook, int(from), occ)
+		case PieceTypeQueen:
+			attacks = getSlidingAttacksWithOcc(slidingRook, int(from), occ) | getSlidingAttacksWithOcc(slidingBishop, int(from), occ)
+		case PieceTypePawn:
+			moves = b.appendPawnMoves(moves, from, kingSq, checkMask, pinned, kind)
+			continue
+		}
+
+		for to := range (attacks & allowed).All() {
+			moves = append(moves, Move{From: from, To: to})
+		}
+	}
+
+	return moves
+}
+
+// appendPawnMoves adds the moves of the given kind of the pawn on from.
+// En passant is checked on its own, the rest have to stay within checkMask
+// and on the pin line if the pawn is pinned.
+func (b *Board) appendPawnMoves(moves []Move, from, kingSq Position, checkMask, pinned Bitboard, kind int) []Move {
+	us := sideIndex(b.WhiteToMove)
+	_, theirs := b.sideBitboards()
+	color := b.Pieces[from].Color()
+
+	single, double := from+8, from+16
+	startRank, promotionRank := Position(1), Position(6)
+	if !b.WhiteToMove {
+		single, double = from-8, from-16
+		startRank, promotionRank = 6, 1
+	}
+	promotes := from>>3 == promotionRank
+
+	allowed := checkMask
+	if pinned&(1<<from) != 0 {
+		allowed &= lineTable[kingSq][from]
+	}
+
+	targets := pawnAttacks[us][from] & theirs & allowed
+
+	if b.AllPieces&(1<<single) == 0 && (kind == genAll || kind == genTactical && promotes) {
+		targets |= (1 << single) & allowed
+		if kind == genAll && from>>3 == startRank && b.AllPieces&(1<<double) == 0 {
+			targets |= (1 << double) & allowed
+		}
+	}
+
+	for to := range targets.All() {
+		if promotes {
+			for _, promoType := range promotionTypes {
+				moves = append(moves, Move{From: from, To: to, Promotion: Piece(color | promoType)})
+			}
+		} else {
+			moves = append(moves, Move{From: from, To: to})
+		}
+	}
+
+	ep := b.EnPassantTarget
+	if kind != genCaptures && ep < 64 && pawnAttacks[us][from]&(1<<ep) != 0 && b.enPassantIsLegal(from, ep, kingSq) {
+		moves = append(moves, Move{From: from, To: ep})
+	}
+
+	return moves
+}
+
+// IsMoveLegal reports whether move can be played in the position, without
+// generating any moves.
+func (b *Board) IsMoveLegal(move Move) bool {
+	from, to := move.From, move.To
+	if from >= 64 || to >= 64 {
+		return false
+	}
+
+	ours, theirs := b.sideBitboards()
+	if ours&(1<<from) == 0 || ours&(1<<to) != 0 {
+		return false
+	}
+
+	kingSq := b.KingSquare(b.WhiteToMove)
+	if kingSq >= 64 {
+		return false
+	}
+
+	us := sideIndex(b.WhiteToMove)
+	piece := b.Pieces[from]
+	occ := b.AllPieces
+
+	lastRank := Position(7)
+	if !b.WhiteToMove {
+		lastRank = 0
+	}
+	if piece.Type() == PieceTypePawn && to>>3 == lastRank {
+		promo := move.Promotion
+		if promo.Color() != piece.Color() || promo.Type() < PieceTypeKnight || promo.Type() > PieceTypeQueen {
+			return false
+		}
+	} else if move.Promotion != PieceNone {
+		return false
+	}
+
+	var reachable bool
+	switch piece.Type() {
+	case PieceTypeKing:
+		if kingAttacks[from]&(1<<to) != 0 {
+			return b.kingMoveIsLegal(from, to)
+		}
+		if b.AttackersTo(kingSq, occ)&theirs != 0 {
+			return false
+		}
+		for _, c := range castles[us] {
+			if c.from == from && c.to == to {
+				return b.canCastle(c)
+			}
+		}
+		return false
+	case PieceTypeKnight:
+		reachable = knightAttacks[from]&(1<<to) != 0
+	case PieceTypeBishop:
+		reachable = getSlidingAttacksWithOcc(slidingBishop, int(from), occ)&(1<<to) != 0
+	case PieceTypeRook:
+		reachable = getSlidingAttacksWithOcc(slidingRook, int(from), occ)&(1<<to) != 0
+	case PieceTypeQueen:
+		reachable = (getSlidingAttacksWithOcc(slidingRook, int(from), occ)|getSlidingAttacksWithOcc(slidingBishop, int(from), occ))&(1<<to) != 0
+	case PieceTypePawn:
+		single, double, startRank := from+8, from+16, Position(1)
+		if !b.WhiteToMove {
+			single, double, startRank = from-8, from-16, 6
+		}
+		if to == b.EnPassantTarget && pawnAttacks[us][from]&(1<<to) != 0 {
+			return b.enPassantIsLegal(from, to, kingSq)
+		}
+		switch {
+		case pawnAttacks[us][from]&(1<<to) != 0:
+			reachable = theirs&(1<<to) != 0
+		case to == single:
+			reachable = occ&(1<<to) == 0
+		case to == double && from>>3 == startRank:
+			reachable = occ&(1<<single) == 0 && occ&(1<<to) == 0
+		}
+	}
+	if !reachable {
+		return false
+	}
+
+	checkers := b.AttackersTo(kingSq, occ) & theirs
+	switch checkers.PopCount() {
+	case 0:
+	case 1:
+		checker := Position(checkers.LSB())
+		if (betweenTable[kingSq][checker]|1<<checker)&(1<<to) == 0 {
+			return false
+		}
+	default:
+		return false
+	}
+
+	return b.pinned(kingSq)&(1<<from) == 0 || lineTable[kingSq][from]&(1<<to) != 0
+}
@@ -28,6 +28,12 @@ type SlidingPiece struct {
 	directions    []Direction
 }
 
+// MaxMoves is more than the number of moves in any chess position, so a
+// [MaxMoves]Move buffer always fits a generated move list.
+const MaxMoves = 256
+
+var promotionTypes = [4]uint8{PieceTypeQueen, PieceTypeRook, PieceTypeBishop, PieceTypeKnight}
+
 type Move struct {
 	From      Position
 	To        Position
@@ -38,12 +44,6 @@ type Direction struct {
 	dr, df int
 }
 
-// TODO: optimize later
-func (b *Board) IsMoveLegal(move Move) bool {
-	moves := b.GenerateLegalMoves()
-	return slices.Contains(moves, move)
-}
-
 func NewSlidingPiece(directions []Direction, magic [64]Bitboard, shifts [64]int) *SlidingPiece {
 	interiorMasks := computeInteriorMasks(directions)
 	attacks := [64][]Bitboard{}
@@ -67,163 +67,48 @@ func (b *Board) InCheck(white bool) bool {
 	if kingSq >= 64 {
 		return false
 	}
-	attackerIsWhite := !white
-	attacking := b.GetAttackingBitboard(kingSq, attackerIsWhite)
-	return (attacking & (1 << kingSq)) != 0
+	enemies := b.BlackPieces
+	if !white {
+		enemies = b.WhitePieces
+	}
+	return b.AttackersTo(kingSq, b.AllPieces)&enemies != 0
 }
 
 func (b *Board) GenerateLegalCaptures() []Move {
-	pseudoLegalMoves := b.GeneratePseudoLegalMoves()
-	captures := []Move{}
-	for _, move := range pseudoLegalMoves {
-		if (b.AllPieces & (1 << move.To)) != 0 {
-			captures = append(captures, move)
-		}
-	}
-	legalCaptures := b.FilterLegality(captures)
-	return legalCaptures
+	var buf [MaxMoves]Move
+	return slices.Clone(b.GenerateLegalCapturesInto(&buf))
 }
 
-func (b *Board) GenerateLegalMoves() []Move {
-	pseudoLegalMoves := b.GeneratePseudoLegalMoves()
-	legalMoves := b.FilterLegality(pseudoLegalMoves)
-	return legalMoves
+// GenerateLegalCapturesInto is GenerateLegalCaptures without allocating, the
+// moves are written to buf and the returned slice shares its memory.
+func (b *Board) GenerateLegalCapturesInto(buf *[MaxMoves]Move) []Move {
+	return b.generateLegal(buf, genCaptures)
 }
 
-func (b *Board) FilterLegality(pseudoLegalMoves []Move) []Move {
-	var friendlyBit int
-	var enemyBit int
-
-	if b.WhiteToMove {
-		friendlyBit = 0
-		enemyBit = 1
-	} else {
-		friendlyBit = 1
-		enemyBit = 0
-	}
-
-	legalMoves := []Move{}
-	kingSq := b.KingSquare(b.WhiteToMove)
-
-	if kingSq >= 64 {
-		return legalMoves
-	}
-
-	knightCheckers := knightAttacks[kingSq] & b.PieceBitboards[enemyBit][PieceTypeKnight-1]
-	pawnCheckers := pawnAttacks[friendlyBit][kingSq] & b.PieceBitboards[enemyBit][PieceTypePawn-1]
-	rookCheckers := b.GetSlidingAttacks(slidingRook, int(kingSq)) & (b.PieceBitboards[enemyBit][PieceTypeRook-1] | b.PieceBitboards[enemyBit][PieceTypeQueen-1])
-	bishopCheckers := b.GetSlidingAttacks(slidingBishop, int(kingSq)) & (b.PieceBitboards[enemyBit][PieceTypeBishop-1] | b.PieceBitboards[enemyBit][PieceTypeQueen-1])
-	checkers := knightCheckers | pawnCheckers | rookCheckers | bishopCheckers
-	checkersN := checkers.PopCount()
-
-	// This needs to operate under a hypothetical occupancy of 0
-	rookLikePinners := zeroOccupancyRookAttacks[kingSq] & (b.PieceBitboards[enemyBit][PieceTypeRook-1] | b.PieceBitboards[enemyBit][PieceTypeQueen-1])
-	bishopLikePinners := zeroOccupancyBishopAttacks[kingSq] & (b.PieceBitboards[enemyBit][PieceTypeBishop-1] | b.PieceBitboards[enemyBit][PieceTypeQueen-1])
-
-	pinners := rookLikePinners | bishopLikePinners
-	occ := b.AllPieces
-
-	var pinnedBB Bitboard = 0
-	var pinAllowedMask [64]Bitboard
-
-	for p := pinners; p != 0; {
-		pinnerSq := Position(p.PopLSB())
-		between := betweenMask(kingSq, pinnerSq)
-		blockers := between & occ
-		if blockers.PopCount() == 1 {
-			pinnedSq := Position(blockers.LSB())
-			isOurPiece := false
-			if friendlyBit == 0 {
-				isOurPiece = ((b.WhitePieces)>>pinnedSq)&1 == 1
-			} else {
-				isOurPiece = ((b.BlackPieces)>>pinnedSq)&1 == 1
-			}
-			if isOurPiece {
-				pinnedBB |= 1 << pinnedSq
-				pinAllowedMask[pinnedSq] = between | (1 << pinnerSq)
-			}
-		}
-	}
+// GenerateTacticalMovesInto writes the legal captures, en passant included,
+// and promotions to buf. The returned slice shares its memory.
+func (b *Board) GenerateTacticalMovesInto(buf *[MaxMoves]Move) []Move {
+	return b.generateLegal(buf, genTactical)
+}
 
-	var checkMask Bitboard = 0
-	switch checkersN {
-	case 0:
-		checkMask = ^Bitboard(0)
-	case 1:
-		checkerSq := Position(checkers.LSB())
-		checkMask = (1 << checkerSq)
-		if rookCheckers != 0 || bishopCheckers != 0 {
-			checkMask |= betweenMask(kingSq, checkerSq)
-		}
-	default:
-		checkMask = 0
-	}
+func (b *Board) GenerateLegalMoves() []Move {
+	var buf [MaxMoves]Move
+	return slices.Clone(b.GenerateLegalMovesInto(&buf))
+}
 
-	attackerIsWhite := !b.WhiteToMove
+// GenerateLegalMovesInto is GenerateLegalMoves without allocating, the moves
+// are written to buf and the returned slice shares its memory.
+func (b *Board) GenerateLegalMovesInto(buf *[MaxMoves]Move) []Move {
+	return b.generateLegal(buf, genAll)
+}
 
+func (b *Board) FilterLegality(pseudoLegalMoves []Move) []Move {
+	legalMoves := []Move{}
 	for _, move := range pseudoLegalMoves {
-		from, to := move.From, move.To
-		type_ := b.Pieces[from] & PieceTypeMask
-
-		if from == kingSq {
-			occ_ := (occ &^ (1 << from)) | (1 << to)
-
-			var enemyAfter [6]Bitboard
-			for i := range 6 {
-				enemyAfter[i] = b.PieceBitboards[enemyBit][i] &^ (1 << to)
-			}
-
-			if !squareIsAttackedUnderOcc(to, attackerIsWhite, occ_, &enemyAfter) {
-				legalMoves = append(legalMoves, move)
-			}
-
-			continue
-		}
-
-		if checkersN >= 2 {
-			continue
-		}
-
-		if (pinnedBB & (1 << from)) != 0 {
-			if pinAllowedMask[from]&(1<<to) == 0 {
-				continue
-			}
-		}
-
-		if checkersN == 1 {
-			if (checkMask & (1 << to)) == 0 {
-				continue
-			}
-		}
-
-		// special case here that i lost my mind over: en passant can reveal a check
-		if type_ == PieceTypePawn && to == b.EnPassantTarget {
-			var captureSq Position
-			if b.WhiteToMove {
-				captureSq = to - 8
-			} else {
-				captureSq = to + 8
-			}
-
-			occ_ := (occ &^ (1 << from) &^ (1 << captureSq)) | (1 << to)
-
-			var enemyAfter [6]Bitboard
-			for i := range 6 {
-				enemyAfter[i] = b.PieceBitboards[enemyBit][i]
-			}
-			enemyAfter[PieceTypePawn-1] &^= 1 << captureSq
-
-			if squareIsAttackedUnderOcc(kingSq, attackerIsWhite, occ_, &enemyAfter) {
-				continue
-			}
-
+		if b.IsMoveLegal(move) {
 			legalMoves = append(legalMoves, move)
-			continue
 		}
-
-		legalMoves = append(legalMoves, move)
 	}
-
 	return legalMoves
 }
 
@@ -285,42 +170,16 @@ func getSlidingAttacksWithOcc(sp *SlidingPiece, sq int, occ Bitboard) Bitboard {
 	return sp.attacks[sq][index]
 }
 
-func squareIsAttackedUnderOcc(pos Position, attackerIsWhite bool, occ Bitboard, enemyPieces *[6]Bitboard) bool {
-	var pawnIndex int
-
-	// pawn attacks are inverted because this is from the perspective of the king being attacked...
-	if attackerIsWhite {
-		pawnIndex = 1
-	} else {
-		pawnIndex = 0
-	}
-
-	if (pawnAttacks[pawnIndex][pos] & enemyPieces[PieceTypePawn-1]) != 0 {
-		return true
-	}
-
-	if (knightAttacks[pos] & enemyPieces[PieceTypeKnight-1]) != 0 {
-		return true
-	}
-
-	if (kingAttacks[pos] & enemyPieces[PieceTypeKing-1]) != 0 {
-		return true
-	}
-
-	rookAtts := getSlidingAttacksWithOcc(slidingRook, int(pos), occ)
-	if (rookAtts & (enemyPieces[PieceTypeRook-1] | enemyPieces[PieceTypeQueen-1])) != 0 {
-		return true
-	}
-	bishopAtts := getSlidingAttacksWithOcc(slidingBishop, int(pos), occ)
-	if (bishopAtts & (enemyPieces[PieceTypeBishop-1] | enemyPieces[PieceTypeQueen-1])) != 0 {
-		return true
-	}
-
-	return false
+func (b *Board) GeneratePseudoLegalMoves() []Move {
+	var buf [MaxMoves]Move
+	return slices.Clone(b.GeneratePseudoLegalMovesInto(&buf))
 }
 
-func (b *Board) GeneratePseudoLegalMoves() []Move {
-	moves := []Move{}
+// GeneratePseudoLegalMovesInto is GeneratePseudoLegalMoves without
+// allocating, the moves are written to buf and the returned slice shares its
+// memory.
+func (b *Board) GeneratePseudoLegalMovesInto(buf *[MaxMoves]Move) []Move {
+	moves := buf[:0]
 
 	var ourBitboard Bitboard
 	var enemyBitboard Bitboard
@@ -394,7 +253,7 @@ func (b *Board) GeneratePseudoLegalMoves() []Move {
 			for attacks != 0 {
 				to := Position(attacks.PopLSB())
 				if (sq >> 3) == promotionRank {
-					for _, promoType := range []uint8{PieceTypeQueen, PieceTypeRook, PieceTypeBishop, PieceTypeKnight} {
+					for _, promoType := range promotionTypes {
 						moves = append(moves, Move{From: sq, To: to, Promotion: Piece(color | promoType)})
 					}
 				} else {
@@ -414,14 +273,12 @@ func (b *Board) GeneratePseudoLegalMoves() []Move {
 			}
 
 			if (sq >> 3) == promotionRank {
-				var promotionMoves []Move
-				for _, promoType := range []uint8{PieceTypeQueen, PieceTypeRook, PieceTypeBishop, PieceTypeKnight} {
+				for _, promoType := range promotionTypes {
 					// forward promotion
 					if (forward < 64) && ((b.AllPieces>>forward)&1) == 0 {
-						promotionMoves = append(promotionMoves, Move{From: sq, To: forward, Promotion: Piece(color | promoType)})
+						moves = append(moves, Move{From: sq, To: forward, Promotion: Piece(color | promoType)})
 					}
 				}
-				moves = append(moves, promotionMoves...)
 			} else if (forward < 64) && ((b.AllPieces>>forward)&1) == 0 {
 				moves = append(moves, Move{From: sq, To: forward})
 				if (sq >> 3) == startRank {
@@ -710,8 +567,11 @@ func (b *Board) GetAttackingBitboard(pos Position, byWhite bool) Bitboard {
 }
 
 func (b *Board) IsSquareAttacked(pos Position, byWhite bool) bool {
-	attacking := b.GetAttackingBitboard(pos, byWhite)
-	return (attacking & (1 << pos)) != 0
+	attackers := b.BlackPieces
+	if byWhite {
+		attackers = b.WhitePieces
+	}
+	return b.AttackersTo(pos, b.AllPieces)&attackers != 0
 }
 
 func (b *Board) KingSquare(white bool) Position {
@@ -0,0 +1,101 @@
+package core_test
+
+import (
+	"gochess/core"
+	"gochess/fen"
+	"testing"
+)
+
+// the usual perft positions, from the chessprogramming wiki
+var perftTests = []struct {
+	name  string
+	fen   string
+	nodes []int // by depth, from 1
+}{
+	{"startpos", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", []int{20, 400, 8902, 197281, 4865609}},
+	{"kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", []int{48, 2039, 97862, 4085603}},
+	{"position 3", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", []int{14, 191, 2812, 43238, 674624}},
+	{"position 4", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", []int{6, 264, 9467, 422333}},
+	{"position 5", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", []int{44, 1486, 62379, 2103487}},
+	{"position 6", "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10", []int{46, 2079, 89890, 3894594}},
+}
+
+func perft(b *core.Board, depth int) int {
+	var buf [core.MaxMoves]core.Move
+	moves := b.GenerateLegalMovesInto(&buf)
+	if depth == 1 {
+		return len(moves)
+	}
+	nodes := 0
+	for _, move := range moves {
+		b.Push(&move)
+		nodes += perft(b, depth-1)
+		b.Pop()
+	}
+	return nodes
+}
+
+func TestPerft(t *testing.T) {
+	for _, tt := range perftTests {
+		b, err := fen.LoadFromFEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for depth := 1; depth <= len(tt.nodes); depth++ {
+			if got := perft(b, depth); got != tt.nodes[depth-1] {
+				t.Errorf("%s depth %d: %d, want %d", tt.name, depth, got, tt.nodes[depth-1])
+			}
+		}
+	}
+}
+
+// TestIsMoveLegal tries every from, to and promotion on the positions a
+// couple of plies into the perft ones, and wants IsMoveLegal to take
+// exactly the generated moves.
+func TestIsMoveLegal(t *testing.T) {
+	for _, tt := range perftTests {
+		b, err := fen.LoadFromFEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mismatches := 0
+		checkIsMoveLegal(t, b, 2, &mismatches)
+		if mismatches > 0 {
+			t.Errorf("%s: %d mismatches", tt.name, mismatches)
+		}
+	}
+}
+
+func checkIsMoveLegal(t *testing.T, b *core.Board, depth int, mismatches *int) {
+	var buf [core.MaxMoves]core.Move
+	moves := b.GenerateLegalMovesInto(&buf)
+	legal := map[core.Move]bool{}
+	for _, move := range moves {
+		legal[move] = true
+	}
+
+	for from := core.Position(0); from < 64; from++ {
+		colour := b.Pieces[from] & core.PieceColorMask
+		promotions := []core.Piece{core.PieceNone, colour | core.PieceTypeQueen, colour | core.PieceTypeKnight}
+		for to := core.Position(0); to < 64; to++ {
+			for _, promotion := range promotions {
+				move := core.Move{From: from, To: to, Promotion: promotion}
+				if b.IsMoveLegal(move) != legal[move] {
+					if *mismatches < 5 {
+						t.Errorf("%s: IsMoveLegal(%s) is %v", fen.BoardToFEN(b), b.ToAlgebraNotation(move), !legal[move])
+					}
+					(*mismatches)++
+				}
+			}
+		}
+	}
+
+	if depth == 0 {
+		return
+	}
+	for _, move := range moves {
+		b.Push(&move)
+		checkIsMoveLegal(t, b, depth-1, mismatches)
+		b.Pop()
+	}
+}
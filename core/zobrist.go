@@ -1,13 +1,14 @@
 package core
 
-import (
-	"math/rand"
-	"time"
-)
+import "math/rand"
 
 const (
 	numPieceTypes = 12
 	numSquares    = 64
+
+	// fixed, so hashes (and with them the TT and the bench node count) are
+	// the same on every run
+	zobristSeed = 0x5eed_c4e55
 )
 
 var zobristTable [numPieceTypes][numSquares]uint64
@@ -16,7 +17,7 @@ var zobristCastlingRights [16]uint64
 var zobristEnPassantFile [8]uint64
 
 func zobristInit() {
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	rng := rand.New(rand.NewSource(zobristSeed))
 	for pt := range numPieceTypes {
 		for sq := range numSquares {
 			zobristTable[pt][sq] = rng.Uint64()
@@ -0,0 +1,288 @@
+// Package datagen makes training data for evaluation tuning and networks:
+// fast self-play games with fixed node searches from random openings, and
+// the quiet positions out of them with their search scores and the games'
+// results.
+package datagen
+
+import (
+	"fmt"
+	"gochess/core"
+	"gochess/engine"
+	"gochess/fen"
+	"gochess/match"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// Generator plays Games games, Threads at a time, and writes the positions
+// to Binary and Text, whichever are set.
+type Generator struct {
+	Games   int
+	Threads int
+	Nodes   uint64            // per move
+	Options map[string]string // for the engine, as match.NewEnginePlayer takes them
+
+	// openings are RandomPlies random moves from the starting position, or
+	// one more so either side can be to move, thrown away when the engine
+	// scores them over MaxOpeningScore either way, if it's set
+	RandomPlies     int
+	MaxOpeningScore int
+
+	Adjudication match.Adjudication
+	Seed         int64 // game i is the same from the same seed
+
+	Binary io.Writer
+	Text   io.Writer
+
+	Log            io.Writer     // gets the progress
+	ReportInterval time.Duration // between progress lines
+}
+
+// Stats are what's been made so far.
+type Stats struct {
+	Games     int
+	Positions int
+	Results   [3]int // by the result from white's side
+}
+
+// played is a game off one of the workers.
+type played struct {
+	entries []Entry
+	result  uint8
+	err     error
+}
+
+// Run plays the games and writes the positions out as each game finishes.
+// It stops at the first error.
+func (g *Generator) Run() (Stats, error) {
+	if g.Log == nil {
+		g.Log = io.Discard
+	}
+
+	games := make(chan int)
+	results := make(chan played)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(games)
+		for i := range g.Games {
+			select {
+			case games <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	threads := max(g.Threads, 1)
+	for range threads {
+		go g.worker(games, results, stop)
+	}
+
+	var stats Stats
+	start := time.Now()
+	lastReport := start
+	for stats.Games < g.Games {
+		p := <-results
+		if p.err != nil {
+			return stats, p.err
+		}
+		if err := g.write(p.entries); err != nil {
+			return stats, err
+		}
+
+		stats.Games++
+		stats.Positions += len(p.entries)
+		stats.Results[p.result]++
+		if time.Since(lastReport) >= g.ReportInterval || stats.Games == g.Games {
+			g.report(stats, time.Since(start))
+			lastReport = time.Now()
+		}
+	}
+	return stats, nil
+}
+
+func (g *Generator) write(entries []Entry) error {
+	for _, e := range entries {
+		if g.Binary != nil {
+			buf := Encode(e)
+			if _, err := g.Binary.Write(buf[:]); err != nil {
+				return err
+			}
+		}
+		if g.Text != nil {
+			if _, err := fmt.Fprintln(g.Text, e.Text()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (g *Generator) report(stats Stats, elapsed time.Duration) {
+	perSecond := float64(stats.Positions) / max(elapsed.Seconds(), 0.001)
+	fmt.Fprintf(g.Log, "games %d/%d, positions %d (%.1f/game, %.0f/s), white +%d =%d -%d\n",
+		stats.Games, g.Games, stats.Positions, float64(stats.Positions)/float64(stats.Games), perSecond,
+		stats.Results[WhiteWin], stats.Results[Draw], stats.Results[BlackWin])
+}
+
+// worker plays the games it's handed with its own engine, for both sides.
+func (g *Generator) worker(games <-chan int, results chan<- played, stop <-chan struct{}) {
+	send := func(p played) bool {
+		select {
+		case results <- p:
+			return true
+		case <-stop:
+			return false
+		}
+	}
+
+	player, err := match.NewEnginePlayer("gochess", g.Options)
+	if err != nil {
+		send(played{err: err})
+		return
+	}
+	defer player.Close()
+
+	for i := range games {
+		rng := rand.New(rand.NewSource(int64(uint64(g.Seed) ^ uint64(i)*0x9e3779b97f4a7c15)))
+		entries, result, err := g.play(player, rng)
+		if !send(played{entries: entries, result: result, err: err}) {
+			return
+		}
+	}
+}
+
+// play plays one game and picks the positions out of it.
+func (g *Generator) play(player match.Player, rng *rand.Rand) ([]Entry, uint8, error) {
+	opening, err := g.opening(player, rng)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := player.NewGame(); err != nil {
+		return nil, 0, err
+	}
+	config := match.GameConfig{
+		TimeControl:  match.TimeControl{Nodes: g.Nodes},
+		Adjudication: g.Adjudication,
+	}
+	result, err := match.Play(player, player, opening, config)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch result.Reason {
+	case "White disconnects", "Black disconnects", "White makes an illegal move", "Black makes an illegal move":
+		return nil, 0, fmt.Errorf("game lost because the engine failed: %s", result.Reason)
+	}
+	var wdl uint8
+	switch result.Score {
+	case "1-0":
+		wdl = WhiteWin
+	case "0-1":
+		wdl = BlackWin
+	default:
+		wdl = Draw
+	}
+
+	board, clocks, err := fen.Parse(opening.FEN)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, move := range opening.Moves {
+		push(board, move, &clocks)
+	}
+
+	var entries []Entry
+	for _, reply := range result.Replies {
+		if quiet(board, reply) {
+			score := reply.Score
+			if !board.WhiteToMove {
+				score = -score
+			}
+			entries = append(entries, Entry{
+				Board:    board.Clone(),
+				Halfmove: clocks.Halfmove,
+				Fullmove: clocks.Fullmove,
+				Score:    int16(score),
+				Result:   wdl,
+			})
+		}
+		push(board, reply.Move, &clocks)
+	}
+	return entries, wdl, nil
+}
+
+// opening plays random moves until it gets a position that isn't over and
+// isn't lost for either side already.
+func (g *Generator) opening(player match.Player, rng *rand.Rand) (match.Opening, error) {
+	for {
+		opening := match.Opening{FEN: fen.DefaultFEN()}
+		board, _, err := fen.Parse(opening.FEN)
+		if err != nil {
+			return opening, err
+		}
+
+		plies := g.RandomPlies + rng.Intn(2)
+		for range plies {
+			moves := board.GenerateLegalMoves()
+			if len(moves) == 0 {
+				break
+			}
+			move := moves[rng.Intn(len(moves))]
+			board.Push(&move)
+			opening.Moves = append(opening.Moves, move)
+		}
+		if len(opening.Moves) < plies || len(board.GenerateLegalMoves()) == 0 {
+			continue
+		}
+
+		if err := player.NewGame(); err != nil {
+			return opening, err
+		}
+		reply, err := player.Play(match.Position{FEN: opening.FEN, Moves: opening.Moves, Board: board}, match.Limits{Nodes: g.Nodes})
+		if err != nil {
+			return opening, err
+		}
+		if g.MaxOpeningScore <= 0 || reply.Score >= -g.MaxOpeningScore && reply.Score <= g.MaxOpeningScore {
+			return opening, nil
+		}
+	}
+}
+
+// quiet is whether the position before reply is worth training on: not in
+// check, the best move not a capture or a promotion, and no mate score,
+// since the evaluation can't be expected to see any of those. The score has
+// to be from a search too, there's none for a forced move.
+func quiet(board *core.Board, reply match.Reply) bool {
+	move := reply.Move
+	piece := board.Pieces[move.From]
+	switch {
+	case reply.Depth == 0:
+		return false
+	case board.InCheck(board.WhiteToMove):
+		return false
+	case board.Pieces[move.To] != core.PieceNone || move.Promotion != core.PieceNone:
+		return false
+	case piece.Type() == core.PieceTypePawn && move.From%8 != move.To%8:
+		return false // en passant
+	case reply.Score >= engine.MateThreshold || reply.Score <= -engine.MateThreshold:
+		return false
+	}
+	return true
+}
+
+// push makes move, keeping the clocks the way a FEN has them.
+func push(board *core.Board, move core.Move, clocks *fen.Clocks) {
+	zeroing := board.Pieces[move.To] != core.PieceNone || board.Pieces[move.From].Type() == core.PieceTypePawn
+	if !board.WhiteToMove {
+		clocks.Fullmove++
+	}
+	board.Push(&move)
+	if zeroing {
+		clocks.Halfmove = 0
+	} else {
+		clocks.Halfmove++
+	}
+}
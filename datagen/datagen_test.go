@@ -0,0 +1,40 @@
+package datagen
+
+import (
+	"gochess/fen"
+	"gochess/match"
+	"testing"
+)
+
+func TestQuiet(t *testing.T) {
+	player, err := match.NewEnginePlayer("gochess", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer player.Close()
+
+	for _, tt := range []struct {
+		fen   string
+		quiet bool
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", true},
+		// a queen down with g2g3 the only move: there's no search to score it
+		{"7k/8/8/7p/6pP/8/2q3P1/K7 w - - 0 1", false},
+		// in check
+		{"4k3/8/8/8/8/8/8/r3K3 w - - 0 1", false},
+		// winning the queen
+		{"4k3/8/8/3q4/4P3/8/8/4K3 w - - 0 1", false},
+	} {
+		board, _, err := fen.Parse(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reply, err := player.Play(match.Position{FEN: tt.fen, Board: board}, match.Limits{Nodes: 5000})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := quiet(board, reply); got != tt.quiet {
+			t.Errorf("%s: %+v quiet %v, want %v", tt.fen, reply, got, tt.quiet)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package datagen
+
+import (
+	"encoding/binary"
+	"fmt"
+	"gochess/core"
+	"gochess/fen"
+	"math/bits"
+)
+
+// RecordSize is the size of an entry in the binary format.
+const RecordSize = 32
+
+// Results, from white's side.
+const (
+	BlackWin = 0
+	Draw     = 1
+	WhiteWin = 2
+)
+
+// Entry is one position for training: the search score and how the game
+// it came from ended, both from white's side.
+type Entry struct {
+	Board    *core.Board
+	Halfmove int
+	Fullmove int
+	Score    int16
+	Result   uint8
+}
+
+// Encode packs e into RecordSize bytes, little endian:
+//
+//	0-7    occupancy, bit i for square i (a1 = 0, h8 = 63)
+//	8-23   the piece on each occupied square in that order, four bits each,
+//	       low nibble first, as core.Piece (type, plus 8 for black)
+//	24-25  score, int16
+//	26     result, 0 black wins, 1 draw, 2 white wins
+//	27     bit 0 black to move, bits 4-7 castling rights as core.Board has them
+//	28     en passant square, 64 for none
+//	29     halfmove clock
+//	30-31  fullmove number
+func Encode(e Entry) [RecordSize]byte {
+	var buf [RecordSize]byte
+	b := e.Board
+	binary.LittleEndian.PutUint64(buf[0:], uint64(b.AllPieces))
+
+	i := 0
+	for occ := uint64(b.AllPieces); occ != 0; occ &= occ - 1 {
+		piece := uint8(b.Pieces[bits.TrailingZeros64(occ)])
+		buf[8+i/2] |= piece << (4 * (i % 2))
+		i++
+	}
+
+	binary.LittleEndian.PutUint16(buf[24:], uint16(e.Score))
+	buf[26] = e.Result
+	if !b.WhiteToMove {
+		buf[27] |= 1
+	}
+	buf[27] |= b.CastlingRights << 4
+	buf[28] = uint8(b.EnPassantTarget)
+	buf[29] = uint8(min(e.Halfmove, 255))
+	binary.LittleEndian.PutUint16(buf[30:], uint16(min(e.Fullmove, 65535)))
+	return buf
+}
+
+// Decode unpacks an entry written by Encode.
+func Decode(buf []byte) (Entry, error) {
+	if len(buf) < RecordSize {
+		return Entry{}, fmt.Errorf("short record, %d bytes", len(buf))
+	}
+	occ := binary.LittleEndian.Uint64(buf[0:])
+	if bits.OnesCount64(occ) > 32 {
+		return Entry{}, fmt.Errorf("%d pieces", bits.OnesCount64(occ))
+	}
+
+	b := core.NewBoard()
+	for i := 0; occ != 0; occ &= occ - 1 {
+		piece := core.Piece(buf[8+i/2] >> (4 * (i % 2)) & 0xf)
+		if piece.Type() == core.PieceTypeNone || piece.Type() > core.PieceTypeKing {
+			return Entry{}, fmt.Errorf("bad piece %d", piece)
+		}
+		b.AddPiece(core.Position(bits.TrailingZeros64(occ)), piece)
+		i++
+	}
+	b.WhiteToMove = buf[27]&1 == 0
+	b.CastlingRights = buf[27] >> 4
+	b.EnPassantTarget = core.Position(min(buf[28], 64))
+
+	e := Entry{
+		Board:    b,
+		Score:    int16(binary.LittleEndian.Uint16(buf[24:])),
+		Result:   buf[26],
+		Halfmove: int(buf[29]),
+		Fullmove: int(binary.LittleEndian.Uint16(buf[30:])),
+	}
+	if e.Result > WhiteWin {
+		return Entry{}, fmt.Errorf("bad result %d", e.Result)
+	}
+	return e, nil
+}
+
+// Text is the entry as a line of the text format, without the newline:
+//
+//	<FEN> | <score> | <1.0, 0.5 or 0.0>
+func (e Entry) Text() string {
+	return fmt.Sprintf("%s %d %d | %d | %s", fen.BoardToFEN(e.Board), e.Halfmove, e.Fullmove, e.Score, resultText[e.Result])
+}
+
+var resultText = [...]string{BlackWin: "0.0", Draw: "0.5", WhiteWin: "1.0"}
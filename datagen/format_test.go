@@ -0,0 +1,102 @@
+package datagen
+
+import (
+	"gochess/fen"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	for _, tt := range []struct {
+		fen    string
+		score  int16
+		result uint8
+	}{
+		// black to move, an en passant square and all 32 pieces
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", 30, Draw},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", -45, BlackWin},
+		// some of the castling rights
+		{"r3k2r/8/8/8/8/8/8/R3K2R w Kq - 17 40", -32768, BlackWin},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b Qk - 3 41", 32767, WhiteWin},
+		{"4k3/8/8/8/8/8/8/4K3 w - - 99 300", 0, Draw},
+		// clocks past what the record holds are capped
+		{"4k3/8/8/8/8/8/8/4K3 b - - 300 70000", -1, Draw},
+	} {
+		board, clocks, err := fen.Parse(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := Entry{Board: board, Halfmove: clocks.Halfmove, Fullmove: clocks.Fullmove, Score: tt.score, Result: tt.result}
+
+		buf := Encode(e)
+		got, err := Decode(buf[:])
+		if err != nil {
+			t.Fatalf("%s: %v", tt.fen, err)
+		}
+
+		if fen.BoardToFEN(got.Board) != fen.BoardToFEN(board) {
+			t.Errorf("%s: decoded %s", tt.fen, fen.BoardToFEN(got.Board))
+		}
+		if got.Board.AllPieces != board.AllPieces || got.Board.WhitePieces != board.WhitePieces ||
+			got.Board.PieceBitboards != board.PieceBitboards {
+			t.Errorf("%s: decoded bitboards differ", tt.fen)
+		}
+		if got.Score != tt.score || got.Result != tt.result {
+			t.Errorf("%s: score %d result %d, want %d %d", tt.fen, got.Score, got.Result, tt.score, tt.result)
+		}
+		if got.Halfmove != min(clocks.Halfmove, 255) || got.Fullmove != min(clocks.Fullmove, 65535) {
+			t.Errorf("%s: clocks %d %d", tt.fen, got.Halfmove, got.Fullmove)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	board, _ := fen.LoadFromFEN(fen.DefaultFEN())
+	buf := Encode(Entry{Board: board, Fullmove: 1, Result: Draw})
+
+	if _, err := Decode(buf[:RecordSize-1]); err == nil {
+		t.Error("decoded a short record")
+	}
+
+	bad := buf
+	bad[26] = 3
+	if _, err := Decode(bad[:]); err == nil {
+		t.Error("decoded result 3")
+	}
+
+	bad = buf
+	bad[8] = 0x07 // a white piece of type 7
+	if _, err := Decode(bad[:]); err == nil {
+		t.Error("decoded piece 7")
+	}
+
+	bad = buf
+	bad[4] = 0xff // eight more on the fifth rank
+	if _, err := Decode(bad[:]); err == nil {
+		t.Error("decoded 40 pieces")
+	}
+}
+
+func TestText(t *testing.T) {
+	for _, tt := range []struct {
+		fen    string
+		score  int16
+		result uint8
+		want   string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", 30, Draw,
+			"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1 | 30 | 0.5"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w Kq - 17 40", -250, BlackWin,
+			"r3k2r/8/8/8/8/8/8/R3K2R w Kq - 17 40 | -250 | 0.0"},
+		{"4k3/8/8/8/8/8/8/4KQ2 b - - 5 60", 900, WhiteWin,
+			"4k3/8/8/8/8/8/8/4KQ2 b - - 5 60 | 900 | 1.0"},
+	} {
+		board, clocks, err := fen.Parse(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := Entry{Board: board, Halfmove: clocks.Halfmove, Fullmove: clocks.Fullmove, Score: tt.score, Result: tt.result}
+		if got := e.Text(); got != tt.want {
+			t.Errorf("got  %q\nwant %q", got, tt.want)
+		}
+	}
+}
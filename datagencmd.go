@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"gochess/datagen"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+func datagenMain(args []string) {
+	if err := runDatagen(args); err != nil {
+		fmt.Fprintln(os.Stderr, "datagen:", err)
+		os.Exit(1)
+	}
+}
+
+func runDatagen(args []string) error {
+	fs := flag.NewFlagSet("datagen", flag.ExitOnError)
+	games := fs.Int("games", 1000, "games to play")
+	threads := fs.Int("threads", runtime.NumCPU(), "games played at once")
+	nodes := fs.Uint64("nodes", 5000, "nodes per move")
+	hash := fs.Int("hash", 16, "transposition table size in MB, for each thread")
+	randomPlies := fs.Int("randomplies", 8, "random moves to start each game with, one more in half the games")
+	openingScore := fs.Int("openingscore", 300, "largest score a random opening may have, 0 for any")
+	seed := fs.Int64("seed", 0, "random seed, the same seed plays the same games; from the clock if 0")
+	binOut := fs.String("bin", "data.bin", "file to append the positions to in the binary format, empty for none")
+	txtOut := fs.String("txt", "data.txt", "file to append the positions to as FEN | score | result lines, empty for none")
+	draw := fs.String("draw", "movenumber=40,movecount=8,score=10", "draw adjudication, movenumber=N,movecount=N,score=CP, empty for none")
+	resign := fs.String("resign", "movecount=4,score=1000", "resign adjudication, movecount=N,score=CP, empty for none")
+	interval := fs.Duration("interval", 10*time.Second, "time between progress reports")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gochess datagen [options]")
+		fmt.Fprintln(os.Stderr, "plays self-play games and writes the quiet positions with their scores and the results")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() > 0 || *games < 1 || *nodes == 0 || *binOut == "" && *txtOut == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	g := &datagen.Generator{
+		Games:           *games,
+		Threads:         *threads,
+		Nodes:           *nodes,
+		Options:         map[string]string{"Hash": strconv.Itoa(*hash)},
+		RandomPlies:     *randomPlies,
+		MaxOpeningScore: *openingScore,
+		Seed:            *seed,
+		Log:             os.Stdout,
+		ReportInterval:  *interval,
+	}
+	if g.Seed == 0 {
+		g.Seed = time.Now().UnixNano()
+		fmt.Printf("seed %d\n", g.Seed)
+	}
+
+	adj := &g.Adjudication
+	if *draw != "" {
+		if err := parseSettings(*draw, map[string]*int{
+			"movenumber": &adj.DrawMoveNumber, "movecount": &adj.DrawMoveCount, "score": &adj.DrawScore,
+		}); err != nil {
+			return fmt.Errorf("-draw: %w", err)
+		}
+		adj.DrawMoveCount = max(adj.DrawMoveCount, 1)
+	}
+	if *resign != "" {
+		if err := parseSettings(*resign, map[string]*int{
+			"movecount": &adj.ResignMoveCount, "score": &adj.ResignScore,
+		}); err != nil {
+			return fmt.Errorf("-resign: %w", err)
+		}
+		adj.ResignMoveCount = max(adj.ResignMoveCount, 1)
+	}
+
+	var outputs []*bufio.Writer
+	for _, out := range []struct {
+		path string
+		dst  *io.Writer
+	}{{*binOut, &g.Binary}, {*txtOut, &g.Text}} {
+		if out.path == "" {
+			continue
+		}
+		f, err := os.OpenFile(out.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w := bufio.NewWriter(f)
+		outputs = append(outputs, w)
+		*out.dst = w
+	}
+
+	_, err := g.Run()
+	for _, w := range outputs {
+		if ferr := w.Flush(); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
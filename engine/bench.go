@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"fmt"
+	"gochess/fen"
+	"io"
+	"time"
+)
+
+const (
+	DefaultBenchDepth = 10
+
+	// the TT size is part of what decides the node count, so it's fixed
+	benchHash = 16
+)
+
+// benchPositions are openings, middlegames and endgames, mostly from the
+// positions other engines bench on.
+var benchPositions = []string{
+	"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 10",
+	"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 11",
+	"4rrk1/pp1n3p/3q2pQ/2p1pb2/2PP4/2P3N1/P2B2PP/4RRK1 b - - 7 19",
+	"rq3rk1/ppp2ppp/1bnpb3/3N2B1/3NP3/7P/PPPQ1PP1/2KR3R w - - 7 14",
+	"r1bq1r1k/1pp1n1pp/1p1p4/4p2Q/4Pp2/1BNP4/PPP2PPP/3R1RK1 w - - 2 14",
+	"r3r1k1/2p2ppp/p1p1bn2/8/1q2P3/2NPQN2/PPP3PP/R4RK1 b - - 2 15",
+	"r1bbk1nr/pp3p1p/2n5/1N4p1/2Np1B2/8/PPP2PPP/2KR1B1R w kq - 0 13",
+	"r1bq1rk1/ppp1nppp/4n3/3p3Q/3P4/1BP1B3/PP1N2PP/R4RK1 w - - 1 16",
+	"4r1k1/r1q2ppp/ppp2n2/4P3/5Rb1/1N1BQ3/PPP3PP/R5K1 w - - 1 17",
+	"2rqkb1r/ppp2p2/2npb1p1/1N1Nn2p/2P1PP2/8/PP2B1PP/R1BQK2R b KQ - 0 11",
+	"r1bq1r1k/b1p1npp1/p2p3p/1p6/3PP3/1B2NN2/PP3PPP/R2Q1RK1 w - - 1 16",
+	"3r1rk1/p5pp/bpp1pp2/8/q1PP1P2/b3P3/P2NQRPP/1R2B1K1 b - - 6 22",
+	"r1q2rk1/2p1bppp/2Pp4/p6b/Q1PNp3/4B3/PP1R1PPP/2K4R w - - 2 18",
+	"4k2r/1pb2ppp/1p2p3/1R1p4/3P4/2r1PN2/P4PPP/1R4K1 b - - 3 22",
+	"3q2k1/pb3p1p/4pbp1/2r5/PpN2N2/1P2P2P/5PP1/Q2R2K1 b - - 4 26",
+	"6k1/6p1/6Pp/ppp5/3pn2P/1P3K2/1PP2P2/3N4 b - - 0 1",
+	"3b4/5kp1/1p1p1p1p/pP1PpP1P/P1P1P3/3KN3/8/8 w - - 0 1",
+	"8/8/8/8/5kp1/P7/8/1K1N4 w - - 0 1",
+	"8/8/3P3k/8/1p6/8/1P6/1K3n2 b - - 0 1",
+}
+
+// Bench searches each bench position to depth, from a cleared engine every
+// time, and writes the node count of each and the total to w. The total is
+// the same on every run of the same code, so it tells whether a change
+// changed what the search does.
+func Bench(w io.Writer, depth int) (nodes uint64, elapsed time.Duration) {
+	e := NewEngine(nil)
+	e.TT = NewTranspositionalTable(benchHash)
+
+	for i, position := range benchPositions {
+		board, err := fen.LoadFromFEN(position)
+		if err != nil {
+			panic(fmt.Sprintf("bench position %d: %v", i+1, err))
+		}
+		e.Board = board
+		e.Clear()
+
+		start := time.Now()
+		e.Analyse(SearchLimits{Depth: depth})
+		elapsed += time.Since(start)
+		nodes += e.NodesSearched
+
+		fmt.Fprintf(w, "Position %2d/%d: %-10d %s\n", i+1, len(benchPositions), e.NodesSearched, position)
+	}
+
+	nps := uint64(0)
+	if ms := elapsed.Milliseconds(); ms > 0 {
+		nps = nodes * 1000 / uint64(ms)
+	}
+	fmt.Fprintln(w, "===========================")
+	fmt.Fprintf(w, "Total time (ms) : %d\n", elapsed.Milliseconds())
+	fmt.Fprintf(w, "Nodes searched  : %d\n", nodes)
+	fmt.Fprintf(w, "Nodes/second    : %d\n", nps)
+	return nodes, elapsed
+}
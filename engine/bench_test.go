@@ -0,0 +1,21 @@
+package engine
+
+import (
+	"io"
+	"testing"
+)
+
+// The bench total is only any use as a signature of the search if two runs
+// of the same code agree on it.
+func TestBenchDeterministic(t *testing.T) {
+	depth := 7
+	if testing.Short() {
+		depth = 4
+	}
+
+	first, _ := Bench(io.Discard, depth)
+	second, _ := Bench(io.Discard, depth)
+	if first == 0 || first != second {
+		t.Errorf("bench to depth %d searched %d nodes, then %d", depth, first, second)
+	}
+}
@@ -1,9 +1,14 @@
 package engine
 
 import (
-	"fmt"
+	"cmp"
+	"gochess/book"
 	"gochess/core"
-	"math"
+	"gochess/syzygy"
+	"gochess/tablebase"
+	"math/rand"
+	"slices"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,10 +21,15 @@ TODO:
 - Implement null move pruning [DONE]
 - Implement late move reductions (LMR) [DONE]
 - Implement time management [DONE]
+- Implement dynamic time budget allocation [DONE]
 - Basic material exchange evaluation [DONE]
 - Implement piece-square-tables [DONE]
 - Implement killer moves [DONE]
 - Implement SEE on quiescence search [DONE]
+- Implement reverse futility, futility, razoring, LMP and SEE pruning [DONE]
+- Implement check and singular extensions [DONE]
+- Implement countermove, continuation and capture history [DONE]
+- Implement staged move picker [DONE]
 
 - Implement passed pawn evaluation
 - Implement king safety evaluation
@@ -27,110 +37,414 @@ TODO:
 - Implement outposts evaluation
 
 - Repetition penalization
-- Implement opening book
-- Implement endgame tablebases
+- Implement opening book [DONE]
+- Implement endgame tablebases [DONE]
 
 - Implement UCI protocol
-- Implement dynamic time budget allocation
 - Build unit tests
 - Measure ELO impact of each feature in isolation
 - Implement multi-threading
 */
 
-const maxDepth = 8
+const (
+	maxDepth = 64
+	maxPly   = 128
+
+	aspirationMinDepth = 4
+	aspirationDelta    = 25
+)
 
 type Engine struct {
-	Board         *core.Board
-	TT            *TranspositionalTable
-	Deadline      time.Time
-	NodesSearched uint64
-	Aborted       bool
-	KillerMoves   [maxDepth + 1][2]core.Move
-	HistoryTable  [64][64]int
+	Board            *core.Board
+	TT               *TranspositionalTable
+	Time             *TimeManager
+	Limits           SearchLimits
+	NodesSearched    uint64
+	Aborted          bool
+	KillerMoves      [maxPly][2]core.Move
+	HistoryTable     [64][64]int
+	CounterMoves     [16][64]core.Move
+	CaptureHistory   [16][64][7]int
+	ContHistory      *ContinuationHistory
+	Eval             Evaluator
+	OnInfo           func(SearchInfo)
+	Skill            Skill
+	Tuning           Tuning
+	Book             *book.Book // played from before searching, if set
+	Tablebases       *tablebase.Tablebases
+	Syzygy           *syzygy.Tablebases
+	SyzygyProbeLimit int // most pieces, kings included, to look up
+	TBHits           uint64
+
+	rootPly   int
+	selDepth  int
+	syzygyOff bool // no probing in the search, see syzygyRoot
+	rootPV    []core.Move
+	pvTable   [maxPly][maxPly]core.Move
+	pvLength  [maxPly]int
+	stack     [maxPly]stackEntry
+	lmr       [maxPly][64]int
+	rng       *rand.Rand
+
+	stopped     atomic.Bool
+	ponderHitAt atomic.Int64
+}
+
+// stackEntry is what the search remembers about each ply of the current line.
+type stackEntry struct {
+	staticEval   int
+	move         core.Move  // the move made from this ply
+	piece        core.Piece // and the piece that made it, PieceNone for a null move
+	excludedMove core.Move  // skipped while testing the TT move for singularity
+	extensions   int        // plies of extension on the line leading here
+}
+
+type SearchLimits struct {
+	Time    TimeControl
+	Depth   int
+	Nodes   uint64
+	MultiPV int
+}
+
+type RootMove struct {
+	Move      core.Move
+	Score     int
+	PrevScore int
+	PV        []core.Move
+}
+
+// SearchInfo is what the search reports about each line it completes.
+type SearchInfo struct {
+	Depth    int
+	SelDepth int
+	MultiPV  int
+	Score    int
+	Bound    Bound
+	Nodes    uint64
+	TBHits   uint64
+	Time     time.Duration
+	PV       []core.Move
 }
 
 func (e *Engine) TimeUp() bool {
-	return time.Now().After(e.Deadline)
+	if e.Time.Pondering() {
+		if at := e.ponderHitAt.Load(); at != 0 {
+			e.Time.PonderHit(time.Unix(0, at))
+			// we may already have spent what the move was worth while pondering
+			if e.Time.ShouldStop() {
+				e.Stop()
+			}
+		}
+	}
+
+	if e.stopped.Load() || e.Time.HardLimitReached() {
+		return true
+	}
+	return e.Limits.Nodes > 0 && e.NodesSearched >= e.Limits.Nodes
+}
+
+// Stop makes a running search return as soon as possible. Safe to call from
+// another goroutine.
+func (e *Engine) Stop() {
+	e.stopped.Store(true)
+}
+
+// PonderHit tells a pondering search that the opponent played the expected
+// move, turning it into a normal timed search. Safe to call from another
+// goroutine.
+func (e *Engine) PonderHit() {
+	e.ponderHitAt.Store(time.Now().UnixNano())
+}
+
+// PV returns the principal variation of the last completed iteration.
+func (e *Engine) PV() []core.Move {
+	return e.rootPV
+}
+
+// PonderMove returns the reply we expect to bestMove, taken from the PV or,
+// when the PV got cut short by a TT hit, from the TT entry after bestMove.
+func (e *Engine) PonderMove(bestMove core.Move) (core.Move, bool) {
+	if len(e.rootPV) >= 2 && e.rootPV[0] == bestMove {
+		return e.rootPV[1], true
+	}
+
+	e.Board.Push(&bestMove)
+	defer e.Board.Pop()
+
+	if hit, entry := e.TT.Probe(e.Board.ComputeZobristHash()); hit && entry.Move != (core.Move{}) {
+		if e.Board.IsMoveLegal(entry.Move) {
+			return entry.Move, true
+		}
+	}
+
+	return core.Move{}, false
 }
 
 func NewEngine(board *core.Board) *Engine {
-	return &Engine{Board: board, TT: NewTranspositionalTable(256)}
+	return &Engine{
+		Board:       board,
+		TT:          NewTranspositionalTable(256),
+		ContHistory: new(ContinuationHistory),
+		Eval:        NewPSTEvaluator(),
+		Skill:       FullStrength(),
+		Tuning:      DefaultTuning(),
+	}
+}
+
+// Clear forgets what earlier searches learned, the TT and the move ordering
+// history, so the next search plays as if it were the engine's first.
+func (e *Engine) Clear() {
+	e.TT.Clear()
+	e.KillerMoves = [maxPly][2]core.Move{}
+	e.HistoryTable = [64][64]int{}
+	e.CounterMoves = [16][64]core.Move{}
+	e.CaptureHistory = [16][64][7]int{}
+	*e.ContHistory = ContinuationHistory{}
 }
 
 func (e *Engine) FindBestMove(timeBudget time.Duration, nmp bool) *core.Move {
-	start := time.Now()
+	return e.Search(SearchLimits{Time: TimeControl{MoveTime: timeBudget}})
+}
 
-	e.Deadline = start.Add(timeBudget)
-	e.NodesSearched = 0
+func (e *Engine) Search(limits SearchLimits) *core.Move {
+	if e.Book != nil {
+		if move, ok := e.Book.Probe(e.Board); ok {
+			return &move
+		}
+	}
+
+	if e.Skill.Enabled() {
+		return e.searchWeakened(limits)
+	}
+
+	lines := e.Analyse(limits)
+	if len(lines) == 0 {
+		return nil
+	}
+	return &lines[0].Move
+}
+
+// Analyse runs the iterative deepening search and returns the best
+// limits.MultiPV root moves of the last completed iteration, best first.
+func (e *Engine) Analyse(limits SearchLimits) []RootMove {
+	e.startSearch(limits)
+	defer e.finishSearch()
 
 	moves := e.Board.GenerateLegalMoves()
 	if len(moves) == 0 {
 		return nil
-	} else if len(moves) == 1 {
-		return &moves[0] // I mean, no point in searching if there's only one move
+	}
+
+	// nothing to search for when the tables know every move's outcome, and
+	// the Syzygy ones can at least take out the moves that throw it away
+	if lines, ok := e.tablebaseRoot(moves, limits.MultiPV); ok {
+		return lines
+	}
+	tbLines, moves, ok := e.syzygyRoot(moves, limits.MultiPV)
+	if ok {
+		return tbLines
 	}
 
 	e.OrderMoves(moves, 0)
 
-	var bestMove core.Move = moves[0]
-	var bestValue int
-	depthReached := 0
+	rootMoves := make([]RootMove, len(moves))
+	for i, move := range moves {
+		rootMoves[i] = RootMove{Move: move, Score: -Infinity, PrevScore: -Infinity, PV: []core.Move{move}}
+	}
+
+	multiPV := min(max(limits.MultiPV, 1), len(rootMoves))
+	lines := slices.Clone(rootMoves[:multiPV])
+	e.rootPV = lines[0].PV
+
+	if len(moves) == 1 && !limits.Time.Infinite {
+		return lines // I mean, no point in searching if there's only one move
+	}
 
-	for depth := 1; depth <= maxDepth; depth++ {
-		if e.TimeUp() {
+	depthLimit := maxDepth
+	if limits.Depth > 0 {
+		depthLimit = min(limits.Depth, maxDepth)
+	}
+
+	for depth := 1; depth <= depthLimit; depth++ {
+		if depth > 1 && (e.TimeUp() || e.Time.ShouldStop()) {
 			break
 		}
 
-		currentBestMove := moves[0]
-		currentBestValue := math.MinInt
-		completedSearch := true
-
-		for _, move := range moves {
-			e.Board.Push(&move)
-			e.Aborted = false
-			moveValue := -e.negamax(depth-1, math.MinInt, math.MaxInt, depth)
-			e.Board.Pop()
+		e.selDepth = 0
+		for i := range rootMoves {
+			rootMoves[i].PrevScore = rootMoves[i].Score
+		}
 
-			if e.Aborted {
+		completedSearch := true
+		for pvIdx := range multiPV {
+			if !e.aspirationSearch(rootMoves, depth, pvIdx, multiPV == 1) {
 				completedSearch = false
 				break // Do not use a partially searched path
 			}
-
-			if moveValue > currentBestValue {
-				currentBestValue = moveValue
-				currentBestMove = move
-			}
-
-			if currentBestValue >= MateThreshold {
-				break
-			}
+			e.report(depth, pvIdx, rootMoves[pvIdx], FlagExact)
 		}
 
 		if !completedSearch {
 			break
 		}
 
-		bestMove = currentBestMove
-		bestValue = currentBestValue
-		depthReached = depth
+		lines = slices.Clone(rootMoves[:multiPV])
+		e.rootPV = lines[0].PV
+		e.Time.Update(lines[0].Move, lines[0].Score)
+
+		// once the mate is no further off than the depth searched, nothing
+		// shorter is left to find; a longer one can still get shorter
+		if multiPV == 1 && lines[0].Score >= MateThreshold && MateScore-lines[0].Score <= depth &&
+			!limits.Time.Infinite && limits.Depth == 0 {
+			break
+		}
+	}
+
+	return lines
+}
+
+func (e *Engine) startSearch(limits SearchLimits) {
+	e.Limits = limits
+	e.Time = NewTimeManager(limits.Time, time.Now())
+	e.NodesSearched = 0
+	e.TBHits = 0
+	e.syzygyOff = false
+	e.Eval.Reset(e.Board)
+	e.rootPly = e.Board.Ply
+	e.rootPV = nil
+	e.stack = [maxPly]stackEntry{}
+	e.lmr = e.Tuning.reductionTable()
+}
+
+// finishSearch clears the signals other goroutines may have sent during the
+// search. They're deliberately not cleared at the start, a stop that arrives
+// before the search gets going must still be honoured.
+func (e *Engine) finishSearch() {
+	e.ClearSignals()
+}
+
+// ClearSignals forgets a Stop or PonderHit that came in after the search it
+// was meant for had already returned, so it can't cut the next search short.
+// Only call it while no search is running.
+func (e *Engine) ClearSignals() {
+	e.stopped.Store(false)
+	e.ponderHitAt.Store(0)
+}
+
+// aspirationSearch searches line pvIdx in a narrow window around the score it
+// had last iteration, widening the window on the side it fails on until the
+// score lands inside. Returns false if the search was aborted.
+func (e *Engine) aspirationSearch(rootMoves []RootMove, depth, pvIdx int, stopAtMate bool) bool {
+	alpha, beta := -Infinity, Infinity
+	delta := aspirationDelta
+
+	prev := rootMoves[pvIdx].PrevScore
+	if depth >= aspirationMinDepth && prev > -MateThreshold && prev < MateThreshold {
+		alpha = max(prev-delta, -Infinity)
+		beta = min(prev+delta, Infinity)
+	}
 
-		for i, m := range moves {
-			if m == bestMove {
-				moves[0], moves[i] = moves[i], moves[0]
-				break
+	for {
+		score, ok := e.searchRoot(rootMoves, depth, pvIdx, alpha, beta, stopAtMate)
+		if !ok {
+			return false
+		}
+
+		// the best of the moves not yet reported becomes line pvIdx
+		slices.SortStableFunc(rootMoves[pvIdx:], func(a, b RootMove) int {
+			return cmp.Compare(b.Score, a.Score)
+		})
+
+		switch {
+		case score <= alpha:
+			e.report(depth, pvIdx, rootMoves[pvIdx], FlagUpper)
+			beta = (alpha + beta) / 2
+			alpha = max(score-delta, -Infinity)
+		case score >= beta:
+			e.report(depth, pvIdx, rootMoves[pvIdx], FlagLower)
+			beta = min(score+delta, Infinity)
+		default:
+			return true
+		}
+
+		delta += delta / 2
+	}
+}
+
+// searchRoot finds the best of rootMoves[pvIdx:] within (alpha, beta),
+// leaving scores on moves that raised alpha and -Infinity on the rest. The
+// result is fail-soft: the best score found, even outside the window.
+func (e *Engine) searchRoot(rootMoves []RootMove, depth, pvIdx, alpha, beta int, stopAtMate bool) (int, bool) {
+	bestScore := -Infinity
+	e.pvLength[0] = 0
+
+	for i := pvIdx; i < len(rootMoves); i++ {
+		rm := &rootMoves[i]
+
+		e.makeMove(rm.Move)
+		e.Aborted = false
+		var score int
+		if i == pvIdx {
+			score = -e.negamax(depth-1, -beta, -alpha, depth)
+		} else {
+			score = -e.negamax(depth-1, -alpha-1, -alpha, depth)
+			if score > alpha && score < beta && !e.Aborted {
+				score = -e.negamax(depth-1, -beta, -alpha, depth)
 			}
 		}
+		e.unmakeMove()
+
+		if e.Aborted {
+			return 0, false
+		}
+
+		if i == pvIdx || score > alpha {
+			e.updatePV(0, rm.Move)
+			rm.Score = score
+			rm.PV = slices.Clone(e.pvTable[0][:e.pvLength[0]])
+		} else {
+			rm.Score = -Infinity
+		}
+
+		bestScore = max(bestScore, score)
+		if score >= beta {
+			break
+		}
+		alpha = max(alpha, score)
+
+		if stopAtMate && alpha >= MateThreshold {
+			break
+		}
+	}
+
+	return bestScore, true
+}
+
+func (e *Engine) report(depth, pvIdx int, rm RootMove, bound Bound) {
+	if e.OnInfo == nil {
+		return
 	}
 
-	elapsed := time.Since(start)
-	fmt.Printf("Best move: %v, depth: %d, nodes searched: %d at depth %d, Time taken: %s\n", bestMove, bestValue, e.NodesSearched, depthReached, elapsed)
+	e.OnInfo(SearchInfo{
+		Depth:    depth,
+		SelDepth: e.selDepth,
+		MultiPV:  pvIdx + 1,
+		Score:    rm.Score,
+		Bound:    bound,
+		Nodes:    e.NodesSearched,
+		TBHits:   e.TBHits,
+		Time:     e.Time.Elapsed(),
+		PV:       rm.PV,
+	})
+}
 
-	return &bestMove
+func (e *Engine) isKiller(move core.Move, ply int) bool {
+	return move == e.KillerMoves[ply][0] || move == e.KillerMoves[ply][1]
 }
 
-func (e *Engine) addKillerMove(move core.Move, depth int) {
-	if e.KillerMoves[depth][0] != move {
-		e.KillerMoves[depth][1] = e.KillerMoves[depth][0]
-		e.KillerMoves[depth][0] = move
+func (e *Engine) addKillerMove(move core.Move, ply int) {
+	if e.KillerMoves[ply][0] != move {
+		e.KillerMoves[ply][1] = e.KillerMoves[ply][0]
+		e.KillerMoves[ply][0] = move
 	}
 }
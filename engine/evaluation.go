@@ -10,7 +10,7 @@ const (
 	PhaseEndgame
 )
 
-var phaseWeights = map[uint8]int{
+var phaseWeights = [7]int{
 	core.PieceTypeKnight: 1,
 	core.PieceTypeBishop: 1,
 	core.PieceTypeRook:   2,
@@ -22,40 +22,113 @@ const maxPhaseScore = 24
 type Phase int
 type PST [64]int
 
-func (e *Engine) Evaluate() int {
-	score := 0
-	mask := e.Board.AllPieces
+// PSTEvaluator is the material + piece-square-table evaluation. Everything
+// except the kings is kept incrementally; the king tables depend on the game
+// phase so they're looked up at evaluation time.
+type PSTEvaluator struct {
+	stack []pstState
+}
 
-	phase := determinePhase(e.Board)
+type pstState struct {
+	score      int // white's point of view, kings excluded
+	phaseScore int
+}
 
-	for mask != 0 {
-		lsb := core.Position(mask.PopLSB())
-		piece := e.Board.Pieces[lsb]
-		value := e.PieceValue(piece)
-		value += pstValue(piece, lsb, phase)
-		if piece.Color() == core.PieceColorWhite {
-			score += value
-		} else {
-			score -= value
+func NewPSTEvaluator() *PSTEvaluator {
+	return &PSTEvaluator{stack: make([]pstState, 1, 64)}
+}
+
+func (ev *PSTEvaluator) Reset(b *core.Board) {
+	var st pstState
+	for mask := b.AllPieces; mask != 0; {
+		sq := core.Position(mask.PopLSB())
+		piece := b.Pieces[sq]
+		if piece.Type() == core.PieceTypeKing {
+			continue
+		}
+		st.score += pieceScore(piece, sq)
+		st.phaseScore += phaseWeights[piece.Type()]
+	}
+	ev.stack = append(ev.stack[:0], st)
+}
+
+func (ev *PSTEvaluator) MakeMove(b *core.Board, move core.Move) {
+	st := ev.stack[len(ev.stack)-1]
+	last := b.LastMove()
+
+	moved := b.Pieces[move.To]
+	if move.Promotion != core.PieceNone {
+		moved = core.Piece(move.Promotion.Color() | core.PieceTypePawn)
+	}
+
+	if moved.Type() != core.PieceTypeKing {
+		st.score -= pieceScore(moved, move.From)
+		st.score += pieceScore(b.Pieces[move.To], move.To)
+		if move.Promotion != core.PieceNone {
+			st.phaseScore += phaseWeights[move.Promotion.Type()]
+		}
+	} else if d := int(move.To) - int(move.From); d == 2 || d == -2 {
+		// castling, the rook moved as well
+		rookFrom, rookTo := move.From+3, move.From+1
+		if d < 0 {
+			rookFrom, rookTo = move.From-4, move.From-1
+		}
+		rook := b.Pieces[rookTo]
+		st.score -= pieceScore(rook, rookFrom)
+		st.score += pieceScore(rook, rookTo)
+	}
+
+	if last.Captured != core.PieceNone {
+		capSq := move.To
+		if last.IsEnPassant {
+			if moved.Color() == core.PieceColorWhite {
+				capSq -= 8
+			} else {
+				capSq += 8
+			}
 		}
+		st.score -= pieceScore(last.Captured, capSq)
+		st.phaseScore -= phaseWeights[last.Captured.Type()]
+	}
+
+	ev.stack = append(ev.stack, st)
+}
+
+func (ev *PSTEvaluator) UnmakeMove(b *core.Board) {
+	if len(ev.stack) > 1 {
+		ev.stack = ev.stack[:len(ev.stack)-1]
+	}
+}
+
+func (ev *PSTEvaluator) Evaluate(b *core.Board) int {
+	st := ev.stack[len(ev.stack)-1]
+	phase := phaseFromScore(st.phaseScore)
+
+	score := st.score
+	if sq := b.KingSquare(true); sq < 64 {
+		score += pstValue(core.PieceWhiteKing, sq, phase)
+	}
+	if sq := b.KingSquare(false); sq < 64 {
+		score -= pstValue(core.PieceBlackKing, sq, phase)
 	}
 
-	if e.Board.WhiteToMove {
+	if b.WhiteToMove {
 		return score
 	} else {
 		return -score
 	}
 }
 
-func determinePhase(b *core.Board) Phase {
-	score := 0
-	for sq := range 64 {
-		piece := b.Pieces[sq]
-		pt := piece.Type()
-		if w, ok := phaseWeights[pt]; ok {
-			score += w
-		}
+// pieceScore is the signed material + PST contribution of a non-king piece.
+func pieceScore(piece core.Piece, sq core.Position) int {
+	value := pieceValue(piece) + pstValue(piece, sq, PhaseMiddlegame)
+	if piece.Color() == core.PieceColorWhite {
+		return value
 	}
+	return -value
+}
+
+func phaseFromScore(score int) Phase {
 	switch {
 	case score > maxPhaseScore*2/3:
 		return PhaseOpening
@@ -103,6 +176,10 @@ func pstValue(piece core.Piece, sq core.Position, phase Phase) int {
 }
 
 func (e *Engine) PieceValue(piece core.Piece) int {
+	return pieceValue(piece)
+}
+
+func pieceValue(piece core.Piece) int {
 	type_ := piece.Type()
 	switch type_ {
 	case core.PieceTypeNone:
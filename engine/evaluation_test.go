@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"gochess/fen"
+	"testing"
+)
+
+// The incremental updates have to land where a Reset from scratch would, for
+// every kind of move: captures, en passant, castling and promotions.
+func TestPSTEvaluatorIncremental(t *testing.T) {
+	for _, position := range []string{
+		fen.DefaultFEN(),
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+	} {
+		b := load(t, position)
+		ev := NewPSTEvaluator()
+		ev.Reset(b)
+		fresh := NewPSTEvaluator()
+
+		var walk func(depth int)
+		walk = func(depth int) {
+			fresh.Reset(b)
+			if got, want := ev.stack[len(ev.stack)-1], fresh.stack[0]; got != want {
+				t.Fatalf("%s: incremental %+v, reset %+v", fen.BoardToFEN(b), got, want)
+			}
+			if got, want := ev.Evaluate(b), fresh.Evaluate(b); got != want {
+				t.Fatalf("%s: evaluates to %d, %d after a reset", fen.BoardToFEN(b), got, want)
+			}
+			if depth == 0 {
+				return
+			}
+
+			for _, move := range b.GenerateLegalMoves() {
+				before := ev.Evaluate(b)
+				b.Push(&move)
+				ev.MakeMove(b, move)
+				walk(depth - 1)
+				b.Pop()
+				ev.UnmakeMove(b)
+				if after := ev.Evaluate(b); after != before {
+					t.Fatalf("%s: %d before %s, %d after taking it back", fen.BoardToFEN(b), before, b.ToAlgebraNotation(move), after)
+				}
+			}
+		}
+		walk(3)
+	}
+}
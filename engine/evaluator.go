@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"gochess/core"
+	"slices"
+)
+
+// Evaluator scores positions for the search. The engine calls MakeMove right
+// after a move is pushed onto the board and UnmakeMove right after it is
+// popped, so implementations can keep incremental state instead of rescanning
+// the board on every call.
+type Evaluator interface {
+	Reset(b *core.Board)
+	MakeMove(b *core.Board, move core.Move)
+	UnmakeMove(b *core.Board)
+
+	// Evaluate returns the score from the side to move's point of view.
+	Evaluate(b *core.Board) int
+}
+
+const DefaultEvaluator = "pst"
+
+var evaluators = map[string]func() Evaluator{
+	"pst": func() Evaluator { return NewPSTEvaluator() },
+}
+
+func NewEvaluator(name string) (Evaluator, bool) {
+	ctor, ok := evaluators[name]
+	if !ok {
+		return nil, false
+	}
+	return ctor(), true
+}
+
+func EvaluatorNames() []string {
+	names := make([]string, 0, len(evaluators))
+	for name := range evaluators {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (e *Engine) Evaluate() int {
+	return e.Eval.Evaluate(e.Board)
+}
+
+func (e *Engine) makeMove(move core.Move) {
+	if ply := e.ply(); ply < maxPly {
+		e.stack[ply].move = move
+		e.stack[ply].piece = e.Board.Pieces[move.From]
+	}
+	e.Board.Push(&move)
+	e.Eval.MakeMove(e.Board, move)
+}
+
+func (e *Engine) unmakeMove() {
+	e.Board.Pop()
+	e.Eval.UnmakeMove(e.Board)
+}
+
+// makeNullMove passes the turn, returning the en passant target it cleared.
+func (e *Engine) makeNullMove() core.Position {
+	if ply := e.ply(); ply < maxPly {
+		e.stack[ply].move = core.Move{}
+		e.stack[ply].piece = core.PieceNone
+	}
+	enPassant := e.Board.EnPassantTarget
+	e.Board.EnPassantTarget = 64
+	e.Board.WhiteToMove = !e.Board.WhiteToMove
+	e.Board.Ply++
+	return enPassant
+}
+
+func (e *Engine) unmakeNullMove(enPassant core.Position) {
+	e.Board.Ply--
+	e.Board.WhiteToMove = !e.Board.WhiteToMove
+	e.Board.EnPassantTarget = enPassant
+}
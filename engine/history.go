@@ -0,0 +1,126 @@
+package engine
+
+import "gochess/core"
+
+// maxHistory bounds every history table. Updates use the "gravity" formula,
+// which shrinks a bonus the closer the entry already is to the bound, so
+// entries saturate smoothly instead of growing forever and old information
+// fades as new cutoffs come in.
+const maxHistory = 16384
+
+// ContinuationHistory scores a quiet move by how well it did as a reply to an
+// earlier move, indexed by [piece][to] of the earlier move and [piece][to] of
+// the reply. The same table serves one-ply (reply to the opponent's move) and
+// two-ply (follow-up to our own previous move) lookups.
+type ContinuationHistory [16][64][16][64]int16
+
+func historyBonus(depth int) int {
+	return min(32*depth*depth+64*depth, 1536)
+}
+
+func applyGravity(entry *int, bonus int) {
+	*entry += bonus - *entry*abs(bonus)/maxHistory
+}
+
+func applyGravity16(entry *int16, bonus int) {
+	v := int(*entry)
+	*entry = int16(v + bonus - v*abs(bonus)/maxHistory)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// capturedType is the type of piece move takes, PieceTypeNone for quiets.
+func (e *Engine) capturedType(move core.Move) uint8 {
+	if victim := e.Board.Pieces[move.To]; victim != core.PieceNone {
+		return victim.Type()
+	}
+	if move.To == e.Board.EnPassantTarget && e.Board.Pieces[move.From].Type() == core.PieceTypePawn {
+		return core.PieceTypePawn
+	}
+	return core.PieceTypeNone
+}
+
+// continuation returns the continuation history for replies to the move made
+// back plies before ply, nil if there isn't one (root or null move).
+func (e *Engine) continuation(ply, back int) *[16][64]int16 {
+	if ply < back {
+		return nil
+	}
+	prev := e.stack[ply-back]
+	if prev.piece == core.PieceNone {
+		return nil
+	}
+	return &e.ContHistory[prev.piece][prev.move.To]
+}
+
+// counterMove is the move that last refuted the opponent's previous move.
+func (e *Engine) counterMove(ply int) core.Move {
+	if ply < 1 || e.stack[ply-1].piece == core.PieceNone {
+		return core.Move{}
+	}
+	prev := e.stack[ply-1]
+	return e.CounterMoves[prev.piece][prev.move.To]
+}
+
+// quietHistory is the combined butterfly and continuation history of a quiet move.
+func (e *Engine) quietHistory(move core.Move, ply int) int {
+	score := e.HistoryTable[move.From][move.To]
+	piece := e.Board.Pieces[move.From]
+	if cont := e.continuation(ply, 1); cont != nil {
+		score += int(cont[piece][move.To])
+	}
+	if cont := e.continuation(ply, 2); cont != nil {
+		score += int(cont[piece][move.To])
+	}
+	return score
+}
+
+func (e *Engine) captureHistory(move core.Move) int {
+	return e.CaptureHistory[e.Board.Pieces[move.From]][move.To][e.capturedType(move)]
+}
+
+func (e *Engine) updateQuietHistory(move core.Move, ply, bonus int) {
+	applyGravity(&e.HistoryTable[move.From][move.To], bonus)
+	piece := e.Board.Pieces[move.From]
+	if cont := e.continuation(ply, 1); cont != nil {
+		applyGravity16(&cont[piece][move.To], bonus)
+	}
+	if cont := e.continuation(ply, 2); cont != nil {
+		applyGravity16(&cont[piece][move.To], bonus)
+	}
+}
+
+func (e *Engine) updateCaptureHistory(move core.Move, bonus int) {
+	applyGravity(&e.CaptureHistory[e.Board.Pieces[move.From]][move.To][e.capturedType(move)], bonus)
+}
+
+// updateHistories rewards best for causing a beta cutoff at ply, and
+// punishes the moves of the same kind that were tried before it and didn't.
+// Captures that failed are punished whatever best was.
+func (e *Engine) updateHistories(ply, depth int, best core.Move, quiets, captures []core.Move) {
+	bonus := historyBonus(depth)
+
+	if e.capturedType(best) == core.PieceTypeNone && best.Promotion == core.PieceNone {
+		e.addKillerMove(best, ply)
+		if ply >= 1 && e.stack[ply-1].piece != core.PieceNone {
+			prev := e.stack[ply-1]
+			e.CounterMoves[prev.piece][prev.move.To] = best
+		}
+
+		e.updateQuietHistory(best, ply, bonus)
+		for _, move := range quiets {
+			e.updateQuietHistory(move, ply, -bonus)
+		}
+	} else {
+		e.updateCaptureHistory(best, bonus)
+	}
+
+	for _, move := range captures {
+		e.updateCaptureHistory(move, -bonus)
+	}
+}
@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"gochess/core"
+)
+
+// MateResult is the outcome of a mate search. Moves is the length of the
+// forced mate in moves of the attacking side, PV the full mating line with the
+// defence holding out the longest.
+type MateResult struct {
+	Found   bool
+	Aborted bool
+	Moves   int
+	PV      []core.Move
+}
+
+// mateEntry caches what we know about an attacker-to-move position: it's
+// mated within proven moves, and definitely not within disproven moves.
+type mateEntry struct {
+	proven    int
+	disproven int
+}
+
+type mateSearch struct {
+	e     *Engine
+	cache map[uint64]mateEntry
+}
+
+// SearchMate tries to prove a forced mate in at most n moves for the side to
+// move. It searches every attacking move and every defence, so when nothing
+// is found (and the search wasn't aborted) there is no such mate.
+func (e *Engine) SearchMate(n int, limits SearchLimits) MateResult {
+	e.startSearch(limits)
+	defer e.finishSearch()
+	e.Aborted = false
+
+	ms := &mateSearch{e: e, cache: make(map[uint64]mateEntry)}
+
+	for moves := 1; moves <= n; moves++ {
+		found := ms.attack(moves)
+		if e.Aborted {
+			return MateResult{Aborted: true}
+		}
+		if !found {
+			continue
+		}
+
+		pv := ms.line(moves, nil)
+		e.rootPV = pv
+		if e.OnInfo != nil {
+			e.OnInfo(SearchInfo{
+				Depth:   2*moves - 1,
+				MultiPV: 1,
+				Score:   MateScore - (2*moves - 1),
+				Bound:   FlagExact,
+				Nodes:   e.NodesSearched,
+				Time:    e.Time.Elapsed(),
+				PV:      pv,
+			})
+		}
+		return MateResult{Found: true, Moves: moves, PV: pv}
+	}
+
+	return MateResult{}
+}
+
+// attack reports whether the side to move mates within the given number of
+// moves.
+func (ms *mateSearch) attack(moves int) bool {
+	e := ms.e
+	e.NodesSearched++
+	if e.Aborted || (e.NodesSearched%2048 == 0 && e.TimeUp()) {
+		e.Aborted = true
+		return false
+	}
+
+	key := e.Board.ComputeZobristHash()
+	entry := ms.cache[key]
+	if entry.proven != 0 && entry.proven <= moves {
+		return true
+	}
+	if entry.disproven >= moves {
+		return false
+	}
+
+	var buf [core.MaxMoves]core.Move
+	for _, move := range ms.attackingMoves(moves, &buf) {
+		e.Board.Push(&move)
+		mated := ms.defend(moves)
+		e.Board.Pop()
+
+		if e.Aborted {
+			return false
+		}
+		if mated {
+			entry = ms.cache[key]
+			if entry.proven == 0 || moves < entry.proven {
+				entry.proven = moves
+			}
+			ms.cache[key] = entry
+			return true
+		}
+	}
+
+	entry = ms.cache[key]
+	entry.disproven = max(entry.disproven, moves)
+	ms.cache[key] = entry
+	return false
+}
+
+// defend reports whether the side to move, having just been attacked, gets
+// mated with the attacker having moves-1 moves left after this one.
+func (ms *mateSearch) defend(moves int) bool {
+	e := ms.e
+	board := e.Board
+
+	var buf [core.MaxMoves]core.Move
+	replies := board.GenerateLegalMovesInto(&buf)
+	if len(replies) == 0 {
+		return board.InCheck(board.WhiteToMove)
+	}
+	if moves == 1 {
+		return false
+	}
+
+	for _, reply := range replies {
+		board.Push(&reply)
+		mated := ms.attack(moves - 1)
+		board.Pop()
+
+		if !mated {
+			return false
+		}
+	}
+
+	return true
+}
+
+// attackingMoves orders checks first, then captures. With a single move left
+// only a check can possibly mate, so that's all we try. The moves are
+// written to buf.
+func (ms *mateSearch) attackingMoves(moves int, buf *[core.MaxMoves]core.Move) []core.Move {
+	board := ms.e.Board
+
+	var all [core.MaxMoves]core.Move
+	var rank [core.MaxMoves]int // 0 check, 1 capture, 2 quiet, 3 skipped
+	legal := board.GenerateLegalMovesInto(&all)
+	for i, move := range legal {
+		isCapture := (move.To == board.EnPassantTarget) || ((1<<move.To)&board.AllPieces) != 0
+
+		board.Push(&move)
+		givesCheck := board.InCheck(board.WhiteToMove)
+		board.Pop()
+
+		switch {
+		case givesCheck:
+			rank[i] = 0
+		case moves == 1:
+			rank[i] = 3
+		case isCapture:
+			rank[i] = 1
+		default:
+			rank[i] = 2
+		}
+	}
+
+	ordered := buf[:0]
+	for r := range 3 {
+		for i, move := range legal {
+			if rank[i] == r {
+				ordered = append(ordered, move)
+			}
+		}
+	}
+	return ordered
+}
+
+// line rebuilds the mating line for a position proven to be mate in moves:
+// the quickest mate for the attacker, the longest defence for the defender.
+func (ms *mateSearch) line(moves int, pv []core.Move) []core.Move {
+	board := ms.e.Board
+
+	var buf [core.MaxMoves]core.Move
+	for _, move := range ms.attackingMoves(moves, &buf) {
+		board.Push(&move)
+		if !ms.defend(moves) {
+			board.Pop()
+			continue
+		}
+
+		pv = append(pv, move)
+
+		var longest core.Move
+		longestMoves := 0
+		var replies [core.MaxMoves]core.Move
+		for _, reply := range board.GenerateLegalMovesInto(&replies) {
+			board.Push(&reply)
+			for m := 1; m < moves; m++ {
+				if ms.attack(m) {
+					if m > longestMoves {
+						longest, longestMoves = reply, m
+					}
+					break
+				}
+			}
+			board.Pop()
+		}
+
+		if longestMoves > 0 {
+			pv = append(pv, longest)
+			board.Push(&longest)
+			pv = ms.line(longestMoves, pv)
+			board.Pop()
+		}
+
+		board.Pop()
+		return pv
+	}
+
+	return pv
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"gochess/fen"
+	"slices"
+	"testing"
+)
+
+func TestSearchMate(t *testing.T) {
+	for _, tt := range []struct {
+		fen   string
+		moves int
+		pv    []string // the whole line where the defence is forced, else the key move
+	}{
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", 1, []string{"a1a8"}},
+		{"r1b2k1r/ppp1bppp/8/1B1Q4/5q2/2P5/PPP2PPP/R3R1K1 w - - 1 1", 2, []string{"d5d8", "e7d8", "e1e8"}},
+		{"r2qkb1r/pp2nppp/3p4/2pNN1B1/2BnP3/3P4/PPP2PPP/R2bK2R w KQkq - 1 1", 2, []string{"d5f6", "g7f6", "c4f7"}},
+		{"2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - 0 1", 2, []string{"g3g6"}},
+		{"1k5r/pP3ppp/3p2b1/1BN1n3/1Q2P3/P1B5/KP3P1P/7q w - - 1 1", 3, []string{"c5a6"}},
+		{"r1bqr3/ppp1B1kp/1b4p1/n2B4/3PQ1P1/2P5/P4P2/RN4K1 w - - 1 1", 4, []string{"e4e5"}},
+	} {
+		b := load(t, tt.fen)
+		e := NewEngine(b)
+		r := e.SearchMate(5, SearchLimits{})
+		if !r.Found || r.Aborted || r.Moves != tt.moves {
+			t.Errorf("%s: found %v aborted %v in %d, want mate in %d", tt.fen, r.Found, r.Aborted, r.Moves, tt.moves)
+			continue
+		}
+		if len(r.PV) != 2*tt.moves-1 {
+			t.Errorf("%s: PV of %d plies for a mate in %d", tt.fen, len(r.PV), tt.moves)
+			continue
+		}
+
+		var line []string
+		for _, move := range r.PV {
+			if !slices.Contains(b.GenerateLegalMoves(), move) {
+				t.Fatalf("%s: %s in the PV isn't legal", tt.fen, b.ToAlgebraNotation(move))
+			}
+			line = append(line, b.ToAlgebraNotation(move))
+			b.Push(&move)
+		}
+		if !slices.Equal(line[:len(tt.pv)], tt.pv) {
+			t.Errorf("%s: PV %v, want it to start %v", tt.fen, line, tt.pv)
+		}
+		if !b.InCheck(b.WhiteToMove) || len(b.GenerateLegalMoves()) != 0 {
+			t.Errorf("%s: PV %v doesn't end in mate", tt.fen, line)
+		}
+	}
+}
+
+// Not finding a mate that's further away than n, or that isn't there at
+// all, is a proper answer and not an aborted search.
+func TestSearchMateNotFound(t *testing.T) {
+	for _, tt := range []struct {
+		fen string
+		n   int
+	}{
+		{"r1b2k1r/ppp1bppp/8/1B1Q4/5q2/2P5/PPP2PPP/R3R1K1 w - - 1 1", 1},
+		{"1k5r/pP3ppp/3p2b1/1BN1n3/1Q2P3/P1B5/KP3P1P/7q w - - 1 1", 2},
+		{"r1bqr3/ppp1B1kp/1b4p1/n2B4/3PQ1P1/2P5/P4P2/RN4K1 w - - 1 1", 3},
+		{fen.DefaultFEN(), 3},
+		// the side to move is the one getting mated
+		{"6k1/5ppp/8/8/8/8/8/R5K1 b - - 0 1", 2},
+	} {
+		e := NewEngine(load(t, tt.fen))
+		if r := e.SearchMate(tt.n, SearchLimits{}); r.Found || r.Aborted || len(r.PV) != 0 {
+			t.Errorf("%s: mate in %d found %v aborted %v PV %v", tt.fen, tt.n, r.Found, r.Aborted, r.PV)
+		}
+	}
+}
@@ -37,119 +37,34 @@ func (e *Engine) MVVLVA(move core.Move) (score int) {
 	return score
 }
 
-func (e *Engine) OrderMovesQ(moves []core.Move, depth int) {
+func (e *Engine) OrderMovesQ(moves []core.Move) {
 	slices.SortStableFunc(moves, func(a, b core.Move) int {
-		scoreA := e.SEE(a) + e.killerHistoryScore(a, depth)
-		scoreB := e.SEE(b) + e.killerHistoryScore(b, depth)
-		return scoreB - scoreA // Descending order
+		return e.SEE(b) - e.SEE(a) // Descending order
 	})
 }
 
-func (e *Engine) OrderMoves(moves []core.Move, depth int) {
+func (e *Engine) OrderMoves(moves []core.Move, ply int) {
+	counter := e.counterMove(ply)
 	slices.SortStableFunc(moves, func(a, b core.Move) int {
-		scoreA := e.MVVLVA(a) + e.killerHistoryScore(a, depth)
-		scoreB := e.MVVLVA(b) + e.killerHistoryScore(b, depth)
-		return scoreB - scoreA // Descending order
+		return e.moveScore(b, ply, counter) - e.moveScore(a, ply, counter) // Descending order
 	})
 }
 
-func (e *Engine) killerHistoryScore(move core.Move, depth int) int {
-	if move == e.KillerMoves[depth][0] {
-		return 100_000
+// moveScore ranks captures and promotions first, then killers and the
+// countermove, then the remaining quiets by history.
+func (e *Engine) moveScore(move core.Move, ply int, counter core.Move) int {
+	if e.capturedType(move) != core.PieceTypeNone || move.Promotion != core.PieceNone {
+		return 1_000_000 + 16*e.MVVLVA(move) + e.captureHistory(move)
 	}
 
-	if move == e.KillerMoves[depth][1] {
-		return 80_000
+	switch {
+	case move == e.KillerMoves[ply][0]:
+		return 200_000
+	case move == e.KillerMoves[ply][1]:
+		return 190_000
+	case move == counter:
+		return 180_000
 	}
 
-	isCapture := (move.To == e.Board.EnPassantTarget) || ((1<<move.To)&e.Board.AllPieces) != 0
-	if !isCapture {
-		return e.HistoryTable[move.From][move.To]
-	}
-
-	return 0
+	return e.quietHistory(move, ply)
 }
-
-func (e *Engine) SEE(move core.Move) int {
-	from := move.From
-	to := move.To
-
-	board := e.Board
-	attackerIsWhite := (board.Pieces[from] & core.PieceColorMask) == core.PieceColorWhite
-	attackers := make([]int, 0)
-	defenders := make([]int, 0)
-	attackersBB := board.GetAttackingBitboard(to, attackerIsWhite)
-	defendersBB := board.GetAttackingBitboard(to, !attackerIsWhite)
-	for sq := range 64 {
-		if (attackersBB>>sq)&1 != 0 {
-			attackers = append(attackers, sq)
-		}
-		if (defendersBB>>sq)&1 != 0 {
-			defenders = append(defenders, sq)
-		}
-	}
-
-	victim := board.Pieces[to]
-	gains := []int{e.PieceValue(victim)}
-	turn := attackerIsWhite
-
-	for {
-		var next int
-		var nextVal int
-		if turn == attackerIsWhite {
-			if len(attackers) == 0 {
-				break
-			}
-			next = e.leastValuablePiece(board, attackers)
-			nextVal = e.PieceValue(board.Pieces[next])
-			attackers = removeSquare(attackers, next)
-		} else {
-			if len(defenders) == 0 {
-				break
-			}
-			next = e.leastValuablePiece(board, defenders)
-			nextVal = e.PieceValue(board.Pieces[next])
-			defenders = removeSquare(defenders, next)
-		}
-
-		lastGain := gains[len(gains)-1]
-		gains = append(gains, nextVal-lastGain)
-		turn = !turn
-	}
-
-	for i := len(gains) - 2; i >= 0; i-- {
-		gains[i] = max(-gains[i+1], gains[i])
-	}
-
-	return gains[0]
-}
-
-func (e *Engine) leastValuablePiece(board *core.Board, squares []int) int {
-	least := squares[0]
-	val := e.PieceValue(board.Pieces[least])
-	for _, sq := range squares[1:] {
-		v := e.PieceValue(board.Pieces[sq])
-		if v < val {
-			val = v
-			least = sq
-		}
-	}
-	return least
-}
-
-func removeSquare(slice []int, sq int) []int {
-	for i, s := range slice {
-		if s == sq {
-			return append(slice[:i], slice[i+1:]...)
-		}
-	}
-	return slice
-}
-
-func max(a, b int) int {
-	if a > b {
-		return a
-	}
-	return b
-}
-
@@ -7,45 +7,101 @@ import (
 const (
 	MateScore     = 30000
 	MateThreshold = MateScore - 1000
+	Infinity      = MateScore + 1
 )
 
 func (e *Engine) negamax(depth int, alpha, beta, rootDepth int) int {
 	e.NodesSearched++
 
+	ply := e.ply()
+	e.pvLength[ply] = ply
+	e.selDepth = max(e.selDepth, ply)
+
 	if e.NodesSearched%2048 == 0 && e.TimeUp() {
 		e.Aborted = true
 		return 0
 	}
 
+	if ply >= maxPly-1 {
+		return e.Evaluate()
+	}
+
 	originalAlpha := alpha
 	key := e.Board.ComputeZobristHash()
 
+	// set while checking whether the TT move is singular, see below
+	excluded := e.stack[ply].excludedMove
+
 	var ttMove core.Move
-	if ok, score, _, m := e.TT.ProbeCut(key, depth, alpha, beta, e.Board.Ply); ok {
-		return score
-	} else {
-		ttMove = m
+	if excluded == (core.Move{}) {
+		if ok, score, _, m := e.TT.ProbeCut(key, depth, alpha, beta, ply); ok {
+			return score
+		} else {
+			ttMove = m
+		}
+	}
+
+	if excluded == (core.Move{}) && e.Tablebases != nil {
+		if score, ok := e.probeTablebases(); ok {
+			return score
+		}
+	}
+	if excluded == (core.Move{}) && e.Syzygy != nil {
+		if score, ok := e.probeSyzygy(); ok {
+			return score
+		}
 	}
 
 	if depth <= 0 {
-		return e.quiscence(alpha, beta, rootDepth)
+		return e.quiscence(alpha, beta, 0)
+	}
+
+	tuning := &e.Tuning
+	isNullWindow := beta-alpha == 1
+	inCheck := e.Board.InCheck(e.Board.WhiteToMove)
+
+	// Static eval for the pruning decisions below. improving means we're
+	// better off than two plies ago, so pruning can afford to be less eager.
+	staticEval := -Infinity
+	improving := false
+	if !inCheck {
+		staticEval = e.Evaluate()
+		improving = ply < 2 || e.stack[ply-2].staticEval == -Infinity || staticEval > e.stack[ply-2].staticEval
+	}
+	e.stack[ply].staticEval = staticEval
+
+	// not while checking the TT move for singularity, that search has to look
+	// at the other moves to mean anything
+	canPruneNode := isNullWindow && !inCheck && beta > -MateThreshold && beta < MateThreshold && excluded == (core.Move{})
+
+	// Reverse futility pruning
+	if canPruneNode && depth <= tuning.RFPDepth {
+		margin := tuning.RFPMargin * depth
+		if improving {
+			margin -= tuning.RFPMargin
+		}
+		if staticEval-margin >= beta {
+			return staticEval
+		}
+	}
+
+	// Razoring
+	if canPruneNode && depth <= tuning.RazorDepth && staticEval+tuning.RazorMargin*depth < alpha {
+		score := e.quiscence(alpha-1, alpha, 0)
+		if score < alpha {
+			return score
+		}
 	}
 
 	// TODO: keep an eye on this, I've found sometimes it makes the engine worse
 	// i don't trust you
-	isNullWindow := beta-alpha == 1
 	nmpMask := e.Board.AllPieces
 	nmpMask ^= e.Board.PieceBitboards[0][core.PieceTypeKing-1] | e.Board.PieceBitboards[1][core.PieceTypeKing-1]
 	nmpMask ^= e.Board.PieceBitboards[0][core.PieceTypePawn-1] | e.Board.PieceBitboards[1][core.PieceTypePawn-1]
-	if isNullWindow && depth >= 3 && nmpMask != 0 && !e.Board.InCheck(e.Board.WhiteToMove) && e.Evaluate() >= beta {
-		enPassant := e.Board.EnPassantTarget
-		e.Board.EnPassantTarget = 64
-		e.Board.WhiteToMove = !e.Board.WhiteToMove
-
+	if isNullWindow && depth >= 3 && nmpMask != 0 && !inCheck && staticEval >= beta && excluded == (core.Move{}) {
+		enPassant := e.makeNullMove()
 		nullScore := -e.negamax(depth-3, -beta, -beta+1, rootDepth) // reduction R=2
-
-		e.Board.WhiteToMove = !e.Board.WhiteToMove
-		e.Board.EnPassantTarget = enPassant
+		e.unmakeNullMove(enPassant)
 
 		if nullScore >= beta {
 			return nullScore
@@ -53,64 +109,139 @@ func (e *Engine) negamax(depth int, alpha, beta, rootDepth int) int {
 	}
 
 	board := e.Board
-	moves := board.GenerateLegalMoves()
-	if len(moves) == 0 {
-		if board.InCheck(board.WhiteToMove) {
-			return -MateScore + board.Ply // checkmate
-		}
-		return 0 // stalemate
-	}
 
 	var bestMove core.Move
 	var bestScore int = -100000
 
-	if ttMove != (core.Move{}) {
-		board.Push(&ttMove)
-		score := -e.negamax(depth-1, -beta, -alpha, rootDepth)
-		board.Pop()
+	legalMoves, movesSearched, quietsSearched := 0, 0, 0
+
+	// moves that didn't cause a cutoff, for the history maluses
+	var quietsTried, capturesTried [64]core.Move
+	nQuiets, nCaptures := 0, 0
 
-		bestScore = score
-		bestMove = ttMove
-		if score > alpha {
-			alpha = score
+	mp := e.newMovePicker(ply, ttMove, excluded)
+	for {
+		move, ok := mp.Next()
+		if !ok {
+			break
 		}
+		legalMoves++
 
-		if alpha >= beta {
-			e.TT.Store(key, depth, bestScore, FlagLower, bestMove, board.Ply)
-			return bestScore
+		isCapture := e.capturedType(move) != core.PieceTypeNone
+		isQuiet := !isCapture && move.Promotion == core.PieceNone
+
+		// Once we have a move that doesn't get us mated, moves that look
+		// hopeless can be skipped. Checks are always searched, see below.
+		canPruneMove := !inCheck && bestScore > -MateThreshold
+		prune := false
+		if canPruneMove && isQuiet {
+			if depth <= tuning.LMPDepth && quietsSearched >= tuning.lmpThreshold(depth, improving) {
+				// Late move pruning
+				mp.SkipQuiets = true
+				prune = true
+			} else if depth <= tuning.FutilityDepth && staticEval+tuning.FutilityBase+tuning.FutilityMargin*depth <= alpha {
+				// Futility pruning
+				prune = true
+			} else if depth <= tuning.SEEPruneDepth && !e.SEEGreaterOrEqual(move, -tuning.SEEQuietMargin*depth) {
+				prune = true
+			}
+		} else if canPruneMove && isCapture && depth <= tuning.SEEPruneDepth && !e.SEEGreaterOrEqual(move, -tuning.SEECaptureMargin*depth*depth) {
+			prune = true
 		}
-	}
 
-	e.OrderMoves(moves, rootDepth)
+		extension := 0
 
-	firstMove := true
-	for i, move := range moves {
-		if move == ttMove {
-			continue
+		// Singular extension: if every other move falls well short of the
+		// TT score, the TT move is the only one that holds and deserves to
+		// be looked at deeper.
+		if move == ttMove && depth >= tuning.SingularDepth && e.canExtend(ply, rootDepth) {
+			if hit, entry := e.TT.Probe(key); hit && entry.Move == ttMove && entry.bound != FlagUpper && int(entry.depth) >= depth-3 {
+				ttScore := FromTTScore(entry.Score, ply)
+				if ttScore > -MateThreshold && ttScore < MateThreshold {
+					singularBeta := ttScore - tuning.SingularMargin*depth
+					e.stack[ply].excludedMove = ttMove
+					score := e.negamax((depth-1)/2, singularBeta-1, singularBeta, rootDepth)
+					e.stack[ply].excludedMove = core.Move{}
+
+					if e.Aborted {
+						return 0
+					}
+
+					if score < singularBeta {
+						extension = 1
+					} else if singularBeta >= beta {
+						// Multi-cut: even without the TT move more than one
+						// move beats beta, this node is going to fail high
+						return singularBeta
+					}
+				}
+			}
+		}
+
+		history := 0
+		if isQuiet {
+			history = e.quietHistory(move, ply)
 		}
 
-		isCapture := (move.To == board.EnPassantTarget) || ((1<<move.To)&board.AllPieces) != 0
-		board.Push(&move)
+		e.makeMove(move)
 		searchDepth := depth - 1
 
-		// LMR
 		enemyInCheck := board.InCheck(board.WhiteToMove)
-		if depth >= 3 && !isCapture && !enemyInCheck && i > 3 {
-			searchDepth-- // redurection R=1
+		if prune && !enemyInCheck {
+			e.unmakeMove()
+			continue
+		}
+
+		movesSearched++
+		if isQuiet {
+			quietsSearched++
+		}
+
+		if extension == 0 && enemyInCheck && e.canExtend(ply, rootDepth) {
+			extension = 1 // check extension
+		}
+		e.stack[ply+1].extensions = e.stack[ply].extensions + extension
+		searchDepth += extension
+
+		// LMR: late quiets are searched shallower, and only get the full
+		// depth back if they turn out to beat alpha
+		reducedDepth := searchDepth
+		if depth >= 3 && isQuiet && !inCheck && movesSearched > 1 {
+			r := e.lmr[min(depth, maxPly-1)][min(movesSearched, 63)]
+			if !isNullWindow {
+				r--
+			}
+			if !improving {
+				r++
+			}
+			if enemyInCheck {
+				r--
+			}
+			if e.isKiller(move, ply) {
+				r--
+			}
+			r -= history / tuning.LMRHistoryDivisor
+			reducedDepth = min(max(searchDepth-r, 1), searchDepth)
 		}
 
 		var score int
-		if firstMove {
+		if movesSearched == 1 {
 			score = -e.negamax(searchDepth, -beta, -alpha, rootDepth)
-			firstMove = false
 		} else {
-			score = -e.negamax(searchDepth, -alpha-1, -alpha, rootDepth)
+			score = -e.negamax(reducedDepth, -alpha-1, -alpha, rootDepth)
+			if score > alpha && reducedDepth < searchDepth {
+				score = -e.negamax(searchDepth, -alpha-1, -alpha, rootDepth)
+			}
 			if score > alpha && score < beta {
 				score = -e.negamax(searchDepth, -beta, -alpha, rootDepth)
 			}
 		}
 
-		board.Pop()
+		e.unmakeMove()
+
+		if e.Aborted {
+			return 0
+		}
 
 		if score > bestScore {
 			bestScore = score
@@ -118,15 +249,36 @@ func (e *Engine) negamax(depth int, alpha, beta, rootDepth int) int {
 		}
 		if bestScore > alpha {
 			alpha = bestScore
+			e.updatePV(ply, move)
 		}
 		if alpha >= beta {
-			isCapture := move.To == board.EnPassantTarget || ((1<<move.To)&board.AllPieces) != 0
-			if !isCapture {
-				e.addKillerMove(move, depth)
-				e.HistoryTable[move.From][move.To] += depth * depth
-			}
+			e.updateHistories(ply, depth, move, quietsTried[:nQuiets], capturesTried[:nCaptures])
 			break
 		}
+
+		if isQuiet && nQuiets < len(quietsTried) {
+			quietsTried[nQuiets] = move
+			nQuiets++
+		} else if isCapture && nCaptures < len(capturesTried) {
+			capturesTried[nCaptures] = move
+			nCaptures++
+		}
+	}
+
+	if excluded != (core.Move{}) {
+		// Nothing but the excluded move was playable, and its result isn't
+		// for the TT either way
+		if legalMoves == 0 {
+			return alpha
+		}
+		return bestScore
+	}
+
+	if legalMoves == 0 {
+		if inCheck {
+			return -MateScore + ply // checkmate, counted from the root
+		}
+		return 0 // stalemate
 	}
 
 	// Store result in TT
@@ -140,7 +292,25 @@ func (e *Engine) negamax(depth int, alpha, beta, rootDepth int) int {
 		bound = FlagExact
 	}
 
-	e.TT.Store(key, depth, bestScore, bound, bestMove, board.Ply)
+	e.TT.Store(key, depth, bestScore, bound, bestMove, ply)
 
 	return bestScore
 }
+
+// canExtend caps the extensions along a line, so that no line ends up more
+// than twice as long as the iteration depth.
+func (e *Engine) canExtend(ply, rootDepth int) bool {
+	return e.stack[ply].extensions < rootDepth
+}
+
+func (e *Engine) ply() int {
+	return e.Board.Ply - e.rootPly
+}
+
+// updatePV makes move followed by the child's line the principal variation at ply.
+func (e *Engine) updatePV(ply int, move core.Move) {
+	e.pvTable[ply][ply] = move
+	next := ply + 1
+	n := copy(e.pvTable[ply][ply+1:], e.pvTable[next][next:e.pvLength[next]])
+	e.pvLength[ply] = ply + 1 + n
+}
@@ -0,0 +1,187 @@
+package engine
+
+import "gochess/core"
+
+// Stages of the move picker, in the order their moves are handed out.
+const (
+	stageTTMove = iota
+	stageGenerate
+	stageGoodCaptures
+	stageKiller1
+	stageKiller2
+	stageCounter
+	stageQuiets
+	stageBadCaptures
+	stageDone
+)
+
+// MovePicker hands out the legal moves of a position one at a time, most
+// promising first. The work is done in stages as moves are asked for, so a
+// cutoff by the TT move never pays for move generation, and each move is
+// selected from a fixed buffer rather than sorting the whole list up front.
+type MovePicker struct {
+	e        *Engine
+	ply      int
+	ttMove   core.Move
+	excluded core.Move
+
+	// killers and the countermove, with duplicates cleared
+	refutations [3]core.Move
+
+	// SkipQuiets stops the picker from handing out any more quiet moves,
+	// once the search has decided to prune the rest of them anyway.
+	SkipQuiets bool
+
+	stage int
+
+	// After generation captures and promotions sit in [0, nCaptures) and
+	// quiets in [nCaptures, n). Captures that lose material are moved to
+	// [0, badEnd) as they come up and handed out last.
+	moves     [core.MaxMoves]core.Move
+	scores    [core.MaxMoves]int
+	n         int
+	nCaptures int
+	badEnd    int
+	cur       int
+}
+
+func (e *Engine) newMovePicker(ply int, ttMove, excluded core.Move) MovePicker {
+	mp := MovePicker{
+		e:        e,
+		ply:      ply,
+		ttMove:   ttMove,
+		excluded: excluded,
+	}
+
+	mp.refutations[0] = e.KillerMoves[ply][0]
+	if k := e.KillerMoves[ply][1]; k != mp.refutations[0] {
+		mp.refutations[1] = k
+	}
+	if c := e.counterMove(ply); c != mp.refutations[0] && c != mp.refutations[1] {
+		mp.refutations[2] = c
+	}
+
+	return mp
+}
+
+// Next returns the next move to search, false once there are none left.
+func (mp *MovePicker) Next() (core.Move, bool) {
+	for {
+		switch mp.stage {
+		case stageTTMove:
+			mp.stage++
+			if mp.ttMove != (core.Move{}) && mp.ttMove != mp.excluded && mp.e.Board.IsMoveLegal(mp.ttMove) {
+				return mp.ttMove, true
+			}
+
+		case stageGenerate:
+			mp.generate()
+			mp.stage++
+
+		case stageGoodCaptures:
+			for mp.cur < mp.nCaptures {
+				move := mp.selectBest(mp.cur, mp.nCaptures)
+				mp.cur++
+				if mp.skip(move) {
+					continue
+				}
+				if !mp.e.SEEGreaterOrEqual(move, 0) {
+					mp.moves[mp.badEnd] = move
+					mp.badEnd++
+					continue
+				}
+				return move, true
+			}
+			mp.stage++
+
+		case stageKiller1, stageKiller2, stageCounter:
+			move := mp.refutations[mp.stage-stageKiller1]
+			mp.stage++
+			if !mp.SkipQuiets && move != (core.Move{}) && !mp.skip(move) && mp.isQuiet(move) {
+				return move, true
+			}
+
+		case stageQuiets:
+			if mp.cur == mp.nCaptures {
+				for i := mp.nCaptures; i < mp.n; i++ {
+					mp.scores[i] = mp.e.quietHistory(mp.moves[i], mp.ply)
+				}
+			}
+			for !mp.SkipQuiets && mp.cur < mp.n {
+				move := mp.selectBest(mp.cur, mp.n)
+				mp.cur++
+				if mp.skip(move) || mp.isRefutation(move) {
+					continue
+				}
+				return move, true
+			}
+			mp.stage++
+			mp.cur = 0
+
+		case stageBadCaptures:
+			if mp.cur < mp.badEnd {
+				move := mp.moves[mp.cur]
+				mp.cur++
+				return move, true
+			}
+			mp.stage++
+
+		default:
+			return core.Move{}, false
+		}
+	}
+}
+
+func (mp *MovePicker) generate() {
+	var buf [core.MaxMoves]core.Move
+	moves := mp.e.Board.GenerateLegalMovesInto(&buf)
+
+	for _, move := range moves {
+		if mp.e.capturedType(move) != core.PieceTypeNone || move.Promotion != core.PieceNone {
+			mp.moves[mp.n] = move
+			mp.scores[mp.n] = 16*mp.e.MVVLVA(move) + mp.e.captureHistory(move)
+			mp.n++
+		}
+	}
+	mp.nCaptures = mp.n
+
+	for _, move := range moves {
+		if mp.e.capturedType(move) == core.PieceTypeNone && move.Promotion == core.PieceNone {
+			mp.moves[mp.n] = move
+			mp.n++
+		}
+	}
+}
+
+// selectBest swaps the best scored move of [from, to) to from and returns it.
+func (mp *MovePicker) selectBest(from, to int) core.Move {
+	best := from
+	for i := from + 1; i < to; i++ {
+		if mp.scores[i] > mp.scores[best] {
+			best = i
+		}
+	}
+	mp.moves[from], mp.moves[best] = mp.moves[best], mp.moves[from]
+	mp.scores[from], mp.scores[best] = mp.scores[best], mp.scores[from]
+	return mp.moves[from]
+}
+
+// skip reports moves handed out already or not to be searched at all.
+func (mp *MovePicker) skip(move core.Move) bool {
+	return move == mp.ttMove || move == mp.excluded
+}
+
+func (mp *MovePicker) isRefutation(move core.Move) bool {
+	return move == mp.refutations[0] || move == mp.refutations[1] || move == mp.refutations[2]
+}
+
+// isQuiet reports whether move is one of the generated quiets, which also
+// makes sure killers and countermoves are legal here.
+func (mp *MovePicker) isQuiet(move core.Move) bool {
+	for i := mp.nCaptures; i < mp.n; i++ {
+		if mp.moves[i] == move {
+			return true
+		}
+	}
+	return false
+}
@@ -1,33 +1,143 @@
 package engine
 
-func (e *Engine) quiscence(alpha, beta, rootDepth int) (score int) {
+import "gochess/core"
+
+// quiscence resolves the tactics at the leaves of the main search: captures
+// and promotions, every evasion when in check, and quiet checks on the first
+// ply. qply counts the plies since the main search ran out of depth.
+func (e *Engine) quiscence(alpha, beta, qply int) (score int) {
 	e.NodesSearched++
-	standPat := e.Evaluate()
 
-	if standPat >= beta {
-		return beta
+	ply := e.ply()
+	e.selDepth = max(e.selDepth, ply)
+
+	if e.NodesSearched%2048 == 0 && e.TimeUp() {
+		e.Aborted = true
+		return 0
+	}
+
+	if ply >= maxPly-1 {
+		return e.Evaluate()
+	}
+
+	board := e.Board
+	key := board.ComputeZobristHash()
+
+	ok, ttScore, _, ttMove := e.TT.ProbeCut(key, 0, alpha, beta, ply)
+	if ok {
+		return ttScore
+	}
+
+	originalAlpha := alpha
+	inCheck := board.InCheck(board.WhiteToMove)
+
+	bestScore := -Infinity
+	standPat := -Infinity
+	if !inCheck {
+		standPat = e.Evaluate()
+		if standPat >= beta {
+			return standPat
+		}
+		alpha = max(alpha, standPat)
+		bestScore = standPat
+	}
+
+	var buf [core.MaxMoves]core.Move
+	var moves []core.Move
+	if inCheck || qply == 0 {
+		moves = board.GenerateLegalMovesInto(&buf)
+	} else {
+		moves = board.GenerateTacticalMovesInto(&buf)
+	}
+
+	if inCheck && len(moves) == 0 {
+		return -MateScore + ply // checkmate, counted from the root
 	}
 
-	if standPat > alpha {
-		alpha = standPat
+	var scores [core.MaxMoves]int
+	for i, move := range moves {
+		switch {
+		case move == ttMove:
+			scores[i] = 2_000_000
+		case e.capturedType(move) != core.PieceTypeNone || move.Promotion != core.PieceNone:
+			scores[i] = 1_000_000 + 16*e.MVVLVA(move) + e.captureHistory(move)
+		default:
+			scores[i] = e.quietHistory(move, ply)
+		}
 	}
 
-	moves := e.Board.GenerateLegalCaptures()
-	e.OrderMovesQ(moves, rootDepth)
-	for _, move := range moves {
-		e.Board.Push(&move)
-		score := -e.quiscence(-beta, -alpha, rootDepth)
-		e.Board.Pop()
+	tuning := &e.Tuning
+	var bestMove core.Move
+	for i := range moves {
+		// selection sort, a cutoff usually comes before we'd need them all
+		best := i
+		for j := i + 1; j < len(moves); j++ {
+			if scores[j] > scores[best] {
+				best = j
+			}
+		}
+		moves[i], moves[best] = moves[best], moves[i]
+		scores[i], scores[best] = scores[best], scores[i]
+		move := moves[i]
+
+		captured := e.capturedType(move)
+		isTactical := captured != core.PieceTypeNone || move.Promotion != core.PieceNone
+
+		if !inCheck {
+			if !isTactical && !e.givesCheck(move) {
+				continue
+			}
+
+			if captured != core.PieceTypeNone && move.Promotion == core.PieceNone {
+				// Delta pruning: even winning the piece for free doesn't get us to alpha
+				if standPat+pieceValue(core.Piece(captured))+tuning.QSDeltaMargin <= alpha {
+					continue
+				}
+
+				if !e.SEEGreaterOrEqual(move, 0) {
+					continue
+				}
+			}
+		}
+
+		e.makeMove(move)
+		score := -e.quiscence(-beta, -alpha, qply+1)
+		e.unmakeMove()
 
-		if score >= beta {
-			return score
+		if e.Aborted {
+			return 0
 		}
 
+		if score > bestScore {
+			bestScore = score
+			bestMove = move
+		}
 		if score > alpha {
 			alpha = score
 		}
+		if alpha >= beta {
+			break
+		}
 	}
 
-	return alpha
+	var bound Bound
+	switch {
+	case bestScore <= originalAlpha:
+		bound = FlagUpper
+	case bestScore >= beta:
+		bound = FlagLower
+	default:
+		bound = FlagExact
+	}
+	e.TT.Store(key, 0, bestScore, bound, bestMove, ply)
+
+	return bestScore
 }
 
+// givesCheck reports whether move puts the opponent in check.
+func (e *Engine) givesCheck(move core.Move) bool {
+	e.Board.Push(&move)
+	check := e.Board.InCheck(e.Board.WhiteToMove)
+	e.Board.Pop()
+	return check
+}
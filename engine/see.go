@@ -0,0 +1,146 @@
+package engine
+
+import "gochess/core"
+
+// Static exchange evaluation: the material balance of the capture sequence
+// on a move's destination square, both sides always recapturing with their
+// least valuable piece and free to stop whenever carrying on would lose.
+// Sliders lined up behind a capturer join in once it has moved off, since
+// attackers are recomputed from the shrinking occupancy each step.
+
+// seeStart plays move on the occupancy only and returns what's left of it,
+// the material the mover wins straight away and the value of the piece left
+// standing on the destination square.
+func (e *Engine) seeStart(move core.Move) (occ core.Bitboard, won, onSquare int) {
+	board := e.Board
+	from, to := move.From, move.To
+
+	occ = board.AllPieces &^ (1 << from)
+	won = pieceValue(core.Piece(e.capturedType(move)))
+	onSquare = pieceValue(board.Pieces[from])
+
+	if board.Pieces[from].Type() == core.PieceTypePawn && to == board.EnPassantTarget {
+		if board.WhiteToMove {
+			occ &^= 1 << (to - 8)
+		} else {
+			occ &^= 1 << (to + 8)
+		}
+	}
+
+	if move.Promotion != core.PieceNone {
+		won += pieceValue(move.Promotion) - pieceValue(core.PieceWhitePawn)
+		onSquare = pieceValue(move.Promotion)
+	}
+
+	return occ, won, onSquare
+}
+
+// leastValuableAttacker finds the cheapest piece of side (0 white, 1 black)
+// in attackers.
+func (e *Engine) leastValuableAttacker(attackers core.Bitboard, side int) (core.Position, uint8) {
+	for pieceType := uint8(core.PieceTypePawn); pieceType <= core.PieceTypeKing; pieceType++ {
+		if bb := attackers & e.Board.PieceBitboards[side][pieceType-1]; bb != 0 {
+			return core.Position(bb.LSB()), pieceType
+		}
+	}
+	return 64, core.PieceTypeNone
+}
+
+func sidePieces(board *core.Board, side int) core.Bitboard {
+	if side == 0 {
+		return board.WhitePieces
+	}
+	return board.BlackPieces
+}
+
+// SEE returns the material move wins or loses once the exchange it starts
+// has played out.
+func (e *Engine) SEE(move core.Move) int {
+	board := e.Board
+	to := move.To
+	occ, won, onSquare := e.seeStart(move)
+
+	side := 1 // the side to recapture
+	if !board.WhiteToMove {
+		side = 0
+	}
+
+	var gain [32]int
+	gain[0] = won
+	d := 0
+	for d < len(gain)-1 {
+		attackers := board.AttackersTo(to, occ) & occ & sidePieces(board, side)
+		if attackers == 0 {
+			break
+		}
+		sq, pieceType := e.leastValuableAttacker(attackers, side)
+
+		d++
+		gain[d] = onSquare - gain[d-1]
+		onSquare = pieceValue(core.Piece(pieceType))
+		if pieceType == core.PieceTypePawn && (to>>3 == 0 || to>>3 == 7) {
+			gain[d] += pieceValue(core.PieceWhiteQueen) - onSquare
+			onSquare = pieceValue(core.PieceWhiteQueen)
+		}
+
+		occ &^= 1 << sq
+		side ^= 1
+	}
+
+	for ; d > 0; d-- {
+		gain[d-1] = -max(-gain[d-1], gain[d])
+	}
+	return gain[0]
+}
+
+// SEEGreaterOrEqual reports whether SEE(move) >= threshold. It doesn't work
+// out the exact value, so it can stop as soon as the answer is certain,
+// which makes it the cheaper choice for pruning and ordering decisions.
+func (e *Engine) SEEGreaterOrEqual(move core.Move, threshold int) bool {
+	board := e.Board
+	to := move.To
+	occ, won, onSquare := e.seeStart(move)
+
+	mover := 0
+	if !board.WhiteToMove {
+		mover = 1
+	}
+	side := mover ^ 1 // the side to recapture
+
+	// balance is how far the mover is above the threshold if the exchange
+	// stops right now. Only a yes or no is wanted, so a side that's already
+	// on the right side of the threshold stops, and one that isn't takes
+	// with its least valuable piece, as it has nothing to lose by it.
+	balance := won - threshold
+	for (balance >= 0) != (side == mover) {
+		attackers := board.AttackersTo(to, occ) & occ
+		ours := attackers & sidePieces(board, side)
+		if ours == 0 {
+			break
+		}
+		sq, pieceType := e.leastValuableAttacker(ours, side)
+
+		// the king can only take if nothing can take it back
+		if pieceType == core.PieceTypeKing && attackers&^ours != 0 {
+			break
+		}
+
+		gain := onSquare
+		onSquare = pieceValue(core.Piece(pieceType))
+		if pieceType == core.PieceTypePawn && (to>>3 == 0 || to>>3 == 7) {
+			// a pawn recapturing on the last rank promotes, as in SEE
+			gain += pieceValue(core.PieceWhiteQueen) - onSquare
+			onSquare = pieceValue(core.PieceWhiteQueen)
+		}
+		if side == mover {
+			balance += gain
+		} else {
+			balance -= gain
+		}
+
+		occ &^= 1 << sq
+		side ^= 1
+	}
+
+	return balance >= 0
+}
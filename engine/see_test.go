@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"gochess/core"
+	"gochess/fen"
+	"testing"
+)
+
+func load(t *testing.T, s string) *core.Board {
+	t.Helper()
+	b, err := fen.LoadFromFEN(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// find returns the legal move written as s in coordinate notation.
+func find(t *testing.T, b *core.Board, s string) core.Move {
+	t.Helper()
+	for _, m := range b.GenerateLegalMoves() {
+		if b.ToAlgebraNotation(m) == s {
+			return m
+		}
+	}
+	t.Fatalf("%s: no move %s", fen.BoardToFEN(b), s)
+	return core.Move{}
+}
+
+func TestSEE(t *testing.T) {
+	for _, tt := range []struct {
+		fen, move string
+		see       int
+	}{
+		{"4k3/8/8/4p3/8/8/8/4R1K1 w - - 0 1", "e1e5", 100},
+		{"4r1k1/8/8/4p3/8/8/8/4R1K1 w - - 0 1", "e1e5", -400},
+		// the second rook only joins in once the first has gone
+		{"4r1k1/8/8/4p3/8/8/4R3/4R1K1 w - - 0 1", "e2e5", 100},
+		{"4r1k1/4r3/8/4p3/8/8/4R3/4R1K1 w - - 0 1", "e2e5", -400},
+		// and so does a queen behind a bishop
+		{"6k1/8/4p3/3p4/8/1B6/8/6K1 w - - 0 1", "b3d5", -230},
+		{"6k1/8/4p3/3p4/8/1B6/Q7/6K1 w - - 0 1", "b3d5", -130},
+
+		// en passant takes a pawn that isn't on the destination square
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 100},
+		{"4k3/2p5/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 0},
+
+		// promotions, the mover's and a recapture's
+		{"4k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b7b8q", 800},
+		{"r3k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b7b8q", -100},
+		{"r3k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b7a8q", 1300},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q2/PPPBBPpP/R2K3R w kq - 0 1", "h1f1", -730},
+
+		// the king only takes what nothing defends
+		{"3k4/3p4/8/8/8/8/8/3RK3 w - - 0 1", "d1d7", -400},
+		{"3k4/3p4/8/8/8/8/3R4/3RK3 w - - 0 1", "d2d7", 100},
+	} {
+		b := load(t, tt.fen)
+		e := NewEngine(b)
+		move := find(t, b, tt.move)
+		if got := e.SEE(move); got != tt.see {
+			t.Errorf("%s %s: SEE %d, want %d", tt.fen, tt.move, got, tt.see)
+		}
+		for _, threshold := range []int{tt.see - 1, tt.see, tt.see + 1} {
+			if got, want := e.SEEGreaterOrEqual(move, threshold), tt.see >= threshold; got != want {
+				t.Errorf("%s %s: SEEGreaterOrEqual(%d) %v, want %v", tt.fen, tt.move, threshold, got, want)
+			}
+		}
+	}
+}
+
+// SEEGreaterOrEqual has to agree with SEE everywhere, not just on the
+// positions above, so every move two plies into the bench positions is
+// tried around its own SEE and at a spread of fixed thresholds.
+func TestSEEGreaterOrEqual(t *testing.T) {
+	thresholds := []int{-1300, -900, -500, -330, -230, -100, -1, 0, 1, 100, 230, 330, 500, 900, 1300}
+
+	check := func(e *Engine) {
+		for _, move := range e.Board.GenerateLegalMoves() {
+			see := e.SEE(move)
+			for _, threshold := range append([]int{see - 1, see, see + 1}, thresholds...) {
+				if got := e.SEEGreaterOrEqual(move, threshold); got != (see >= threshold) {
+					t.Fatalf("%s %s: SEE %d but SEEGreaterOrEqual(%d) %v",
+						fen.BoardToFEN(e.Board), e.Board.ToAlgebraNotation(move), see, threshold, got)
+				}
+			}
+		}
+	}
+
+	for _, position := range benchPositions {
+		e := NewEngine(load(t, position))
+		check(e)
+		for _, move := range e.Board.GenerateLegalMoves() {
+			e.Board.Push(&move)
+			check(e)
+			e.Board.Pop()
+		}
+	}
+}
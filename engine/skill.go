@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"gochess/core"
+	"math"
+	"math/rand"
+)
+
+const (
+	MaxSkillLevel = 20
+
+	skillMultiPV = 4
+)
+
+// Skill weakens the engine for human opponents. Level MaxSkillLevel is full
+// strength, anything lower caps depth and nodes, and picks among the top few
+// root moves at random instead of always playing the best one.
+//
+// The levels have no Elo attached: none has been measured against rated
+// opponents, so there's no UCI_Elo until one is.
+type Skill struct {
+	Level int
+}
+
+func FullStrength() Skill {
+	return Skill{Level: MaxSkillLevel}
+}
+
+func (s Skill) Enabled() bool {
+	return s.Level < MaxSkillLevel
+}
+
+func (s Skill) depthLimit() int {
+	return 1 + s.Level/2
+}
+
+func (s Skill) nodeLimit() uint64 {
+	return 1000 << (s.Level / 2)
+}
+
+// blunderChance is how often the move is picked with no regard to score.
+func (s Skill) blunderChance() float64 {
+	return float64(MaxSkillLevel-s.Level) * 0.015
+}
+
+// temperature in centipawns for the score weighted pick, the weaker the
+// level the more a worse move still gets picked.
+func (s Skill) temperature() float64 {
+	return 10 + float64(MaxSkillLevel-s.Level)*10
+}
+
+func (s Skill) limit(limits SearchLimits) SearchLimits {
+	limits.MultiPV = max(limits.MultiPV, skillMultiPV)
+
+	if limits.Depth == 0 || limits.Depth > s.depthLimit() {
+		limits.Depth = s.depthLimit()
+	}
+	if limits.Nodes == 0 || limits.Nodes > s.nodeLimit() {
+		limits.Nodes = s.nodeLimit()
+	}
+
+	return limits
+}
+
+// pick chooses among the candidate lines, weighting each by how close its
+// score is to the best one.
+func (s Skill) pick(lines []RootMove, rng *rand.Rand) RootMove {
+	if len(lines) == 1 {
+		return lines[0]
+	}
+
+	if rng.Float64() < s.blunderChance() {
+		return lines[rng.Intn(len(lines))]
+	}
+
+	best := lines[0].Score
+	weights := make([]float64, len(lines))
+	total := 0.0
+	for i, line := range lines {
+		diff := float64(min(best-line.Score, 1000))
+		weights[i] = math.Exp(-diff / s.temperature())
+		total += weights[i]
+	}
+
+	r := rng.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return lines[i]
+		}
+		r -= w
+	}
+
+	return lines[0]
+}
+
+func (e *Engine) searchWeakened(limits SearchLimits) *core.Move {
+	lines := e.Analyse(e.Skill.limit(limits))
+	if len(lines) == 0 {
+		return nil
+	}
+
+	if e.rng == nil {
+		e.rng = rand.New(rand.NewSource(rand.Int63()))
+	}
+
+	chosen := e.Skill.pick(lines, e.rng)
+	e.rootPV = chosen.PV
+	return &chosen.Move
+}
@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"gochess/core"
+	"gochess/syzygy"
+	"math/bits"
+)
+
+// tbWin scores a position the Syzygy tables say is won. The tables don't
+// know how far off mate is, so it stays below the mate scores.
+const tbWin = MateThreshold - maxPly - 1
+
+// syzygyProbeable is whether the position is small enough to look up.
+func (e *Engine) syzygyProbeable() bool {
+	return e.Syzygy != nil && !e.syzygyOff && bits.OnesCount64(uint64(e.Board.AllPieces)) <= e.SyzygyProbeLimit
+}
+
+// probeSyzygy looks the current position up in the Syzygy WDL tables, only
+// right after a capture or a pawn move. That's when the fifty move counter
+// is back to 0, which the WDL result takes for granted, and it's the first
+// node of each new material, so the rest of the subtree doesn't probe again.
+func (e *Engine) probeSyzygy() (int, bool) {
+	if !e.syzygyProbeable() || !e.afterZeroingMove() {
+		return 0, false
+	}
+	wdl, ok := e.Syzygy.ProbeWDL(e.Board)
+	if !ok {
+		return 0, false
+	}
+	e.TBHits++
+	return syzygyScore(wdl, e.ply()), true
+}
+
+// afterZeroingMove is whether the move that led here, in this search, was a
+// capture or a pawn move. Not a null move, that counts towards fifty moves.
+func (e *Engine) afterZeroingMove() bool {
+	ply := e.ply()
+	if ply < 1 || ply > maxPly {
+		return false
+	}
+	prev := e.stack[ply-1]
+	if prev.piece == core.PieceNone {
+		return false
+	}
+	last := e.Board.LastMove()
+	return prev.piece.Type() == core.PieceTypePawn || last != nil && last.Captured != core.PieceNone
+}
+
+// syzygyScore turns a WDL result into a search score, wins closer to the
+// root scoring higher. Cursed wins and blessed losses are draws under the
+// fifty move rule, they just get nudged towards the side that'd like them.
+func syzygyScore(wdl, ply int) int {
+	switch wdl {
+	case syzygy.Win:
+		return tbWin - ply
+	case syzygy.Loss:
+		return -tbWin + ply
+	}
+	return 2 * wdl
+}
+
+// syzygyRoot ranks the root moves with the Syzygy tables. When the position
+// is won or lost and the DTZ files are there, the tables pick the move: the
+// one that gets to the next capture or pawn move soonest when winning, and
+// puts it off longest when losing. Otherwise the search goes on, with only
+// the moves that keep the best result.
+func (e *Engine) syzygyRoot(moves []core.Move, multiPV int) ([]RootMove, []core.Move, bool) {
+	if !e.syzygyProbeable() {
+		return nil, moves, false
+	}
+
+	ranked, dtz := e.Syzygy.RootMoves(e.Board)
+	if !dtz {
+		var ok bool
+		if ranked, ok = e.Syzygy.RootMovesWDL(e.Board); !ok {
+			return nil, moves, false
+		}
+	}
+	e.TBHits += uint64(len(ranked))
+
+	best := ranked[0].WDL
+	if dtz && (best == syzygy.Win || best == syzygy.Loss) {
+		lines := make([]RootMove, min(max(multiPV, 1), len(ranked)))
+		for i := range lines {
+			rm := ranked[i]
+			lines[i] = RootMove{Move: rm.Move, Score: syzygyScore(rm.WDL, 0) - rm.DTZ, PV: e.syzygyPV(rm.Move)}
+			e.selDepth = len(lines[i].PV)
+			e.report(1, i, lines[i], FlagExact)
+		}
+		return lines, nil, true
+	}
+
+	kept := moves[:0]
+	for _, rm := range ranked {
+		if rm.WDL == best {
+			kept = append(kept, rm.Move)
+		}
+	}
+
+	// every winning move would look the same to a search that keeps asking
+	// the tables, so it has to find the way to mate on its own
+	if best > syzygy.Draw {
+		e.syzygyOff = true
+	}
+	return nil, kept, false
+}
+
+// syzygyPV follows the tables' choices after move, as far as the next
+// capture or pawn move.
+func (e *Engine) syzygyPV(move core.Move) []core.Move {
+	pv := []core.Move{move}
+	zeroing := e.Board.Pieces[move.To] != core.PieceNone || e.Board.Pieces[move.From].Type() == core.PieceTypePawn
+
+	e.Board.Push(&move)
+	for !zeroing && len(pv) < maxDepth {
+		ranked, ok := e.Syzygy.RootMoves(e.Board)
+		if !ok || len(ranked) == 0 || ranked[0].WDL == syzygy.Draw {
+			break
+		}
+		next := ranked[0].Move
+		zeroing = e.Board.Pieces[next.To] != core.PieceNone || e.Board.Pieces[next.From].Type() == core.PieceTypePawn
+		e.Board.Push(&next)
+		pv = append(pv, next)
+	}
+	for range pv {
+		e.Board.Pop()
+	}
+	return pv
+}
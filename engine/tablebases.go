@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"cmp"
+	"gochess/core"
+	"gochess/tablebase"
+	"slices"
+)
+
+// probeTablebases looks the current position up in the endgame tables.
+func (e *Engine) probeTablebases() (int, bool) {
+	r, ok := e.Tablebases.Probe(e.Board)
+	if !ok {
+		return 0, false
+	}
+	e.TBHits++
+	return tablebaseScore(r, e.ply()), true
+}
+
+// tablebaseScore turns a table result into a search score for a position
+// ply plies from the root, the mate counted from the root like the ones
+// the search finds itself.
+func tablebaseScore(r tablebase.Result, ply int) int {
+	switch r.Outcome {
+	case 1:
+		return MateScore - (ply + r.Plies)
+	case -1:
+		return -MateScore + ply + r.Plies
+	}
+	return 0
+}
+
+// tablebaseRoot ranks the root moves by the tables alone, when every one of
+// them leads to a position they know. The PVs follow the tables' best play.
+func (e *Engine) tablebaseRoot(moves []core.Move, multiPV int) ([]RootMove, bool) {
+	if e.Tablebases == nil {
+		return nil, false
+	}
+	if _, ok := e.Tablebases.Probe(e.Board); !ok {
+		return nil, false
+	}
+
+	rootMoves := make([]RootMove, 0, len(moves))
+	for _, move := range moves {
+		e.Board.Push(&move)
+		r, ok := e.Tablebases.Probe(e.Board)
+		e.Board.Pop()
+		if !ok {
+			return nil, false
+		}
+		e.TBHits++
+
+		rootMoves = append(rootMoves, RootMove{
+			Move:  move,
+			Score: -tablebaseScore(r, 1),
+		})
+	}
+
+	slices.SortStableFunc(rootMoves, func(a, b RootMove) int { return cmp.Compare(b.Score, a.Score) })
+
+	lines := rootMoves[:min(max(multiPV, 1), len(rootMoves))]
+	for i := range lines {
+		lines[i].PV = e.tablebasePV(lines[i])
+		e.selDepth = len(lines[i].PV)
+		e.report(1, i, lines[i], FlagExact)
+	}
+	return lines, true
+}
+
+// tablebasePV follows the tables' best moves on to mate, or just gives the
+// move for a draw.
+func (e *Engine) tablebasePV(rm RootMove) []core.Move {
+	pv := []core.Move{rm.Move}
+	if rm.Score == 0 {
+		return pv
+	}
+
+	e.Board.Push(&rm.Move)
+	for len(pv) < maxDepth {
+		next, _, ok := e.Tablebases.BestMove(e.Board)
+		if !ok {
+			break
+		}
+		e.Board.Push(&next)
+		pv = append(pv, next)
+	}
+	for range pv {
+		e.Board.Pop()
+	}
+	return pv
+}
@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"gochess/core"
+	"time"
+)
+
+// TimeControl is the clock situation for the side to move, as handed to us by
+// the GUI. Zero values mean "not specified".
+type TimeControl struct {
+	Time      time.Duration
+	Inc       time.Duration
+	MovesToGo int
+	MoveTime  time.Duration
+	Overhead  time.Duration
+	Infinite  bool
+
+	// Ponder means we're thinking on the opponent's time: the clock above
+	// only starts running once PonderHit is called.
+	Ponder bool
+}
+
+// TimeManager splits the budget for a move into a soft limit, checked between
+// iterations and scaled by how settled the search looks, and a hard limit the
+// search is aborted at no matter what.
+type TimeManager struct {
+	start    time.Time
+	soft     time.Duration
+	hard     time.Duration
+	infinite bool
+
+	pondering bool
+	ponderHit time.Time
+
+	haveIteration bool
+	prevBest      core.Move
+	prevScore     int
+	stability     int
+	scale         float64
+}
+
+const (
+	defaultMovesToGo = 30
+	maxMovesToGo     = 50
+	minTimeBudget    = time.Millisecond
+)
+
+// scale applied to the soft limit by the number of iterations the best move
+// has survived unchanged
+var stabilityScale = [...]float64{1.6, 1.2, 1.0, 0.85, 0.75, 0.65}
+
+func NewTimeManager(tc TimeControl, start time.Time) *TimeManager {
+	tm := &TimeManager{start: start, scale: 1, pondering: tc.Ponder}
+
+	switch {
+	case tc.Infinite:
+		tm.infinite = true
+	case tc.MoveTime > 0:
+		budget := max(tc.MoveTime-tc.Overhead, minTimeBudget)
+		tm.soft, tm.hard = budget, budget
+	case tc.Time > 0:
+		mtg := defaultMovesToGo
+		if tc.MovesToGo > 0 {
+			mtg = min(tc.MovesToGo, maxMovesToGo)
+		}
+
+		// keep some overhead back for every move still to be played before
+		// the next time control, not just this one
+		avail := tc.Time - tc.Overhead*time.Duration(min(mtg, 10))
+		avail = max(avail, minTimeBudget)
+
+		soft := avail/time.Duration(mtg) + tc.Inc*3/4
+		hard := soft * 4
+		if mtg > 1 {
+			hard = min(hard, avail*3/4)
+		} else {
+			hard = min(hard, avail)
+		}
+
+		tm.hard = max(hard, minTimeBudget)
+		tm.soft = max(min(soft, tm.hard), minTimeBudget)
+	default:
+		tm.infinite = true
+	}
+
+	return tm
+}
+
+func (tm *TimeManager) Elapsed() time.Duration {
+	return time.Since(tm.start)
+}
+
+func (tm *TimeManager) HardLimitReached() bool {
+	if tm.infinite || tm.pondering {
+		return false
+	}
+
+	// our clock only started at the ponderhit
+	clockStart := tm.start
+	if !tm.ponderHit.IsZero() {
+		clockStart = tm.ponderHit
+	}
+	return time.Since(clockStart) >= tm.hard
+}
+
+func (tm *TimeManager) Pondering() bool {
+	return tm.pondering
+}
+
+// PonderHit starts the clock. The soft limit keeps counting from the start of
+// the ponder search, so time spent pondering is credited to this move.
+func (tm *TimeManager) PonderHit(at time.Time) {
+	tm.pondering = false
+	tm.ponderHit = at
+}
+
+// Update feeds the result of a completed iteration into the manager.
+func (tm *TimeManager) Update(best core.Move, score int) {
+	if !tm.haveIteration || best != tm.prevBest {
+		tm.stability = 0
+	} else if tm.stability < len(stabilityScale)-1 {
+		tm.stability++
+	}
+
+	scale := stabilityScale[tm.stability]
+	if tm.haveIteration {
+		// the score dropping means we're probably in trouble, think harder
+		switch drop := tm.prevScore - score; {
+		case drop > 100:
+			scale *= 1.6
+		case drop > 50:
+			scale *= 1.3
+		case drop > 20:
+			scale *= 1.1
+		}
+	}
+
+	tm.scale = scale
+	tm.prevBest = best
+	tm.prevScore = score
+	tm.haveIteration = true
+}
+
+// ShouldStop reports whether another iteration is worth starting.
+func (tm *TimeManager) ShouldStop() bool {
+	if tm.infinite || tm.pondering {
+		return false
+	}
+
+	soft := time.Duration(float64(tm.soft) * tm.scale)
+	return tm.Elapsed() >= min(soft, tm.hard)
+}
@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewTimeManager(t *testing.T) {
+	const ms = time.Millisecond
+	for _, tt := range []struct {
+		name       string
+		tc         TimeControl
+		soft, hard time.Duration
+	}{
+		{"movetime", TimeControl{MoveTime: 1000 * ms}, 1000 * ms, 1000 * ms},
+		{"movetime with overhead", TimeControl{MoveTime: 1000 * ms, Overhead: 50 * ms}, 950 * ms, 950 * ms},
+		{"movetime under the overhead", TimeControl{MoveTime: 30 * ms, Overhead: 50 * ms}, ms, ms},
+
+		// 30 moves to go when the GUI doesn't say, the hard limit four
+		// times the soft one
+		{"sudden death", TimeControl{Time: 60000 * ms}, 2000 * ms, 8000 * ms},
+		{"increment", TimeControl{Time: 60000 * ms, Inc: 1000 * ms}, 2750 * ms, 11000 * ms},
+		{"overhead", TimeControl{Time: 61000 * ms, Overhead: 100 * ms}, 2000 * ms, 8000 * ms},
+
+		// the overhead is kept back for up to ten of the moves to go
+		{"movestogo", TimeControl{Time: 10000 * ms, MovesToGo: 5, Overhead: 100 * ms}, 1900 * ms, 7125 * ms},
+		{"movestogo 100", TimeControl{Time: 50000 * ms, MovesToGo: 100, Overhead: 100 * ms}, 980 * ms, 3920 * ms},
+		// the hard limit is held to 3/4 of the clock, unless it's the last
+		// move before the time control
+		{"movestogo 2", TimeControl{Time: 10000 * ms, MovesToGo: 2}, 5000 * ms, 7500 * ms},
+		{"movestogo 1", TimeControl{Time: 10000 * ms, MovesToGo: 1, Overhead: 100 * ms}, 9900 * ms, 9900 * ms},
+
+		{"flagging", TimeControl{Time: 5 * ms, Overhead: 100 * ms}, ms, ms},
+	} {
+		tm := NewTimeManager(tt.tc, time.Now())
+		if tm.infinite || tm.soft != tt.soft || tm.hard != tt.hard {
+			t.Errorf("%s: soft %v hard %v infinite %v, want %v %v", tt.name, tm.soft, tm.hard, tm.infinite, tt.soft, tt.hard)
+		}
+	}
+
+	for _, tc := range []TimeControl{{}, {Infinite: true}, {Infinite: true, Time: 60 * time.Second}} {
+		if tm := NewTimeManager(tc, time.Now()); !tm.infinite || tm.ShouldStop() || tm.HardLimitReached() {
+			t.Errorf("%+v: not an infinite search", tc)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package engine
+
+import "math"
+
+// Tuning holds the search parameters worth tuning. Every field is exposed as
+// a spin option over UCI so tuners can drive them without rebuilding.
+type Tuning struct {
+	// Reverse futility pruning: the static eval beats beta by a margin
+	RFPDepth  int
+	RFPMargin int
+
+	// Razoring: the static eval is so far below alpha only a tactic saves us
+	RazorDepth  int
+	RazorMargin int
+
+	// Futility pruning of quiet moves at frontier nodes
+	FutilityDepth  int
+	FutilityBase   int
+	FutilityMargin int
+
+	// Late move pruning: stop looking at quiets after this many
+	LMPDepth int
+	LMPBase  int
+
+	// SEE pruning of captures and quiets that lose material
+	SEEPruneDepth    int
+	SEECaptureMargin int
+	SEEQuietMargin   int
+
+	// Singular extension of a TT move that's much better than the rest
+	SingularDepth  int
+	SingularMargin int
+
+	// Late move reductions, in hundredths of a ply: base + ln(depth)*ln(moves)/divisor
+	LMRBase           int
+	LMRDivisor        int
+	LMRHistoryDivisor int
+
+	// Delta pruning in quiescence: captures that can't lift us to alpha
+	QSDeltaMargin int
+}
+
+// TuningParam points at a single field of a Tuning value.
+type TuningParam struct {
+	Name     string
+	Value    *int
+	Min, Max int
+}
+
+func DefaultTuning() Tuning {
+	return Tuning{
+		RFPDepth:  8,
+		RFPMargin: 80,
+
+		RazorDepth:  3,
+		RazorMargin: 250,
+
+		FutilityDepth:  6,
+		FutilityBase:   100,
+		FutilityMargin: 90,
+
+		LMPDepth: 8,
+		LMPBase:  3,
+
+		SEEPruneDepth:    8,
+		SEECaptureMargin: 30,
+		SEEQuietMargin:   60,
+
+		SingularDepth:  7,
+		SingularMargin: 2,
+
+		LMRBase:           75,
+		LMRDivisor:        225,
+		LMRHistoryDivisor: 8192,
+
+		QSDeltaMargin: 200,
+	}
+}
+
+func (t *Tuning) Params() []TuningParam {
+	return []TuningParam{
+		{"RFPDepth", &t.RFPDepth, 0, 16},
+		{"RFPMargin", &t.RFPMargin, 0, 500},
+		{"RazorDepth", &t.RazorDepth, 0, 8},
+		{"RazorMargin", &t.RazorMargin, 0, 1000},
+		{"FutilityDepth", &t.FutilityDepth, 0, 16},
+		{"FutilityBase", &t.FutilityBase, 0, 500},
+		{"FutilityMargin", &t.FutilityMargin, 0, 500},
+		{"LMPDepth", &t.LMPDepth, 0, 16},
+		{"LMPBase", &t.LMPBase, 0, 32},
+		{"SEEPruneDepth", &t.SEEPruneDepth, 0, 16},
+		{"SEECaptureMargin", &t.SEECaptureMargin, 0, 500},
+		{"SEEQuietMargin", &t.SEEQuietMargin, 0, 500},
+		{"SingularDepth", &t.SingularDepth, 0, 32},
+		{"SingularMargin", &t.SingularMargin, 0, 50},
+		{"LMRBase", &t.LMRBase, 0, 300},
+		{"LMRDivisor", &t.LMRDivisor, 50, 1000},
+		{"LMRHistoryDivisor", &t.LMRHistoryDivisor, 100, 100000},
+		{"QSDeltaMargin", &t.QSDeltaMargin, 0, 1000},
+	}
+}
+
+// lmpThreshold is the number of quiets searched at depth before the rest are
+// pruned, fewer when the position isn't improving.
+func (t *Tuning) lmpThreshold(depth int, improving bool) int {
+	threshold := t.LMPBase + depth*depth
+	if !improving {
+		threshold /= 2
+	}
+	return threshold
+}
+
+// reductionTable precomputes the base late move reduction for every depth
+// and move number.
+func (t *Tuning) reductionTable() (table [maxPly][64]int) {
+	for depth := 1; depth < maxPly; depth++ {
+		for moveNum := 1; moveNum < 64; moveNum++ {
+			r := float64(t.LMRBase)/100 + math.Log(float64(depth))*math.Log(float64(moveNum))*100/float64(t.LMRDivisor)
+			table[depth][moveNum] = int(r)
+		}
+	}
+	return table
+}
@@ -0,0 +1,177 @@
+// Package epd reads EPD (Extended Position Description) records, a FEN
+// without the clocks followed by opcodes, the way test suites like WAC and
+// STS and most opening files are written.
+package epd
+
+import (
+	"bufio"
+	"fmt"
+	"gochess/core"
+	"gochess/fen"
+	"gochess/pgn"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Record is one EPD line.
+type Record struct {
+	Board *core.Board
+	Ops   map[string][]string // operands by opcode, quotes taken off strings
+
+	position string // the four FEN fields
+}
+
+// Parse reads one EPD line, e.g.
+//
+//	r1b1k2r/ppppnppp/2n2q2/2b5/3NP3/2P1B3/PP3PPP/RN1QKB1R w KQkq - bm Nb5; id "WAC.042";
+func Parse(line string) (*Record, error) {
+	tokens, err := tokenize(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) < 4 {
+		return nil, fmt.Errorf("not a position: %q", line)
+	}
+
+	r := &Record{Ops: map[string][]string{}, position: strings.Join(tokens[:4], " ")}
+	if r.Board, err = fen.LoadFromFEN(r.position); err != nil {
+		return nil, err
+	}
+
+	opcode := ""
+	for _, token := range tokens[4:] {
+		switch {
+		case token == ";":
+			opcode = ""
+		case opcode == "":
+			opcode = token
+			r.Ops[opcode] = []string{}
+		default:
+			r.Ops[opcode] = append(r.Ops[opcode], token)
+		}
+	}
+	return r, nil
+}
+
+// tokenize splits a line on spaces, keeping quoted strings (without their
+// quotes) and semicolons as tokens of their own.
+func tokenize(line string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == ';':
+			tokens = append(tokens, ";")
+			i++
+		case c == '"':
+			end := strings.IndexByte(line[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, line[i+1:i+1+end])
+			i += end + 2
+		default:
+			j := i
+			for j < len(line) && !strings.ContainsRune(" \t\r\n;", rune(line[j])) {
+				j++
+			}
+			tokens = append(tokens, line[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// FEN is the position as a full FEN, with the clocks from the hmvc and fmvn
+// opcodes if it has them.
+func (r *Record) FEN() string {
+	halfmove, ok := r.Int("hmvc")
+	if !ok {
+		halfmove = 0
+	}
+	fullmove, ok := r.Int("fmvn")
+	if !ok {
+		fullmove = 1
+	}
+	return fmt.Sprintf("%s %d %d", r.position, halfmove, fullmove)
+}
+
+// ID is the id opcode, empty when there's none.
+func (r *Record) ID() string {
+	return strings.Join(r.Ops["id"], " ")
+}
+
+// Int is the first operand of opcode as a number, e.g. for dm.
+func (r *Record) Int(opcode string) (int, bool) {
+	operands := r.Ops[opcode]
+	if len(operands) == 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(operands[0])
+	return n, err == nil
+}
+
+// Moves are the operands of opcode as moves, e.g. for bm and am. They're
+// meant to be in SAN, but coordinate notation is taken too.
+func (r *Record) Moves(opcode string) ([]core.Move, error) {
+	var moves []core.Move
+	for _, s := range r.Ops[opcode] {
+		move, err := r.Move(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", opcode, err)
+		}
+		moves = append(moves, move)
+	}
+	return moves, nil
+}
+
+// Move reads s as a move in the record's position.
+func (r *Record) Move(s string) (core.Move, error) {
+	move, err := pgn.ParseSAN(r.Board, s)
+	if err == nil {
+		return move, nil
+	}
+	for _, legal := range r.Board.GenerateLegalMoves() {
+		if r.Board.ToAlgebraNotation(legal) == s {
+			return legal, nil
+		}
+	}
+	return core.Move{}, err
+}
+
+// Read reads every record from an EPD stream, skipping blank lines and
+// lines starting with #.
+func Read(rd io.Reader) ([]*Record, error) {
+	var records []*Record
+	scanner := bufio.NewScanner(rd)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		r, err := Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// ReadFile reads every record from the EPD file at path.
+func ReadFile(path string) ([]*Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return records, nil
+}
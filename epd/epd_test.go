@@ -0,0 +1,99 @@
+package epd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	r, err := Parse(`r1b1k2r/ppppnppp/2n2q2/2b5/3NP3/2P1B3/PP3PPP/RN1QKB1R w KQkq - bm Nb5 Nf5; am Nxc6; id "WAC.042; with a semicolon"; c0 "two  spaces";`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id := r.ID(); id != "WAC.042; with a semicolon" {
+		t.Errorf("id %q", id)
+	}
+	if c0 := r.Ops["c0"]; !slices.Equal(c0, []string{"two  spaces"}) {
+		t.Errorf("c0 %q", c0)
+	}
+	if bm := r.Ops["bm"]; !slices.Equal(bm, []string{"Nb5", "Nf5"}) {
+		t.Errorf("bm %q", bm)
+	}
+
+	moves, err := r.Moves("bm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 2 || r.Board.ToAlgebraNotation(moves[0]) != "d4b5" || r.Board.ToAlgebraNotation(moves[1]) != "d4f5" {
+		t.Errorf("bm moves %v", moves)
+	}
+	if moves, err := r.Moves("am"); err != nil || len(moves) != 1 || r.Board.ToAlgebraNotation(moves[0]) != "d4c6" {
+		t.Errorf("am moves %v %v", moves, err)
+	}
+
+	// no clocks in the record, so the defaults
+	if f := r.FEN(); f != "r1b1k2r/ppppnppp/2n2q2/2b5/3NP3/2P1B3/PP3PPP/RN1QKB1R w KQkq - 0 1" {
+		t.Errorf("FEN %s", f)
+	}
+}
+
+func TestParseClocks(t *testing.T) {
+	r, err := Parse("4k3/8/8/8/8/8/4P3/4K3 b - - hmvc 12; fmvn 57; dm 3;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := r.FEN(); f != "4k3/8/8/8/8/8/4P3/4K3 b - - 12 57" {
+		t.Errorf("FEN %s", f)
+	}
+	if n, ok := r.Int("dm"); !ok || n != 3 {
+		t.Errorf("dm %d %v", n, ok)
+	}
+	if _, ok := r.Int("pv"); ok {
+		t.Error("Int of a missing opcode")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, line := range []string{
+		"4k3/8/8/8/8/8/4P3/4K3 w -",                     // too short
+		"4k3/8/8/8/8/8/4P3/4K3 x - - bm e4;",            // no such colour
+		`4k3/8/8/8/8/8/4P3/4K3 w - - id "unterminated;`, // string runs off the end
+	} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("%s: parsed", line)
+		}
+	}
+
+	r, err := Parse("4k3/8/8/8/8/8/4P3/4K3 w - - bm e5;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Moves("bm"); err == nil {
+		t.Error("bm e5 isn't legal")
+	}
+}
+
+func TestRead(t *testing.T) {
+	records, err := Read(strings.NewReader(`# a comment
+rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - bm e2e4; id "one";
+
+4k3/8/8/8/8/8/4P3/4K3 w - - bm Kd2 Kf2; id "two";
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].ID() != "one" || records[1].ID() != "two" {
+		t.Fatalf("read %d records", len(records))
+	}
+	// coordinate notation is taken too
+	if moves, err := records[0].Moves("bm"); err != nil || len(moves) != 1 || records[0].Board.ToAlgebraNotation(moves[0]) != "e2e4" {
+		t.Errorf("bm %v %v", moves, err)
+	}
+
+	_, err = Read(strings.NewReader("4k3/8/8/8/8/8/4P3/4K3 w - - bm e4;\n\nnot a position\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("error %v, want one for line 3", err)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gochess/core"
+	"gochess/engine"
+	"gochess/epd"
+	"gochess/pgn"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func epdtestMain(args []string) {
+	if err := runEPDTest(args); err != nil {
+		fmt.Fprintln(os.Stderr, "epdtest:", err)
+		os.Exit(1)
+	}
+}
+
+// suiteResult adds up how the engine did on one file.
+type suiteResult struct {
+	name          string
+	solved, total int
+	solveTime     time.Duration // summed over the solved positions
+	time          time.Duration // over all of them
+	points, max   int           // for STS style c0 scoring
+}
+
+func (s *suiteResult) add(t suiteResult) {
+	s.solved += t.solved
+	s.total += t.total
+	s.solveTime += t.solveTime
+	s.time += t.time
+	s.points += t.points
+	s.max += t.max
+}
+
+func (s suiteResult) String() string {
+	str := fmt.Sprintf("%s: %d/%d solved (%.1f%%), time %.2fs", s.name, s.solved, s.total,
+		100*float64(s.solved)/float64(max(s.total, 1)), s.time.Seconds())
+	if s.solved > 0 {
+		str += fmt.Sprintf(", average time to solution %.3fs", s.solveTime.Seconds()/float64(s.solved))
+	}
+	if s.max > 0 {
+		str += fmt.Sprintf(", score %d/%d (%.1f%%)", s.points, s.max, 100*float64(s.points)/float64(s.max))
+	}
+	return str
+}
+
+func runEPDTest(args []string) error {
+	fs := flag.NewFlagSet("epdtest", flag.ExitOnError)
+	moveTime := fs.Duration("movetime", 0, "time per position, 1s if no limit is given")
+	depth := fs.Int("depth", 0, "depth per position")
+	nodes := fs.Uint64("nodes", 0, "nodes per position")
+	hash := fs.Int("hash", 16, "transposition table size in MB")
+	quiet := fs.Bool("q", false, "only print the totals")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gochess epdtest [options] suite.epd...")
+		fmt.Fprintln(os.Stderr, "positions are solved by playing a bm move, not an am move, and mating within dm moves")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	limits := engine.SearchLimits{Time: engine.TimeControl{MoveTime: *moveTime}, Depth: *depth, Nodes: *nodes}
+	if *moveTime == 0 && *depth == 0 && *nodes == 0 {
+		limits.Time.MoveTime = time.Second
+	}
+
+	e := engine.NewEngine(core.NewBoard())
+	e.TT = engine.NewTranspositionalTable(*hash)
+
+	total := suiteResult{name: "Total"}
+	for _, path := range fs.Args() {
+		records, err := epd.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		suite := suiteResult{name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+		for i, record := range records {
+			id := record.ID()
+			if id == "" {
+				id = fmt.Sprintf("%s #%d", suite.name, i+1)
+			}
+			t, err := newEPDTest(record)
+			if err != nil {
+				return fmt.Errorf("%s: %s: %w", path, id, err)
+			}
+			if t == nil {
+				fmt.Fprintf(os.Stderr, "%s: %s: nothing to test, no bm, am or dm\n", path, id)
+				continue
+			}
+
+			result := t.run(e, limits)
+			suite.add(result.suiteResult)
+			if !*quiet {
+				fmt.Printf("%-20s %s\n", id, result.line)
+			}
+		}
+		fmt.Println(suite)
+		total.add(suite)
+	}
+	if fs.NArg() > 1 {
+		fmt.Println(total)
+	}
+	return nil
+}
+
+// epdTest is what an EPD record asks of the engine.
+type epdTest struct {
+	record *epd.Record
+	best   []core.Move // bm, any of them
+	avoid  []core.Move // am, none of them
+	mate   int         // dm, mate in at most this many moves
+	points map[core.Move]int
+}
+
+// newEPDTest reads the test out of record, nil when it doesn't have one.
+func newEPDTest(record *epd.Record) (*epdTest, error) {
+	t := &epdTest{record: record}
+	var err error
+	if t.best, err = record.Moves("bm"); err != nil {
+		return nil, err
+	}
+	if t.avoid, err = record.Moves("am"); err != nil {
+		return nil, err
+	}
+	t.mate, _ = record.Int("dm")
+
+	// STS gives points for the best few moves, c0 "Qd2=10, Qe2=6, Rc1=3"
+	for _, pair := range strings.Split(strings.Join(record.Ops["c0"], " "), ",") {
+		s, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		if move, err := record.Move(s); err == nil {
+			if t.points == nil {
+				t.points = map[core.Move]int{}
+			}
+			t.points[move] = n
+		}
+	}
+
+	if len(t.best) == 0 && len(t.avoid) == 0 && t.mate <= 0 {
+		return nil, nil
+	}
+	return t, nil
+}
+
+func (t *epdTest) solvedBy(move core.Move, score int) bool {
+	if len(t.best) > 0 && !slices.Contains(t.best, move) {
+		return false
+	}
+	if slices.Contains(t.avoid, move) {
+		return false
+	}
+	return t.mate <= 0 || score >= engine.MateScore-(2*t.mate-1)
+}
+
+type epdResult struct {
+	suiteResult
+	line string
+}
+
+// run searches the position from scratch. It's solved at the start of the
+// run of reported lines, up to the end, that all solve it.
+func (t *epdTest) run(e *engine.Engine, limits engine.SearchLimits) epdResult {
+	board := t.record.Board
+	e.Clear()
+	e.Board = board.Clone()
+
+	solvedAt, solvedDepth := time.Duration(-1), 0
+	e.OnInfo = func(info engine.SearchInfo) {
+		// a fail high or low is only a bound, and its iteration may not
+		// finish, so it says nothing about the line either way
+		if info.MultiPV > 1 || len(info.PV) == 0 || info.Bound != engine.FlagExact {
+			return
+		}
+		switch {
+		case !t.solvedBy(info.PV[0], info.Score):
+			solvedAt = -1
+		case solvedAt < 0:
+			solvedAt, solvedDepth = info.Time, info.Depth
+		}
+	}
+
+	start := time.Now()
+	lines := e.Analyse(limits)
+	elapsed := time.Since(start)
+
+	var r epdResult
+	r.total, r.time = 1, elapsed
+	if len(lines) == 0 {
+		r.line = "no legal moves"
+		return r
+	}
+	move := lines[0].Move
+	san := pgn.SAN(board, move)
+
+	if t.points != nil {
+		r.max = 10
+		r.points = t.points[move]
+	}
+
+	if !t.solvedBy(move, lines[0].Score) {
+		r.line = fmt.Sprintf("unsolved  %-8s %s", san, t.expected())
+		return r
+	}
+	if solvedAt < 0 {
+		// no lines reported, e.g. a single legal move
+		solvedAt = elapsed
+	}
+	r.solved, r.solveTime = 1, solvedAt
+	r.line = fmt.Sprintf("solved    %-8s %.3fs depth %d", san, solvedAt.Seconds(), solvedDepth)
+	return r
+}
+
+// expected describes what would have solved it.
+func (t *epdTest) expected() string {
+	var parts []string
+	board := t.record.Board
+	if len(t.best) > 0 {
+		parts = append(parts, "bm "+sanList(board, t.best))
+	}
+	if len(t.avoid) > 0 {
+		parts = append(parts, "am "+sanList(board, t.avoid))
+	}
+	if t.mate > 0 {
+		parts = append(parts, fmt.Sprintf("dm %d", t.mate))
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+func sanList(board *core.Board, moves []core.Move) string {
+	sans := make([]string, len(moves))
+	for i, move := range moves {
+		sans[i] = pgn.SAN(board, move)
+	}
+	return strings.Join(sans, " ")
+}
@@ -3,6 +3,7 @@ package fen
 import (
 	"fmt"
 	"gochess/core"
+	"strconv"
 	"strings"
 )
 
@@ -110,17 +111,31 @@ func BoardToFEN(board *core.Board) string {
 	return sb.String()
 }
 
+// Clocks are the last two fields of a FEN, which the board doesn't keep.
+type Clocks struct {
+	Halfmove int // plies since the last capture or pawn move
+	Fullmove int // starts at 1, goes up after black moves
+}
+
 func LoadFromFEN(fen string) (*core.Board, error) {
-	parts := strings.Split(fen, " ")
+	board, _, err := Parse(fen)
+	return board, err
+}
+
+// Parse reads a FEN along with its clocks. They're optional, as in EPD,
+// and default to 0 and 1.
+func Parse(fen string) (*core.Board, Clocks, error) {
+	clocks := Clocks{Halfmove: 0, Fullmove: 1}
+	parts := strings.Fields(fen)
 	if len(parts) < 4 {
-		return nil, fmt.Errorf("invalid FEN; not enough fields %s", fen)
+		return nil, clocks, fmt.Errorf("invalid FEN; not enough fields %s", fen)
 	}
 
 	board := core.NewBoard()
 	// 1. Piece placement
 	ranks := strings.Split(parts[0], "/")
 	if len(ranks) != 8 {
-		return nil, fmt.Errorf("invalid FEN: expected 8 ranks")
+		return nil, clocks, fmt.Errorf("invalid FEN: expected 8 ranks")
 	}
 
 	for rank := 7; rank >= 0; rank-- {
@@ -158,14 +173,14 @@ func LoadFromFEN(fen string) (*core.Board, error) {
 			case 'k':
 				piece = core.PieceBlackKing
 			default:
-				return nil, fmt.Errorf("invalid piece char: %c", ch)
+				return nil, clocks, fmt.Errorf("invalid piece char: %c", ch)
 			}
 			sq := rank*8 + file
 			board.AddPiece(core.Position(sq), piece)
 			file++
 		}
 		if file != 8 {
-			return nil, fmt.Errorf("invalid FEN rank: %s", row)
+			return nil, clocks, fmt.Errorf("invalid FEN rank: %s", row)
 		}
 	}
 
@@ -176,7 +191,7 @@ func LoadFromFEN(fen string) (*core.Board, error) {
 	case "b":
 		board.WhiteToMove = false
 	default:
-		return nil, fmt.Errorf("invalid active color: %s", parts[1])
+		return nil, clocks, fmt.Errorf("invalid active color: %s", parts[1])
 	}
 
 	// 3. Castling rights
@@ -193,14 +208,35 @@ func LoadFromFEN(fen string) (*core.Board, error) {
 			case 'q':
 				board.CastlingRights |= core.CastlingBlackQueenside
 			default:
-				return nil, fmt.Errorf("invalid castling right: %c", ch)
+				return nil, clocks, fmt.Errorf("invalid castling right: %c", ch)
 			}
 		}
 	}
 
 	// 4. En passant target
+	if parts[3] != "-" && (len(parts[3]) != 2 || parts[3][0] < 'a' || parts[3][0] > 'h' || parts[3][1] != '3' && parts[3][1] != '6') {
+		return nil, clocks, fmt.Errorf("invalid en passant target: %s", parts[3])
+	}
 	board.EnPassantTarget = squareFromString(parts[3])
-	fmt.Printf("en passant target: %d\n", board.EnPassantTarget)
 
-	return board, nil
+	// 5. and 6. Clocks
+	if len(parts) > 6 {
+		return nil, clocks, fmt.Errorf("invalid FEN; too many fields %s", fen)
+	}
+	if len(parts) > 4 {
+		n, err := strconv.Atoi(parts[4])
+		if err != nil || n < 0 {
+			return nil, clocks, fmt.Errorf("invalid halfmove clock: %s", parts[4])
+		}
+		clocks.Halfmove = n
+	}
+	if len(parts) > 5 {
+		n, err := strconv.Atoi(parts[5])
+		if err != nil || n < 1 {
+			return nil, clocks, fmt.Errorf("invalid fullmove number: %s", parts[5])
+		}
+		clocks.Fullmove = n
+	}
+
+	return board, clocks, nil
 }
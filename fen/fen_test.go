@@ -0,0 +1,71 @@
+package fen
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		fen      string
+		position string
+		clocks   Clocks
+	}{
+		{DefaultFEN(), "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq -", Clocks{0, 1}},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b Kq - 17 40", "r3k2r/8/8/8/8/8/8/R3K2R b Kq -", Clocks{17, 40}},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3", Clocks{0, 1}},
+		// the clocks are optional, as in EPD
+		{"4k3/8/8/8/8/8/4P3/4K3 w - -", "4k3/8/8/8/8/8/4P3/4K3 w - -", Clocks{0, 1}},
+		{"4k3/8/8/8/8/8/4P3/4K3 w - - 9", "4k3/8/8/8/8/8/4P3/4K3 w - -", Clocks{9, 1}},
+		{"  4k3/8/8/8/8/8/4P3/4K3   w - -  3   20 ", "4k3/8/8/8/8/8/4P3/4K3 w - -", Clocks{3, 20}},
+	} {
+		board, clocks, err := Parse(tt.fen)
+		if err != nil {
+			t.Errorf("%q: %v", tt.fen, err)
+			continue
+		}
+		if got := BoardToFEN(board); got != tt.position {
+			t.Errorf("%q: position %s, want %s", tt.fen, got, tt.position)
+		}
+		if clocks != tt.clocks {
+			t.Errorf("%q: clocks %+v, want %+v", tt.fen, clocks, tt.clocks)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"4k3/8/8/8/8/8/4P3/4K3 w -",
+		"4k3/8/8/8/8/8/4P3 w - - 0 1",
+		"4k3/8/8/8/8/8/4P3/4K4 w - - 0 1",
+		"4k3/8/8/8/8/8/4X3/4K3 w - - 0 1",
+		"4k3/8/8/8/8/8/4P3/4K3 x - - 0 1",
+		"4k3/8/8/8/8/8/4P3/4K3 w KX - 0 1",
+		"4k3/8/8/8/8/8/4P3/4K3 w - e4 0 1",
+		"4k3/8/8/8/8/8/4P3/4K3 w - - -1 1",
+		"4k3/8/8/8/8/8/4P3/4K3 w - - 0 0",
+		"4k3/8/8/8/8/8/4P3/4K3 w - - a 1",
+		// anything after the clocks, EPD opcodes included
+		"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1 bm Kd2;",
+		"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1 x",
+	} {
+		if _, _, err := Parse(s); err == nil {
+			t.Errorf("%q: parsed", s)
+		}
+	}
+}
+
+// BoardToFEN leaves the clocks off, which LoadFromFEN fills back in.
+func TestRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6",
+		"r3k2r/8/8/8/8/8/8/R3K2R b Qk -",
+		"8/8/8/8/8/8/8/k1K5 w - -",
+	} {
+		board, err := LoadFromFEN(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := BoardToFEN(board); got != s {
+			t.Errorf("%s came back as %s", s, got)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package game
 
 import (
+	"fmt"
+	"gochess/book"
 	"gochess/core"
 	"gochess/engine"
 	"gochess/fen"
@@ -46,11 +48,22 @@ type Game struct {
 	prevMoveTo   int
 	mouseX       float64
 	mouseY       float64
+	skill        engine.Skill
+	book         *book.Book
 }
 
+// BookFile is the Polyglot book the engine plays its openings from, when
+// there is one.
+var BookFile = "book.bin"
+
 func NewGame(board *core.Board) *Game {
 	eng := engine.NewEngine(board)
-	game := &Game{Board: board, selected: -1, engine: eng}
+	game := &Game{Board: board, selected: -1, engine: eng, skill: engine.FullStrength()}
+	if bk, err := book.Open(BookFile); err == nil {
+		game.book = bk
+		eng.Book = bk
+	}
+	game.updateTitle()
 
 	// go (func() {
 	// 	time.Sleep(time.Second)
@@ -113,6 +126,7 @@ func (g *Game) Update() error {
 
 				go (func() {
 					g.engine.Board = g.Board.Clone()
+					g.engine.Skill = g.skill
 					bestMove := g.engine.FindBestMove(time.Millisecond*500, true)
 					if bestMove != nil {
 						g.Board.Push(bestMove)
@@ -141,15 +155,27 @@ func (g *Game) Update() error {
 		}
 	} else if inpututil.IsKeyJustPressed(ebiten.KeyU) {
 		g.engine = engine.NewEngine(g.Board.Clone())
+		g.engine.Skill = g.skill
+		g.engine.Book = g.book
 		bestMove := g.engine.FindBestMove(time.Millisecond*1000, true)
 		if bestMove != nil {
 			g.Board.Push(bestMove)
 		}
 	}
 
+	// Up/Down change how strong the engine plays
+	if inpututil.IsKeyJustPressed(ebiten.KeyArrowUp) && g.skill.Level < engine.MaxSkillLevel {
+		g.skill.Level++
+		g.updateTitle()
+	} else if inpututil.IsKeyJustPressed(ebiten.KeyArrowDown) && g.skill.Level > 0 {
+		g.skill.Level--
+		g.updateTitle()
+	}
+
 	if inpututil.IsKeyJustPressed(ebiten.KeyR) {
 		g.Board, _ = fen.LoadFromFEN(fen.DefaultFEN())
 		g.engine = engine.NewEngine(g.Board)
+		g.engine.Book = g.book
 		g.selected = -1
 		g.dragging = false
 		g.dragStart = -1
@@ -160,6 +186,14 @@ func (g *Game) Update() error {
 	return nil
 }
 
+func (g *Game) updateTitle() {
+	if g.skill.Enabled() {
+		ebiten.SetWindowTitle(fmt.Sprintf("gochess - skill %d", g.skill.Level))
+	} else {
+		ebiten.SetWindowTitle("gochess - full strength")
+	}
+}
+
 func (g *Game) Draw(screen *ebiten.Image) {
 	for y := 0; y < BOARD_SIZE; y++ {
 		for x := 0; x < BOARD_SIZE; x++ {
@@ -6,6 +6,7 @@ import (
 	"gochess/game"
 	"gochess/uci"
 	"log"
+	"os"
 
 	"github.com/hajimehoshi/ebiten/v2"
 )
@@ -19,6 +20,29 @@ func sqToPen(sq core.Position) string {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "book":
+			bookMain(os.Args[2:])
+			return
+		case "tablebase":
+			tablebaseMain(os.Args[2:])
+			return
+		case "match":
+			matchMain(os.Args[2:])
+			return
+		case "epdtest":
+			epdtestMain(os.Args[2:])
+			return
+		case "bench":
+			benchMain(os.Args[2:])
+			return
+		case "datagen":
+			datagenMain(os.Args[2:])
+			return
+		}
+	}
+
 	uci.RunUCI()
 
 	// board, err := fen.LoadFromFEN(FEN)
@@ -31,7 +55,6 @@ func main() {
 func play(board *core.Board) {
 	game.Init()
 	game := game.NewGame(board)
-	ebiten.SetWindowTitle("hi")
 	ebiten.SetWindowSize(45*8, 45*8)
 	if err := ebiten.RunGame(game); err != nil {
 		log.Fatal(err)
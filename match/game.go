@@ -0,0 +1,315 @@
+package match
+
+import (
+	"gochess/core"
+	"gochess/fen"
+	"gochess/pgn"
+	"math/bits"
+	"strconv"
+	"time"
+)
+
+// TimeControl is how long the players get. Time and Inc make a clock, reset
+// every Moves moves when Moves is set. MoveTime, Nodes and Depth are fixed
+// per move limits and can go with or without one.
+type TimeControl struct {
+	Moves    int
+	Time     time.Duration
+	Inc      time.Duration
+	MoveTime time.Duration
+	Nodes    uint64
+	Depth    int
+}
+
+// Adjudication ends games early on the players' scores. A count of 0
+// leaves that kind of adjudication off.
+type Adjudication struct {
+	// a draw once both sides have scored within DrawScore of 0 for
+	// DrawMoveCount moves in a row, from move DrawMoveNumber on
+	DrawMoveNumber int
+	DrawMoveCount  int
+	DrawScore      int
+
+	// a loss once a side has scored -ResignScore or worse for
+	// ResignMoveCount moves in a row, and the other side agrees
+	ResignMoveCount int
+	ResignScore     int
+}
+
+// GameConfig is what every game of a match is played under.
+type GameConfig struct {
+	TimeControl  TimeControl
+	Adjudication Adjudication
+	TimeMargin   time.Duration // over the clock before it counts as lost on time
+}
+
+// Result is how a game ended.
+type Result struct {
+	Score  string // "1-0", "0-1" or "1/2-1/2"
+	Reason string // e.g. "White mates" or "Black loses on time"
+	Game   *pgn.Game
+
+	// the players' replies in order, one for each move after the opening
+	Replies []Reply
+
+	failed Player // the player that went away, to be started again
+}
+
+// game is a game being played: the position, and what the rules and the
+// adjudication need to know about how it got there.
+type game struct {
+	config  GameConfig
+	opening Opening
+	board   *core.Board
+	moves   []core.Move
+	sans    []string
+	replies []Reply
+
+	moveNumber  int
+	halfmoves   int      // since the last capture or pawn move
+	hashes      []uint64 // of the positions since then
+	drawPlies   int
+	resignPlies [2]int // by the side that would resign
+	winPlies    [2]int // by the side that would win
+}
+
+// Play plays out one game from opening, white moving first after it.
+func Play(white, black Player, opening Opening, config GameConfig) (*Result, error) {
+	board, clocks, err := fen.Parse(opening.FEN)
+	if err != nil {
+		return nil, err
+	}
+	g := &game{config: config, opening: opening, board: board, moveNumber: clocks.Fullmove, halfmoves: clocks.Halfmove}
+	g.hashes = append(g.hashes, board.ComputeZobristHash())
+	for _, move := range opening.Moves {
+		g.push(move)
+	}
+
+	result := g.play(white, black)
+	result.Game = g.pgn(white.Name(), black.Name(), result)
+	result.Replies = g.replies
+	return result, nil
+}
+
+func (g *game) play(white, black Player) *Result {
+	tc := g.config.TimeControl
+	clocks := [2]time.Duration{tc.Time, tc.Time}
+	movesMade := [2]int{}
+
+	for {
+		if result := g.rules(); result != nil {
+			return result
+		}
+
+		side := 0
+		player := white
+		if !g.board.WhiteToMove {
+			side, player = 1, black
+		}
+
+		limits := Limits{MoveTime: tc.MoveTime, Nodes: tc.Nodes, Depth: tc.Depth}
+		if tc.Time > 0 {
+			limits.WTime, limits.BTime = clocks[0], clocks[1]
+			limits.WInc, limits.BInc = tc.Inc, tc.Inc
+			if tc.Moves > 0 {
+				limits.MovesToGo = tc.Moves - movesMade[side]%tc.Moves
+			}
+		}
+
+		start := time.Now()
+		reply, err := player.Play(Position{FEN: g.opening.FEN, Moves: g.moves, Board: g.board}, limits)
+		elapsed := time.Since(start)
+		if err != nil {
+			result := g.loss(side, "disconnects")
+			result.failed = player
+			return result
+		}
+		if !g.board.IsMoveLegal(reply.Move) {
+			return g.loss(side, "makes an illegal move")
+		}
+
+		switch {
+		case tc.Time > 0:
+			clocks[side] -= elapsed
+			if clocks[side] < -g.config.TimeMargin {
+				return g.loss(side, "loses on time")
+			}
+			clocks[side] += tc.Inc
+			movesMade[side]++
+			if tc.Moves > 0 && movesMade[side]%tc.Moves == 0 {
+				clocks[side] += tc.Time
+			}
+		case tc.MoveTime > 0:
+			if elapsed > tc.MoveTime+g.config.TimeMargin {
+				return g.loss(side, "loses on time")
+			}
+		}
+
+		g.push(reply.Move)
+		g.replies = append(g.replies, reply)
+		if reply.Depth == 0 {
+			continue // no search, so the score means nothing, e.g. a forced move
+		}
+		if result := g.adjudicate(side, reply.Score); result != nil {
+			return result
+		}
+	}
+}
+
+func (g *game) push(move core.Move) {
+	g.sans = append(g.sans, pgn.SAN(g.board, move))
+	g.moves = append(g.moves, move)
+
+	zeroing := g.board.Pieces[move.To] != core.PieceNone || g.board.Pieces[move.From].Type() == core.PieceTypePawn
+	if !g.board.WhiteToMove {
+		g.moveNumber++
+	}
+	g.board.Push(&move)
+
+	if zeroing {
+		g.halfmoves = 0
+		g.hashes = g.hashes[:0]
+	} else {
+		g.halfmoves++
+	}
+	g.hashes = append(g.hashes, g.board.ComputeZobristHash())
+}
+
+// rules ends the game when the position on the board does.
+func (g *game) rules() *Result {
+	if len(g.board.GenerateLegalMoves()) == 0 {
+		if !g.board.InCheck(g.board.WhiteToMove) {
+			return draw("stalemate")
+		}
+		if g.board.WhiteToMove {
+			return &Result{Score: "0-1", Reason: "Black mates"}
+		}
+		return &Result{Score: "1-0", Reason: "White mates"}
+	}
+
+	hash := g.hashes[len(g.hashes)-1]
+	repeats := 0
+	for _, h := range g.hashes {
+		if h == hash {
+			repeats++
+		}
+	}
+	switch {
+	case repeats >= 3:
+		return draw("3-fold repetition")
+	case g.halfmoves >= 100:
+		return draw("fifty moves rule")
+	case insufficientMaterial(g.board):
+		return draw("insufficient mating material")
+	}
+	return nil
+}
+
+// insufficientMaterial is whether neither side can ever mate: bare kings,
+// a single minor piece, or bishops that all stand on one colour.
+func insufficientMaterial(b *core.Board) bool {
+	var knights, bishops core.Bitboard
+	for colour := range 2 {
+		pieces := b.PieceBitboards[colour]
+		if pieces[core.PieceTypePawn-1]|pieces[core.PieceTypeRook-1]|pieces[core.PieceTypeQueen-1] != 0 {
+			return false
+		}
+		knights |= pieces[core.PieceTypeKnight-1]
+		bishops |= pieces[core.PieceTypeBishop-1]
+	}
+
+	const darkSquares = 0xaa55aa55aa55aa55
+	minors := bits.OnesCount64(uint64(knights | bishops))
+	return minors <= 1 ||
+		knights == 0 && (bishops&darkSquares == 0 || bishops&^darkSquares == 0)
+}
+
+// adjudicate looks at the score side gave for the move it just made.
+func (g *game) adjudicate(side, score int) *Result {
+	adj := g.config.Adjudication
+
+	if adj.DrawMoveCount > 0 {
+		if abs(score) <= adj.DrawScore {
+			g.drawPlies++
+		} else {
+			g.drawPlies = 0
+		}
+		if g.moveNumber >= adj.DrawMoveNumber && g.drawPlies >= 2*adj.DrawMoveCount {
+			return draw("adjudication")
+		}
+	}
+
+	if adj.ResignMoveCount > 0 {
+		g.resignPlies[side] = streak(g.resignPlies[side], score <= -adj.ResignScore)
+		g.winPlies[side] = streak(g.winPlies[side], score >= adj.ResignScore)
+		for loser := range 2 {
+			if g.resignPlies[loser] >= adj.ResignMoveCount && g.winPlies[1-loser] >= adj.ResignMoveCount {
+				return g.loss(loser, "resigns")
+			}
+		}
+	}
+	return nil
+}
+
+func streak(n int, ok bool) int {
+	if ok {
+		return n + 1
+	}
+	return 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func draw(reason string) *Result {
+	return &Result{Score: "1/2-1/2", Reason: "Draw by " + reason}
+}
+
+func (g *game) loss(side int, reason string) *Result {
+	if side == 0 {
+		return &Result{Score: "0-1", Reason: "White " + reason}
+	}
+	return &Result{Score: "1-0", Reason: "Black " + reason}
+}
+
+func (g *game) pgn(white, black string, result *Result) *pgn.Game {
+	game := &pgn.Game{
+		Tags: map[string]string{
+			"Event":       "gochess match",
+			"Site":        "?",
+			"Date":        time.Now().Format("2006.01.02"),
+			"Round":       "?",
+			"White":       white,
+			"Black":       black,
+			"Result":      result.Score,
+			"PlyCount":    strconv.Itoa(len(g.sans)),
+			"Termination": termination(result.Reason),
+		},
+		Moves:  g.sans,
+		Result: result.Score,
+	}
+	if g.opening.FEN != fen.DefaultFEN() {
+		game.Tags["FEN"] = g.opening.FEN
+		game.Tags["SetUp"] = "1"
+	}
+	return game
+}
+
+// termination is the PGN Termination tag for a game that ended for reason.
+func termination(reason string) string {
+	switch reason {
+	case "Draw by adjudication", "White resigns", "Black resigns":
+		return "adjudication"
+	case "White loses on time", "Black loses on time":
+		return "time forfeit"
+	case "White disconnects", "Black disconnects":
+		return "abandoned"
+	case "White makes an illegal move", "Black makes an illegal move":
+		return "rules infraction"
+	}
+	return "normal"
+}
@@ -0,0 +1,47 @@
+package match
+
+import (
+	"gochess/fen"
+	"testing"
+)
+
+// firstMove plays the first legal move, with a made up score and depth.
+type firstMove struct {
+	score, depth int
+}
+
+func (p *firstMove) Name() string   { return "first" }
+func (p *firstMove) NewGame() error { return nil }
+func (p *firstMove) Close() error   { return nil }
+
+func (p *firstMove) Play(pos Position, limits Limits) (Reply, error) {
+	return Reply{Move: pos.Board.GenerateLegalMoves()[0], Score: p.score, Depth: p.depth}, nil
+}
+
+func TestAdjudicateSkipsUnsearchedReplies(t *testing.T) {
+	config := GameConfig{
+		TimeControl: TimeControl{Depth: 1},
+		Adjudication: Adjudication{
+			DrawMoveCount: 1, DrawScore: 10,
+			ResignMoveCount: 1, ResignScore: 500,
+		},
+	}
+	for _, tt := range []struct {
+		white, black firstMove
+		adjudicated  string
+	}{
+		{firstMove{0, 1}, firstMove{0, 1}, "Draw by adjudication"},
+		{firstMove{-900, 1}, firstMove{900, 1}, "White resigns"},
+		{firstMove{0, 0}, firstMove{0, 0}, ""},
+		{firstMove{-900, 0}, firstMove{900, 5}, ""},
+	} {
+		result, err := Play(&tt.white, &tt.black, Opening{FEN: fen.DefaultFEN()}, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		adjudicated := termination(result.Reason) == "adjudication"
+		if adjudicated != (tt.adjudicated != "") || adjudicated && result.Reason != tt.adjudicated {
+			t.Errorf("%v against %v: %s after %d replies, want %q", tt.white, tt.black, result.Reason, len(result.Replies), tt.adjudicated)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package match
+
+import (
+	"fmt"
+	"gochess/fen"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+)
+
+// EngineConfig is how to get one of the engines going: in this process when
+// Command is empty, otherwise by running Command as a UCI engine. Options
+// are UCI option names and values either way.
+type EngineConfig struct {
+	Name    string
+	Command string
+	Options map[string]string
+}
+
+func (c EngineConfig) Start() (Player, error) {
+	// careful not to hand back a nil pointer in a non-nil interface
+	if c.Command == "" {
+		p, err := NewEnginePlayer(c.Name, c.Options)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	p, err := StartUCIPlayer(c.Name, c.Command, c.Options)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Match plays the first engine against the second. Each opening is played
+// twice in a row, once with either engine as white, going round the list
+// again if there are more games than openings.
+type Match struct {
+	Engines     [2]EngineConfig
+	Openings    []Opening // just the starting position when there are none
+	Games       int
+	Concurrency int // games played at once
+	Config      GameConfig
+	SPRT        *SPRT // stops the match once it decides, if set
+
+	PGN            io.Writer // gets every game as it finishes, if set
+	Log            io.Writer // gets the results and the running score
+	RatingInterval int       // games between Elo reports, 0 for only at the end
+}
+
+// finished is a game off one of the workers.
+type finished struct {
+	round  int
+	result *Result
+	err    error // the game couldn't be played at all
+}
+
+// Run plays the match and returns the first engine's score. It stops early
+// when the SPRT decides, or when an engine can't be started.
+func (m *Match) Run() (Score, error) {
+	if m.Log == nil {
+		m.Log = io.Discard
+	}
+
+	rounds := make(chan int)
+	results := make(chan finished)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	stopMatch := func() { stopOnce.Do(func() { close(stop) }) }
+
+	go func() {
+		defer close(rounds)
+		for round := range m.Games {
+			select {
+			case rounds <- round:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range max(m.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.worker(rounds, results)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var score Score
+	var err error
+	decided := false
+	for f := range results {
+		if f.err != nil {
+			if err == nil {
+				err = f.err
+			}
+			stopMatch()
+			continue
+		}
+
+		m.record(f, &score)
+		if m.RatingInterval > 0 && score.Games()%m.RatingInterval == 0 {
+			m.printRating(score)
+		}
+		if m.SPRT != nil && !decided {
+			switch m.SPRT.Decide(score) {
+			case 1:
+				fmt.Fprintln(m.Log, "SPRT: H1 was accepted")
+				decided = true
+			case -1:
+				fmt.Fprintln(m.Log, "SPRT: H0 was accepted")
+				decided = true
+			}
+			if decided {
+				stopMatch() // the games still going get finished and counted
+			}
+		}
+	}
+
+	if m.RatingInterval == 0 || score.Games()%m.RatingInterval != 0 {
+		m.printRating(score)
+	}
+	return score, err
+}
+
+// worker plays the rounds it's handed with its own pair of players, starting
+// an engine again if it went away during a game.
+func (m *Match) worker(rounds <-chan int, results chan<- finished) {
+	var players [2]Player
+	defer func() {
+		for _, p := range players {
+			if p != nil {
+				p.Close()
+			}
+		}
+	}()
+
+	openings := m.Openings
+	if len(openings) == 0 {
+		openings = []Opening{{FEN: fen.DefaultFEN()}}
+	}
+
+	for round := range rounds {
+		for i := range players {
+			if players[i] != nil {
+				if players[i].NewGame() == nil {
+					continue
+				}
+				players[i].Close()
+			}
+			p, err := m.Engines[i].Start()
+			players[i] = p
+			if err != nil {
+				results <- finished{round: round, err: err}
+				return
+			}
+			if err := p.NewGame(); err != nil {
+				results <- finished{round: round, err: err}
+				return
+			}
+		}
+
+		// the first engine is white in the first game of each pair
+		white, black := players[0], players[1]
+		if round%2 == 1 {
+			white, black = black, white
+		}
+		result, err := Play(white, black, openings[round/2%len(openings)], m.Config)
+		if err != nil {
+			results <- finished{round: round, err: err}
+			return
+		}
+
+		if result.failed != nil {
+			for i := range players {
+				if players[i] == result.failed {
+					players[i].Close()
+					players[i] = nil
+				}
+			}
+		}
+		results <- finished{round: round, result: result}
+	}
+}
+
+// record counts a finished game and reports it.
+func (m *Match) record(f finished, score *Score) {
+	result := f.result
+	game := result.Game
+	game.Tags["Round"] = strconv.Itoa(f.round + 1)
+
+	firstIsWhite := f.round%2 == 0
+	switch {
+	case result.Score == "1/2-1/2":
+		score.Draws++
+	case (result.Score == "1-0") == firstIsWhite:
+		score.Wins++
+	default:
+		score.Losses++
+	}
+
+	fmt.Fprintf(m.Log, "Finished game %d (%s vs %s): %s {%s}\n",
+		f.round+1, game.Tags["White"], game.Tags["Black"], result.Score, result.Reason)
+	fmt.Fprintf(m.Log, "Score of %s vs %s: %v\n", m.Engines[0].Name, m.Engines[1].Name, *score)
+
+	if m.PGN != nil {
+		if err := game.Write(m.PGN); err != nil {
+			fmt.Fprintf(m.Log, "can't write PGN: %v\n", err)
+		}
+	}
+}
+
+func (m *Match) printRating(score Score) {
+	elo, margin := score.Elo()
+	if math.IsInf(elo, 0) || math.IsInf(margin, 0) || math.IsNaN(margin) {
+		fmt.Fprintf(m.Log, "Elo difference: %.1f, LOS: %.1f %%, DrawRatio: %.1f %%\n",
+			elo, 100*score.LOS(), 100*score.DrawRatio())
+	} else {
+		fmt.Fprintf(m.Log, "Elo difference: %.1f +/- %.1f, LOS: %.1f %%, DrawRatio: %.1f %%\n",
+			elo, margin, 100*score.LOS(), 100*score.DrawRatio())
+	}
+
+	if m.SPRT != nil {
+		llr := m.SPRT.LLR(score)
+		lower, upper := m.SPRT.Bounds()
+		// how far towards either bound it's got
+		progress := llr / upper
+		if llr < 0 {
+			progress = llr / lower
+		}
+		fmt.Fprintf(m.Log, "SPRT: llr %.3f (%.1f%%), lbound %.2f, ubound %.2f\n",
+			llr, 100*progress, lower, upper)
+	}
+}
@@ -0,0 +1,87 @@
+package match
+
+import (
+	"fmt"
+	"gochess/core"
+	"gochess/epd"
+	"gochess/fen"
+	"gochess/pgn"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Opening is where a pair of games starts: a position, and moves played
+// from it before the players take over.
+type Opening struct {
+	FEN   string
+	Moves []core.Move
+}
+
+// LoadOpenings reads openings from an EPD file, one position per line, or
+// from a PGN file (by the .pgn extension), where the first plies moves of
+// each game make the opening.
+func LoadOpenings(path string, plies int) ([]Opening, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var openings []Opening
+	if strings.EqualFold(filepath.Ext(path), ".pgn") {
+		openings, err = pgnOpenings(f, plies)
+	} else {
+		openings, err = epdOpenings(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(openings) == 0 {
+		return nil, fmt.Errorf("%s: no openings", path)
+	}
+	return openings, nil
+}
+
+func epdOpenings(r io.Reader) ([]Opening, error) {
+	records, err := epd.Read(r)
+	if err != nil {
+		return nil, err
+	}
+	openings := make([]Opening, len(records))
+	for i, record := range records {
+		openings[i] = Opening{FEN: record.FEN()}
+	}
+	return openings, nil
+}
+
+func pgnOpenings(r io.Reader, plies int) ([]Opening, error) {
+	var openings []Opening
+	reader := pgn.NewReader(r)
+	for {
+		game, err := reader.Next()
+		if err == io.EOF {
+			return openings, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		opening := Opening{FEN: fen.DefaultFEN()}
+		if f, ok := game.Tags["FEN"]; ok {
+			opening.FEN = f
+		}
+		_, err = game.Replay(func(board *core.Board, move core.Move) bool {
+			if len(opening.Moves) >= plies {
+				return false
+			}
+			opening.Moves = append(opening.Moves, move)
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("game %d: %w", len(openings)+1, err)
+		}
+		openings = append(openings, opening)
+	}
+}
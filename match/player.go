@@ -0,0 +1,160 @@
+// Package match plays engines against each other, in-process or as UCI
+// subprocesses, from paired openings, and keeps score with Elo estimates and
+// an SPRT stopping rule.
+package match
+
+import (
+	"fmt"
+	"gochess/core"
+	"gochess/engine"
+	"gochess/syzygy"
+	"gochess/tablebase"
+	"strconv"
+	"time"
+)
+
+// Position is what a player is asked to move in: where the game started,
+// the moves since and the board they lead to. Players mustn't change Board.
+type Position struct {
+	FEN   string
+	Moves []core.Move
+	Board *core.Board
+}
+
+// Limits are the clocks and search limits for one move. Zero means not set.
+type Limits struct {
+	WTime, BTime time.Duration
+	WInc, BInc   time.Duration
+	MovesToGo    int
+	MoveTime     time.Duration
+	Nodes        uint64
+	Depth        int
+}
+
+// Reply is a player's move with what its search thought of it.
+type Reply struct {
+	Move  core.Move
+	Score int // side to move's view, engine scale: mates near engine.MateScore
+	Depth int // 0 when there was no search to score the move, e.g. it was the only one
+}
+
+// Player is one side of a game. Each player is only used by one game at a
+// time.
+type Player interface {
+	Name() string
+	NewGame() error
+	Play(pos Position, limits Limits) (Reply, error)
+	Close() error
+}
+
+// EnginePlayer runs the engine in this process.
+type EnginePlayer struct {
+	name     string
+	engine   *engine.Engine
+	overhead time.Duration
+}
+
+const defaultHash = 16
+
+// NewEnginePlayer sets up an in-process engine. Options take the names and
+// values of the UCI options: Hash, Evaluator, Skill Level, Move Overhead,
+// TablebasePath, SyzygyPath, SyzygyProbeLimit and the tuning parameters.
+func NewEnginePlayer(name string, options map[string]string) (*EnginePlayer, error) {
+	e := engine.NewEngine(core.NewBoard())
+	e.TT = engine.NewTranspositionalTable(defaultHash)
+	e.SyzygyProbeLimit = 7
+	p := &EnginePlayer{name: name, engine: e, overhead: 10 * time.Millisecond}
+
+	for option, value := range options {
+		var n int
+		var err error
+		switch option {
+		case "Evaluator", "TablebasePath", "SyzygyPath":
+		default:
+			if n, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("%s: option %s: %q isn't a number", name, option, value)
+			}
+		}
+
+		switch option {
+		case "Hash":
+			e.TT = engine.NewTranspositionalTable(n)
+		case "Evaluator":
+			eval, ok := engine.NewEvaluator(value)
+			if !ok {
+				return nil, fmt.Errorf("%s: no evaluator %q", name, value)
+			}
+			e.Eval = eval
+		case "Skill Level":
+			e.Skill = engine.Skill{Level: min(max(n, 0), engine.MaxSkillLevel)}
+		case "Move Overhead":
+			p.overhead = time.Duration(n) * time.Millisecond
+		case "TablebasePath":
+			if e.Tablebases, err = tablebase.Open(value); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		case "SyzygyPath":
+			if e.Syzygy, err = syzygy.Open(value); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		case "SyzygyProbeLimit":
+			e.SyzygyProbeLimit = n
+		default:
+			if !setTuning(&e.Tuning, option, n) {
+				return nil, fmt.Errorf("%s: unknown option %q", name, option)
+			}
+		}
+	}
+	return p, nil
+}
+
+func setTuning(t *engine.Tuning, name string, value int) bool {
+	for _, param := range t.Params() {
+		if param.Name == name {
+			*param.Value = min(max(value, param.Min), param.Max)
+			return true
+		}
+	}
+	return false
+}
+
+func (p *EnginePlayer) Name() string {
+	return p.name
+}
+
+func (p *EnginePlayer) NewGame() error {
+	p.engine.Clear()
+	return nil
+}
+
+func (p *EnginePlayer) Play(pos Position, limits Limits) (Reply, error) {
+	var reply Reply
+	e := p.engine
+	e.Board = pos.Board.Clone()
+	e.OnInfo = func(info engine.SearchInfo) {
+		if info.MultiPV <= 1 {
+			reply.Score, reply.Depth = info.Score, info.Depth
+		}
+	}
+
+	tc := engine.TimeControl{
+		Time:      limits.WTime,
+		Inc:       limits.WInc,
+		MovesToGo: limits.MovesToGo,
+		MoveTime:  limits.MoveTime,
+		Overhead:  p.overhead,
+	}
+	if !pos.Board.WhiteToMove {
+		tc.Time, tc.Inc = limits.BTime, limits.BInc
+	}
+	move := e.Search(engine.SearchLimits{Time: tc, Depth: limits.Depth, Nodes: limits.Nodes})
+	if move == nil {
+		return reply, fmt.Errorf("%s: no move", p.name)
+	}
+	reply.Move = *move
+	return reply, nil
+}
+
+func (p *EnginePlayer) Close() error {
+	return nil
+}
@@ -0,0 +1,113 @@
+package match
+
+import (
+	"fmt"
+	"math"
+)
+
+// Score is a match result from the first engine's side.
+type Score struct {
+	Wins, Losses, Draws int
+}
+
+func (s Score) Games() int {
+	return s.Wins + s.Losses + s.Draws
+}
+
+// Ratio is the share of the points the first engine got.
+func (s Score) Ratio() float64 {
+	if s.Games() == 0 {
+		return 0.5
+	}
+	return (float64(s.Wins) + float64(s.Draws)/2) / float64(s.Games())
+}
+
+// variance of a single game's result, per game
+func (s Score) variance() float64 {
+	n := float64(s.Games())
+	if n == 0 {
+		return 0
+	}
+	mu := s.Ratio()
+	return (float64(s.Wins)*(1-mu)*(1-mu) +
+		float64(s.Losses)*mu*mu +
+		float64(s.Draws)*(0.5-mu)*(0.5-mu)) / n
+}
+
+// eloDiff is the Elo difference a score ratio stands for.
+func eloDiff(ratio float64) float64 {
+	return 400 * math.Log10(ratio/(1-ratio))
+}
+
+// Elo is the first engine's estimated Elo advantage with the margin of a
+// 95% confidence interval. The Elo is infinite while it has won or lost
+// every game, and the margin is NaN while every game has had the same
+// result, there's no spread to go on yet.
+func (s Score) Elo() (elo, margin float64) {
+	mu := s.Ratio()
+	elo = eloDiff(mu)
+
+	v := s.variance()
+	if v == 0 {
+		return elo, math.NaN()
+	}
+	dev := 1.959964 * math.Sqrt(v/float64(max(s.Games(), 1)))
+	low, high := eloDiff(max(mu-dev, 0)), eloDiff(min(mu+dev, 1))
+	return elo, (high - low) / 2
+}
+
+// LOS is the likelihood of superiority, the chance the first engine really is
+// the stronger one, from its wins and losses.
+func (s Score) LOS() float64 {
+	if s.Wins+s.Losses == 0 {
+		return 0.5
+	}
+	return 0.5 * (1 + math.Erf(float64(s.Wins-s.Losses)/math.Sqrt(2*float64(s.Wins+s.Losses))))
+}
+
+func (s Score) DrawRatio() float64 {
+	return float64(s.Draws) / float64(max(s.Games(), 1))
+}
+
+func (s Score) String() string {
+	return fmt.Sprintf("%d - %d - %d  [%.3f] %d", s.Wins, s.Losses, s.Draws, s.Ratio(), s.Games())
+}
+
+// SPRT is a sequential probability ratio test of H0, the first engine is
+// Elo0 better, against H1, it's Elo1 better, with false positive rate Alpha
+// and false negative rate Beta.
+type SPRT struct {
+	Elo0, Elo1  float64
+	Alpha, Beta float64
+}
+
+// LLR is the log likelihood ratio of H1 to H0 after s, using the normal
+// approximation of the trinomial (win/draw/loss) distribution.
+func (t SPRT) LLR(s Score) float64 {
+	v := s.variance()
+	if v == 0 {
+		return 0 // everything the same result so far, can't tell yet
+	}
+	s0 := 1 / (1 + math.Pow(10, -t.Elo0/400))
+	s1 := 1 / (1 + math.Pow(10, -t.Elo1/400))
+	return (s1 - s0) * (2*s.Ratio() - s0 - s1) * float64(s.Games()) / (2 * v)
+}
+
+// Bounds are the LLRs at which H0 (lower) or H1 (upper) gets accepted.
+func (t SPRT) Bounds() (lower, upper float64) {
+	return math.Log(t.Beta / (1 - t.Alpha)), math.Log((1 - t.Beta) / t.Alpha)
+}
+
+// Decide returns 1 once H1 is accepted, -1 once H0 is, 0 while the test
+// has to go on.
+func (t SPRT) Decide(s Score) int {
+	llr := t.LLR(s)
+	lower, upper := t.Bounds()
+	switch {
+	case llr >= upper:
+		return 1
+	case llr <= lower:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,103 @@
+package match
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func near(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance
+}
+
+func TestElo(t *testing.T) {
+	for _, tt := range []struct {
+		score     Score
+		elo, plus float64
+	}{
+		// a 75% score is 400*log10(3) Elo
+		{Score{Wins: 75, Losses: 25}, 190.849, 81.151},
+		{Score{Wins: 60, Losses: 40}, 70.437, 70.571},
+		{Score{Wins: 30, Losses: 20, Draws: 50}, 34.860, 48.470},
+		{Score{Wins: 40, Losses: 60}, -70.437, 70.571},
+	} {
+		elo, margin := tt.score.Elo()
+		if !near(elo, tt.elo, 0.01) || !near(margin, tt.plus, 0.01) {
+			t.Errorf("%v: Elo %.3f +/- %.3f, want %.3f +/- %.3f", tt.score, elo, margin, tt.elo, tt.plus)
+		}
+	}
+}
+
+func TestEloSameResults(t *testing.T) {
+	for _, tt := range []struct {
+		score Score
+		elo   float64
+	}{
+		{Score{Draws: 8}, 0},
+		{Score{Wins: 8}, math.Inf(1)},
+		{Score{Losses: 8}, math.Inf(-1)},
+	} {
+		elo, margin := tt.score.Elo()
+		if elo != tt.elo || math.Signbit(elo) != math.Signbit(tt.elo) || !math.IsNaN(margin) {
+			t.Errorf("%v: Elo %v +/- %v, want %v with no margin", tt.score, elo, margin, tt.elo)
+		}
+	}
+
+	var log bytes.Buffer
+	m := &Match{Log: &log}
+	m.printRating(Score{Draws: 8})
+	if want := "Elo difference: 0.0, LOS: 50.0 %, DrawRatio: 100.0 %\n"; log.String() != want {
+		t.Errorf("printed %q, want %q", log.String(), want)
+	}
+}
+
+func TestLOS(t *testing.T) {
+	for _, tt := range []struct {
+		score Score
+		los   float64
+	}{
+		// the wins minus losses over the square root of their sum is how
+		// many standard deviations it is from even: 2 is 97.72%
+		{Score{Wins: 60, Losses: 40}, 0.977250},
+		{Score{Wins: 40, Losses: 60}, 0.022750},
+		{Score{Wins: 30, Losses: 20, Draws: 50}, 0.921350},
+		{Score{Wins: 10, Losses: 10, Draws: 5}, 0.5},
+		{Score{Draws: 10}, 0.5},
+	} {
+		if los := tt.score.LOS(); !near(los, tt.los, 1e-5) {
+			t.Errorf("%v: LOS %.6f, want %.6f", tt.score, los, tt.los)
+		}
+	}
+}
+
+func TestSPRT(t *testing.T) {
+	test := SPRT{Elo0: 0, Elo1: 5, Alpha: 0.05, Beta: 0.05}
+	lower, upper := test.Bounds()
+	// ln(0.05/0.95) and ln(0.95/0.05)
+	if !near(lower, -2.944439, 1e-6) || !near(upper, 2.944439, 1e-6) {
+		t.Errorf("bounds %.6f, %.6f, want -2.944439, 2.944439", lower, upper)
+	}
+	lower, upper = SPRT{Alpha: 0.05, Beta: 0.1}.Bounds()
+	if !near(lower, -2.251292, 1e-6) || !near(upper, 2.890372, 1e-6) {
+		t.Errorf("bounds %.6f, %.6f, want -2.251292, 2.890372", lower, upper)
+	}
+
+	for _, tt := range []struct {
+		score  Score
+		llr    float64
+		decide int
+	}{
+		{Score{Wins: 1000, Losses: 900, Draws: 2100}, 2.160448, 0},
+		{Score{Wins: 1000, Losses: 800, Draws: 2200}, 5.505875, 1},
+		{Score{Wins: 900, Losses: 1000, Draws: 2100}, -3.906551, -1},
+		{Score{Draws: 100}, 0, 0},
+	} {
+		llr := test.LLR(tt.score)
+		if !near(llr, tt.llr, 1e-5) {
+			t.Errorf("%v: LLR %.6f, want %.6f", tt.score, llr, tt.llr)
+		}
+		if d := test.Decide(tt.score); d != tt.decide {
+			t.Errorf("%v: Decide %d, want %d", tt.score, d, tt.decide)
+		}
+	}
+}
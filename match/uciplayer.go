@@ -0,0 +1,120 @@
+package match
+
+import (
+	"fmt"
+	"gochess/core"
+	"gochess/engine"
+	"gochess/uciclient"
+	"strings"
+	"time"
+)
+
+// untimedTimeout is how long a search with no clock or move time may take
+// before the engine is taken to have hung.
+const untimedTimeout = 5 * time.Minute
+
+// UCIPlayer is an engine binary spoken to over UCI.
+type UCIPlayer struct {
+	name   string
+	engine *uciclient.Engine
+}
+
+// StartUCIPlayer runs command (the binary and its arguments, split on
+// spaces), goes through the handshake and sets the options.
+func StartUCIPlayer(name, command string, options map[string]string) (*UCIPlayer, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%s: no command", name)
+	}
+
+	e, err := uciclient.Start(fields[0], fields[1:]...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	for option, value := range options {
+		if _, ok := e.Options[option]; !ok {
+			e.Close()
+			return nil, fmt.Errorf("%s: unknown option %q", name, option)
+		}
+		e.SetOption(option, value)
+	}
+	if err := e.IsReady(); err != nil {
+		e.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &UCIPlayer{name: name, engine: e}, nil
+}
+
+func (p *UCIPlayer) Name() string {
+	return p.name
+}
+
+func (p *UCIPlayer) NewGame() error {
+	return p.engine.NewGame()
+}
+
+func (p *UCIPlayer) Play(pos Position, limits Limits) (Reply, error) {
+	moves := make([]string, len(pos.Moves))
+	for i, move := range pos.Moves {
+		moves[i] = pos.Board.ToAlgebraNotation(move)
+	}
+	p.engine.Position(pos.FEN, moves)
+
+	// give up on the engine a little after its time has surely run out
+	timeout := limits.MoveTime
+	if pos.Board.WhiteToMove {
+		timeout = max(timeout, limits.WTime+limits.WInc)
+	} else {
+		timeout = max(timeout, limits.BTime+limits.BInc)
+	}
+	if timeout > 0 {
+		timeout += time.Second
+	} else {
+		// only depth or nodes, which no engine should need this long for
+		timeout = untimedTimeout
+	}
+
+	best, err := p.engine.Go(uciclient.Go{
+		WTime:     limits.WTime,
+		BTime:     limits.BTime,
+		WInc:      limits.WInc,
+		BInc:      limits.BInc,
+		MovesToGo: limits.MovesToGo,
+		MoveTime:  limits.MoveTime,
+		Nodes:     limits.Nodes,
+		Depth:     limits.Depth,
+	}, timeout, nil)
+	if err != nil {
+		return Reply{}, fmt.Errorf("%s: %w", p.name, err)
+	}
+
+	// an illegal move comes back as the zero move, for the game to call out
+	reply := Reply{Score: engineScore(best.Info.Score), Depth: best.Info.Depth}
+	reply.Move, _ = findMove(pos.Board, best.Move)
+	return reply, nil
+}
+
+// engineScore puts a UCI score on the engine's scale.
+func engineScore(score uciclient.Score) int {
+	switch {
+	case !score.IsMate:
+		return score.CP
+	case score.Mate > 0:
+		return engine.MateScore - (2*score.Mate - 1)
+	}
+	return -engine.MateScore - 2*score.Mate
+}
+
+// findMove matches a move in coordinate notation against the legal ones.
+func findMove(board *core.Board, s string) (core.Move, bool) {
+	for _, move := range board.GenerateLegalMoves() {
+		if board.ToAlgebraNotation(move) == s {
+			return move, true
+		}
+	}
+	return core.Move{}, false
+}
+
+func (p *UCIPlayer) Close() error {
+	return p.engine.Close()
+}
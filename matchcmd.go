@@ -0,0 +1,224 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gochess/match"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// engineFlags collects the -engine flags, one per engine.
+type engineFlags []string
+
+func (f *engineFlags) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *engineFlags) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+func matchMain(args []string) {
+	if err := runMatch(args); err != nil {
+		fmt.Fprintln(os.Stderr, "match:", err)
+		os.Exit(1)
+	}
+}
+
+func runMatch(args []string) error {
+	var engines engineFlags
+	fs := flag.NewFlagSet("match", flag.ExitOnError)
+	fs.Var(&engines, "engine", "an engine, twice: name=A,cmd=./engine,Hash=16,... without cmd it's gochess in-process; other keys are UCI options")
+	tc := fs.String("tc", "", "time control, [moves/]seconds[+increment], e.g. 10+0.1 or 40/60")
+	moveTime := fs.Duration("movetime", 0, "fixed time per move")
+	nodes := fs.Uint64("nodes", 0, "fixed nodes per move")
+	depth := fs.Int("depth", 0, "fixed depth per move")
+	margin := fs.Duration("timemargin", 50*time.Millisecond, "how far over its time an engine may go before losing on time")
+	games := fs.Int("games", 100, "games to play, rounded up to an even number so each opening is played with both colours")
+	concurrency := fs.Int("concurrency", 1, "games played at once")
+	openings := fs.String("openings", "", "EPD or PGN (.pgn) file with the openings, the starting position if not given")
+	plies := fs.Int("plies", 8, "moves to take from each game of a PGN openings file")
+	shuffle := fs.Bool("shuffle", false, "play the openings in random order")
+	pgnOut := fs.String("pgn", "", "file to append the games to")
+	draw := fs.String("draw", "", "draw adjudication, movenumber=N,movecount=N,score=CP")
+	resign := fs.String("resign", "", "resign adjudication, movecount=N,score=CP")
+	sprt := fs.String("sprt", "", "stop when an SPRT decides, elo0=E,elo1=E[,alpha=0.05,beta=0.05]")
+	ratingInterval := fs.Int("ratinginterval", 10, "games between Elo reports")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gochess match -engine name=A,... -engine name=B,... [options]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if len(engines) != 2 || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	m := &match.Match{
+		Games:          *games + *games%2,
+		Concurrency:    *concurrency,
+		Log:            os.Stdout,
+		RatingInterval: *ratingInterval,
+	}
+	for i, spec := range engines {
+		config, err := parseEngine(spec)
+		if err != nil {
+			return err
+		}
+		if config.Name == "" {
+			config.Name = fmt.Sprintf("engine%d", i+1)
+		}
+		m.Engines[i] = config
+	}
+
+	m.Config.TimeMargin = *margin
+	m.Config.TimeControl = match.TimeControl{MoveTime: *moveTime, Nodes: *nodes, Depth: *depth}
+	if *tc != "" {
+		if err := parseTimeControl(*tc, &m.Config.TimeControl); err != nil {
+			return err
+		}
+	}
+	if *tc == "" && *moveTime == 0 && *nodes == 0 && *depth == 0 {
+		parseTimeControl("10+0.1", &m.Config.TimeControl)
+	}
+
+	adj := &m.Config.Adjudication
+	if *draw != "" {
+		if err := parseSettings(*draw, map[string]*int{
+			"movenumber": &adj.DrawMoveNumber, "movecount": &adj.DrawMoveCount, "score": &adj.DrawScore,
+		}); err != nil {
+			return fmt.Errorf("-draw: %w", err)
+		}
+		adj.DrawMoveCount = max(adj.DrawMoveCount, 1)
+	}
+	if *resign != "" {
+		if err := parseSettings(*resign, map[string]*int{
+			"movecount": &adj.ResignMoveCount, "score": &adj.ResignScore,
+		}); err != nil {
+			return fmt.Errorf("-resign: %w", err)
+		}
+		adj.ResignMoveCount = max(adj.ResignMoveCount, 1)
+	}
+
+	if *sprt != "" {
+		test, err := parseSPRT(*sprt)
+		if err != nil {
+			return fmt.Errorf("-sprt: %w", err)
+		}
+		m.SPRT = test
+	}
+
+	if *openings != "" {
+		var err error
+		if m.Openings, err = match.LoadOpenings(*openings, *plies); err != nil {
+			return err
+		}
+		if *shuffle {
+			rand.Shuffle(len(m.Openings), func(i, j int) {
+				m.Openings[i], m.Openings[j] = m.Openings[j], m.Openings[i]
+			})
+		}
+	}
+
+	if *pgnOut != "" {
+		f, err := os.OpenFile(*pgnOut, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		m.PGN = f
+	}
+
+	_, err := m.Run()
+	return err
+}
+
+// parseEngine reads an -engine flag: comma separated key=value pairs.
+func parseEngine(spec string) (match.EngineConfig, error) {
+	config := match.EngineConfig{Options: map[string]string{}}
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return config, fmt.Errorf("-engine: %q isn't key=value", pair)
+		}
+		switch key {
+		case "name":
+			config.Name = value
+		case "cmd":
+			config.Command = value
+		default:
+			config.Options[key] = value
+		}
+	}
+	return config, nil
+}
+
+// parseTimeControl reads "[moves/]seconds[+increment]".
+func parseTimeControl(s string, tc *match.TimeControl) error {
+	rest := s
+	if moves, after, ok := strings.Cut(rest, "/"); ok {
+		n, err := strconv.Atoi(moves)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("bad time control %q", s)
+		}
+		tc.Moves, rest = n, after
+	}
+	base, inc, hasInc := strings.Cut(rest, "+")
+	seconds, err := strconv.ParseFloat(base, 64)
+	if err != nil || seconds <= 0 {
+		return fmt.Errorf("bad time control %q", s)
+	}
+	tc.Time = time.Duration(seconds * float64(time.Second))
+	if hasInc {
+		seconds, err := strconv.ParseFloat(inc, 64)
+		if err != nil || seconds < 0 {
+			return fmt.Errorf("bad time control %q", s)
+		}
+		tc.Inc = time.Duration(seconds * float64(time.Second))
+	}
+	return nil
+}
+
+// parseSettings reads comma separated key=value pairs into the ints named.
+func parseSettings(s string, into map[string]*int) error {
+	for _, pair := range strings.Split(s, ",") {
+		key, value, _ := strings.Cut(pair, "=")
+		dst, ok := into[key]
+		if !ok {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q isn't a number", key, value)
+		}
+		*dst = n
+	}
+	return nil
+}
+
+func parseSPRT(s string) (*match.SPRT, error) {
+	test := &match.SPRT{Alpha: 0.05, Beta: 0.05}
+	values := map[string]*float64{"elo0": &test.Elo0, "elo1": &test.Elo1, "alpha": &test.Alpha, "beta": &test.Beta}
+	for _, pair := range strings.Split(s, ",") {
+		key, value, _ := strings.Cut(pair, "=")
+		dst, ok := values[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown setting %q", key)
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q isn't a number", key, value)
+		}
+		*dst = f
+	}
+	if test.Elo1 <= test.Elo0 || test.Alpha <= 0 || test.Beta <= 0 || test.Alpha+test.Beta >= 1 {
+		return nil, fmt.Errorf("need elo0 < elo1 and 0 < alpha, beta")
+	}
+	return test, nil
+}
@@ -0,0 +1,285 @@
+package pgn
+
+import (
+	"bufio"
+	"fmt"
+	"gochess/core"
+	"gochess/fen"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Game is one game of a PGN file: its tag pairs and the moves of the main
+// line in SAN. Comments, NAGs and variations are dropped while reading.
+type Game struct {
+	Tags   map[string]string
+	Moves  []string
+	Result string // "1-0", "0-1", "1/2-1/2" or "*"
+}
+
+// Rating returns the Elo of white or black from the tags, 0 when missing.
+func (g *Game) Rating(white bool) int {
+	tag := "WhiteElo"
+	if !white {
+		tag = "BlackElo"
+	}
+	elo, _ := strconv.Atoi(g.Tags[tag])
+	return elo
+}
+
+// StartingPosition returns the position the game starts from, the FEN tag's
+// if it has one.
+func (g *Game) StartingPosition() (*core.Board, error) {
+	if f, ok := g.Tags["FEN"]; ok {
+		return fen.LoadFromFEN(f)
+	}
+	return fen.LoadFromFEN(fen.DefaultFEN())
+}
+
+// Replay plays the game's moves out from its starting position. It calls
+// visit with the position before each move, stopping early if visit returns
+// false, and returns the final position.
+func (g *Game) Replay(visit func(board *core.Board, move core.Move) bool) (*core.Board, error) {
+	board, err := g.StartingPosition()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, san := range g.Moves {
+		move, err := ParseSAN(board, san)
+		if err != nil {
+			return board, fmt.Errorf("move %d: %w", i/2+1, err)
+		}
+		if visit != nil && !visit(board, move) {
+			break
+		}
+		board.Push(&move)
+	}
+	return board, nil
+}
+
+// the seven tags every exported game starts with, in order
+var rosterTags = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+// Write writes the game out in export format: the seven tag roster, the
+// other tags sorted, then the moves wrapped to 80 columns.
+func (g *Game) Write(w io.Writer) error {
+	var sb strings.Builder
+	for _, name := range rosterTags {
+		value, ok := g.Tags[name]
+		if !ok {
+			value = "?"
+			if name == "Result" {
+				value = g.Result
+			}
+		}
+		fmt.Fprintf(&sb, "[%s %s]\n", name, quoteTag(value))
+	}
+	var others []string
+	for name := range g.Tags {
+		if !slices.Contains(rosterTags, name) {
+			others = append(others, name)
+		}
+	}
+	slices.Sort(others)
+	for _, name := range others {
+		fmt.Fprintf(&sb, "[%s %s]\n", name, quoteTag(g.Tags[name]))
+	}
+	sb.WriteByte('\n')
+
+	// numbering goes on from the FEN tag when there is one
+	moveNumber, white := 1, true
+	if f, ok := g.Tags["FEN"]; ok {
+		if start, clocks, err := fen.Parse(f); err == nil {
+			moveNumber, white = clocks.Fullmove, start.WhiteToMove
+		}
+	}
+
+	line := 0
+	word := func(s string) {
+		if line > 0 && line+1+len(s) > 80 {
+			sb.WriteByte('\n')
+			line = 0
+		}
+		if line > 0 {
+			sb.WriteByte(' ')
+			line++
+		}
+		sb.WriteString(s)
+		line += len(s)
+	}
+	for i, san := range g.Moves {
+		switch {
+		case white:
+			word(strconv.Itoa(moveNumber) + ". " + san)
+		case i == 0:
+			word(strconv.Itoa(moveNumber) + "... " + san)
+		default:
+			word(san)
+		}
+		if !white {
+			moveNumber++
+		}
+		white = !white
+	}
+	result := g.Result
+	if result == "" {
+		result = "*"
+	}
+	word(result)
+	sb.WriteString("\n\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func quoteTag(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// Reader reads games one after the other from a PGN stream.
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next game, io.EOF once there are no more.
+func (pr *Reader) Next() (*Game, error) {
+	game := &Game{Tags: map[string]string{}}
+	started := false
+	depth := 0 // of nested variations
+
+	for {
+		c, err := pr.r.ReadByte()
+		if err == io.EOF {
+			if started {
+				// a game cut short at the end of the file, keep what we have
+				if game.Result == "" {
+					game.Result = "*"
+				}
+				return game, nil
+			}
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+
+		case c == '%' || c == ';':
+			// escaped line or rest of line comment
+			if _, err := pr.r.ReadString('\n'); err != nil && err != io.EOF {
+				return nil, err
+			}
+
+		case c == '{':
+			if _, err := pr.r.ReadString('}'); err != nil {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+
+		case c == '[' && depth == 0:
+			if len(game.Moves) > 0 {
+				// tags of the next game, the last one had no result
+				pr.r.UnreadByte()
+				game.Result = "*"
+				return game, nil
+			}
+			line, err := pr.r.ReadString(']')
+			if err != nil {
+				return nil, fmt.Errorf("unterminated tag")
+			}
+			name, value, ok := parseTag(line[:len(line)-1])
+			if ok {
+				game.Tags[name] = value
+			}
+			started = true
+
+		case c == '(':
+			depth++
+		case c == ')':
+			depth = max(depth-1, 0)
+
+		default:
+			pr.r.UnreadByte()
+			token, err := pr.token()
+			if err != nil {
+				return nil, err
+			}
+			started = true
+			if depth > 0 || token == "" {
+				continue
+			}
+
+			switch {
+			case token == "1-0" || token == "0-1" || token == "1/2-1/2" || token == "*":
+				game.Result = token
+				return game, nil
+			case token[0] == '$':
+				// NAG
+			case token[0] >= '0' && token[0] <= '9' && !strings.HasPrefix(token, "0-0"):
+				// move number, maybe with the move glued on as in "12.e4"
+				if i := strings.LastIndexByte(token, '.'); i >= 0 && i+1 < len(token) {
+					game.Moves = append(game.Moves, token[i+1:])
+				}
+			default:
+				game.Moves = append(game.Moves, token)
+			}
+		}
+	}
+}
+
+// token reads up to the next delimiter.
+func (pr *Reader) token() (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := pr.r.ReadByte()
+		if err == io.EOF {
+			return sb.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if strings.IndexByte(" \t\r\n{}()[];", c) >= 0 {
+			pr.r.UnreadByte()
+			if sb.Len() == 0 {
+				// a lone delimiter we don't handle, skip it
+				pr.r.ReadByte()
+			}
+			return sb.String(), nil
+		}
+		sb.WriteByte(c)
+	}
+}
+
+// parseTag splits the inside of a tag pair, `Name "Value"`.
+func parseTag(s string) (name, value string, ok bool) {
+	s = strings.TrimSpace(s)
+	name, rest, found := strings.Cut(s, " ")
+	if !found {
+		return "", "", false
+	}
+	rest = strings.TrimSpace(rest)
+	if len(rest) < 2 || rest[0] != '"' || rest[len(rest)-1] != '"' {
+		return "", "", false
+	}
+	// a backslash escapes the quote or backslash after it
+	var sb strings.Builder
+	escaped := false
+	for _, c := range rest[1 : len(rest)-1] {
+		if c == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		sb.WriteRune(c)
+		escaped = false
+	}
+	return name, sb.String(), true
+}
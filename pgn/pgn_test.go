@@ -0,0 +1,164 @@
+package pgn
+
+import (
+	"bytes"
+	"gochess/core"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const games = `% an escaped line, skipped
+[Event "Casual \"blitz\" game"]
+[Site "?"]
+[White "Anderssen"]
+[Black "Kieseritzky"]
+[Result "1-0"]
+[WhiteElo "2600"]
+[Annotator "back\\slash"]
+
+1. e4 e5 2. f4 $2 {the King's Gambit} exf4 (2... d5 3. exd5 (3. Nf3) c6) 3. Bc4!?
+Qh4+ ; check
+4. Kf1 b5 5.Bxb5 Nf6 6. Nf3 Qh6 7. d3 Nh5 8. Nh4 Qg5 9. Nf5 c6 10. g4 Nf6 11.
+Rg1 cxb5 12. h4 Qg6 13. h5 Qg5 14. Qf3 Ng8 15. Bxf4 Qf6 16. Nc3 Bc5 17. Nd5
+Qxb2 18. Bd6 Bxg1 {18... Qxa1+ 19. Ke2 Qb2 is better} 19. e5 Qxa1+ 20. Ke2 Na6
+21. Nxg7+ Kd8 22. Qf6+ Nxf6 23. Be7# 1-0
+
+[Event "From a position"]
+[FEN "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 12"]
+[SetUp "1"]
+
+12... O-O-O 13. 0-0 $14 Rd2 *
+
+[Event "No result"]
+
+1. d4 d5 2. c4
+
+[Event "Cut short"]
+
+1. Nf3 Nf6 2.`
+
+func readAll(t *testing.T, s string) []*Game {
+	t.Helper()
+	r := NewReader(strings.NewReader(s))
+	var all []*Game
+	for {
+		game, err := r.Next()
+		if err == io.EOF {
+			return all
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, game)
+	}
+}
+
+func TestReader(t *testing.T) {
+	all := readAll(t, games)
+	if len(all) != 4 {
+		t.Fatalf("read %d games, want 4", len(all))
+	}
+
+	g := all[0]
+	if g.Tags["Event"] != `Casual "blitz" game` || g.Tags["White"] != "Anderssen" || g.Tags["Annotator"] != `back\slash` || g.Rating(true) != 2600 || g.Rating(false) != 0 {
+		t.Errorf("game 1 tags %v", g.Tags)
+	}
+	if g.Result != "1-0" || len(g.Moves) != 45 {
+		t.Fatalf("game 1: %d moves, result %q", len(g.Moves), g.Result)
+	}
+	// the comments, NAG and variations are gone, the annotations stay on
+	// the moves they're glued to
+	want := []string{"e4", "e5", "f4", "exf4", "Bc4!?", "Qh4+", "Kf1", "b5", "Bxb5", "Nf6"}
+	if !slices.Equal(g.Moves[:len(want)], want) {
+		t.Errorf("game 1 starts %v, want %v", g.Moves[:len(want)], want)
+	}
+	if last := g.Moves[len(g.Moves)-1]; last != "Be7#" {
+		t.Errorf("game 1 ends with %s", last)
+	}
+
+	if g := all[1]; g.Result != "*" || !slices.Equal(g.Moves, []string{"O-O-O", "0-0", "Rd2"}) {
+		t.Errorf("game 2: moves %v, result %q", g.Moves, g.Result)
+	}
+	if g := all[2]; g.Result != "*" || !slices.Equal(g.Moves, []string{"d4", "d5", "c4"}) {
+		t.Errorf("game 3: moves %v, result %q", g.Moves, g.Result)
+	}
+	if g := all[3]; g.Tags["Event"] != "Cut short" || g.Result != "*" || !slices.Equal(g.Moves, []string{"Nf3", "Nf6"}) {
+		t.Errorf("game 4: tags %v, moves %v, result %q", g.Tags, g.Moves, g.Result)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	all := readAll(t, games)
+
+	plies := 0
+	board, err := all[0].Replay(func(*core.Board, core.Move) bool {
+		plies++
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plies != 45 || !board.InCheck(board.WhiteToMove) || len(board.GenerateLegalMoves()) != 0 {
+		t.Errorf("game 1: %d plies, doesn't end in mate", plies)
+	}
+
+	// from the FEN tag, black to move
+	board, err = all[1].Replay(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if board.Pieces[58].Type() != core.PieceTypeKing || board.Pieces[6].Type() != core.PieceTypeKing || board.Pieces[11].Type() != core.PieceTypeRook {
+		t.Errorf("game 2 ends with the wrong position")
+	}
+
+	// stopping early
+	plies = 0
+	all[0].Replay(func(*core.Board, core.Move) bool {
+		plies++
+		return plies < 5
+	})
+	if plies != 5 {
+		t.Errorf("visited %d plies, want 5", plies)
+	}
+
+	bad := &Game{Moves: []string{"e4", "e5", "Ke3"}}
+	if _, err := bad.Replay(nil); err == nil || !strings.Contains(err.Error(), "move 2") {
+		t.Errorf("illegal move 2. Ke3: %v", err)
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	all := readAll(t, games)
+
+	var buf bytes.Buffer
+	for _, g := range all {
+		if err := g.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if len(line) > 80 {
+			t.Errorf("line longer than 80 columns: %q", line)
+		}
+	}
+	if !strings.Contains(buf.String(), "12... O-O-O 13. 0-0 Rd2 *") {
+		t.Errorf("game 2 isn't numbered from its FEN:\n%s", buf.String())
+	}
+
+	again := readAll(t, buf.String())
+	if len(again) != len(all) {
+		t.Fatalf("read back %d games, want %d", len(again), len(all))
+	}
+	for i := range all {
+		if !slices.Equal(again[i].Moves, all[i].Moves) || again[i].Result != all[i].Result {
+			t.Errorf("game %d: read back %v %q", i+1, again[i].Moves, again[i].Result)
+		}
+		for name, value := range all[i].Tags {
+			if again[i].Tags[name] != value {
+				t.Errorf("game %d: tag %s read back as %q, want %q", i+1, name, again[i].Tags[name], value)
+			}
+		}
+	}
+}
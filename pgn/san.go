@@ -0,0 +1,170 @@
+package pgn
+
+import (
+	"fmt"
+	"gochess/core"
+	"strings"
+)
+
+var sanPieceTypes = map[byte]uint8{
+	'N': core.PieceTypeKnight,
+	'B': core.PieceTypeBishop,
+	'R': core.PieceTypeRook,
+	'Q': core.PieceTypeQueen,
+	'K': core.PieceTypeKing,
+}
+
+// ParseSAN finds the legal move on board that san (standard algebraic
+// notation, e.g. "Nbd7", "exd8=Q+" or "O-O") stands for.
+func ParseSAN(board *core.Board, san string) (core.Move, error) {
+	s := strings.TrimRight(san, "+#!?")
+	moves := board.GenerateLegalMoves()
+
+	// castling, some files use zeros
+	if s == "O-O" || s == "0-0" || s == "O-O-O" || s == "0-0-0" {
+		king := board.KingSquare(board.WhiteToMove)
+		to := king + 2
+		if len(s) == 5 {
+			to = king - 2
+		}
+		for _, move := range moves {
+			if move.From == king && move.To == to {
+				return move, nil
+			}
+		}
+		return core.Move{}, fmt.Errorf("illegal castling %q", san)
+	}
+
+	pieceType := uint8(core.PieceTypePawn)
+	if len(s) > 0 {
+		if pt, ok := sanPieceTypes[s[0]]; ok {
+			pieceType = pt
+			s = s[1:]
+		}
+	}
+
+	promotion := uint8(core.PieceTypeNone)
+	if i := strings.IndexByte(s, '='); i >= 0 && i+1 < len(s) {
+		promotion = sanPieceTypes[s[i+1]]
+		s = s[:i]
+	} else if n := len(s); n > 2 && pieceType == core.PieceTypePawn && sanPieceTypes[s[n-1]] != 0 {
+		promotion = sanPieceTypes[s[n-1]] // "e8Q"
+		s = s[:n-1]
+	}
+
+	if len(s) < 2 {
+		return core.Move{}, fmt.Errorf("bad SAN %q", san)
+	}
+	to, ok := parseSquare(s[len(s)-2:])
+	if !ok {
+		return core.Move{}, fmt.Errorf("bad SAN %q", san)
+	}
+
+	// what's left is disambiguation, maybe with the capture mark
+	fromFile, fromRank := -1, -1
+	for _, c := range s[:len(s)-2] {
+		switch {
+		case c >= 'a' && c <= 'h':
+			fromFile = int(c - 'a')
+		case c >= '1' && c <= '8':
+			fromRank = int(c - '1')
+		case c == 'x' || c == '-':
+		default:
+			return core.Move{}, fmt.Errorf("bad SAN %q", san)
+		}
+	}
+
+	var found core.Move
+	matches := 0
+	for _, move := range moves {
+		if move.To != to || board.Pieces[move.From].Type() != pieceType || move.Promotion.Type() != promotion {
+			continue
+		}
+		if fromFile >= 0 && int(move.From&7) != fromFile || fromRank >= 0 && int(move.From>>3) != fromRank {
+			continue
+		}
+		found = move
+		matches++
+	}
+
+	switch matches {
+	case 0:
+		return core.Move{}, fmt.Errorf("illegal move %q", san)
+	case 1:
+		return found, nil
+	default:
+		return core.Move{}, fmt.Errorf("ambiguous move %q", san)
+	}
+}
+
+func parseSquare(s string) (core.Position, bool) {
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || s[1] < '1' || s[1] > '8' {
+		return 64, false
+	}
+	return core.Position(s[0]-'a') + core.Position(s[1]-'1')*8, true
+}
+
+var sanLetters = [7]string{"", "", "N", "B", "R", "Q", "K"}
+
+// SAN writes move, a legal move on board, in standard algebraic notation,
+// with "+" or "#" when it gives check or mate.
+func SAN(board *core.Board, move core.Move) string {
+	var sb strings.Builder
+	piece := board.Pieces[move.From]
+	pieceType := piece.Type()
+
+	switch {
+	case pieceType == core.PieceTypeKing && int(move.To)-int(move.From) == 2:
+		sb.WriteString("O-O")
+	case pieceType == core.PieceTypeKing && int(move.From)-int(move.To) == 2:
+		sb.WriteString("O-O-O")
+	default:
+		capture := board.Pieces[move.To] != core.PieceNone ||
+			pieceType == core.PieceTypePawn && move.To == board.EnPassantTarget
+
+		sb.WriteString(sanLetters[pieceType])
+		if pieceType == core.PieceTypePawn {
+			if capture {
+				sb.WriteByte('a' + byte(move.From&7))
+			}
+		} else {
+			// only as much of the from square as tells it apart
+			sameFile, sameRank, others := false, false, false
+			for _, other := range board.GenerateLegalMoves() {
+				if other.To != move.To || other.From == move.From || board.Pieces[other.From] != piece {
+					continue
+				}
+				others = true
+				sameFile = sameFile || other.From&7 == move.From&7
+				sameRank = sameRank || other.From>>3 == move.From>>3
+			}
+			if others && (!sameFile || sameRank) {
+				sb.WriteByte('a' + byte(move.From&7))
+			}
+			if others && sameFile {
+				sb.WriteByte('1' + byte(move.From>>3))
+			}
+		}
+
+		if capture {
+			sb.WriteByte('x')
+		}
+		sb.WriteByte('a' + byte(move.To&7))
+		sb.WriteByte('1' + byte(move.To>>3))
+		if move.Promotion != core.PieceNone {
+			sb.WriteByte('=')
+			sb.WriteString(sanLetters[move.Promotion.Type()])
+		}
+	}
+
+	board.Push(&move)
+	if board.InCheck(board.WhiteToMove) {
+		if len(board.GenerateLegalMoves()) == 0 {
+			sb.WriteByte('#')
+		} else {
+			sb.WriteByte('+')
+		}
+	}
+	board.Pop()
+	return sb.String()
+}
@@ -0,0 +1,120 @@
+package pgn
+
+import (
+	"gochess/core"
+	"gochess/fen"
+	"testing"
+)
+
+func load(t *testing.T, s string) *core.Board {
+	t.Helper()
+	b, err := fen.LoadFromFEN(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseSAN(t *testing.T) {
+	for _, tt := range []struct {
+		fen, san, move string
+	}{
+		{fen.DefaultFEN(), "e4", "e2e4"},
+		{fen.DefaultFEN(), "Nf3", "g1f3"},
+
+		// two knights reach d2, the file tells them apart
+		{"4k3/8/8/8/8/8/8/1N2KN2 w - - 0 1", "Nbd2", "b1d2"},
+		{"4k3/8/8/8/8/8/8/1N2KN2 w - - 0 1", "Nfd2", "f1d2"},
+		// two rooks on the a file, the rank does
+		{"R7/8/8/7k/8/8/8/R3K3 w - - 0 1", "R1a4", "a1a4"},
+		{"R7/8/8/7k/8/8/8/R3K3 w - - 0 1", "R8a4", "a8a4"},
+		// three queens, h4 needs the full square
+		{"K7/8/1k6/8/4Q2Q/8/8/7Q w - - 0 1", "Qh4e1", "h4e1"},
+		{"K7/8/1k6/8/4Q2Q/8/8/7Q w - - 0 1", "Q1e1", "h1e1"},
+		// disambiguation that isn't needed is fine too
+		{fen.DefaultFEN(), "Ngf3", "g1f3"},
+		{fen.DefaultFEN(), "Ng1-f3", "g1f3"},
+
+		{"r3k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b8=Q", "b7b8q"},
+		{"r3k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b8N", "b7b8n"},
+		{"r3k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "bxa8=R+", "b7a8r"},
+		{"r3k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "bxa8Q+", "b7a8q"},
+		{"4k3/8/8/8/8/8/6p1/4K2R b - - 0 1", "gxh1=B", "g2h1b"},
+
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "O-O", "e1g1"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "0-0-0", "e1c1"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "0-0", "e8g8"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "O-O-O+", "e8c8"},
+
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", "exf6", "e5f6"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "Ra8#", "a1a8"},
+		{fen.DefaultFEN(), "e4!?", "e2e4"},
+		{fen.DefaultFEN(), "Nc3??", "b1c3"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "Ra8#!", "a1a8"},
+	} {
+		b := load(t, tt.fen)
+		move, err := ParseSAN(b, tt.san)
+		if err != nil {
+			t.Errorf("%s %s: %v", tt.fen, tt.san, err)
+			continue
+		}
+		if got := b.ToAlgebraNotation(move); got != tt.move {
+			t.Errorf("%s %s: got %s, want %s", tt.fen, tt.san, got, tt.move)
+		}
+	}
+}
+
+func TestParseSANErrors(t *testing.T) {
+	for _, tt := range []struct {
+		fen, san string
+	}{
+		{"4k3/8/8/8/8/8/8/1N2KN2 w - - 0 1", "Nd2"},                       // ambiguous
+		{"K7/8/1k6/8/4Q2Q/8/8/7Q w - - 0 1", "Qhe1"},                      // still ambiguous
+		{fen.DefaultFEN(), "e5"},                                          // illegal
+		{fen.DefaultFEN(), "O-O"},                                         // illegal
+		{"r3k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b8"},                        // has to promote
+		{fen.DefaultFEN(), "Zf3"},                                         // no such piece
+		{fen.DefaultFEN(), "e"},                                           // too short
+		{"r3k2r/8/8/8/8/8/8/R3K2R w Qkq - 0 1", "O-O"},                    // no right
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w - - 0 1", "exd5"}, // nothing there
+	} {
+		if move, err := ParseSAN(load(t, tt.fen), tt.san); err == nil {
+			t.Errorf("%s %s: parsed to %v, want an error", tt.fen, tt.san, move)
+		}
+	}
+}
+
+// SAN writes what ParseSAN reads, with just enough disambiguation.
+func TestSAN(t *testing.T) {
+	for _, tt := range []struct {
+		fen, move, san string
+	}{
+		{fen.DefaultFEN(), "g1f3", "Nf3"},
+		{"4k3/8/8/8/8/8/8/1N2KN2 w - - 0 1", "b1d2", "Nbd2"},
+		{"R7/8/8/7k/8/8/8/R3K3 w - - 0 1", "a1a4", "R1a4"},
+		{"K7/8/1k6/8/4Q2Q/8/8/7Q w - - 0 1", "h4e1", "Qh4e1"},
+		{"K7/8/1k6/8/4Q2Q/8/8/7Q w - - 0 1", "h1e1", "Q1e1"},
+		{"K7/8/1k6/8/4Q2Q/8/8/7Q w - - 0 1", "e4e1", "Qee1"},
+		{"r3k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b7a8n", "bxa8=N"},
+		{"r3k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b7b8q", "b8=Q+"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", "O-O"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8", "O-O-O"},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", "e5f6", "exf6"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "a1a8", "Ra8#"},
+	} {
+		b := load(t, tt.fen)
+		var move core.Move
+		for _, m := range b.GenerateLegalMoves() {
+			if b.ToAlgebraNotation(m) == tt.move {
+				move = m
+			}
+		}
+		san := SAN(b, move)
+		if san != tt.san {
+			t.Errorf("%s %s: SAN %s, want %s", tt.fen, tt.move, san, tt.san)
+		}
+		if back, err := ParseSAN(b, san); err != nil || back != move {
+			t.Errorf("%s %s: %s parsed back to %v, %v", tt.fen, tt.move, san, back, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package syzygy
+
+import "gochess/core"
+
+// Lookup tables for turning a position into a table index, the same way
+// the generator did.
+
+var (
+	mapB1H1H7     [64]int     // squares below the a1-h8 diagonal to 0..27
+	mapA1D1D4     [64]int     // the a1-d1-d4 triangle to 0..9, diagonal last
+	mapKK         [10][64]int // the 462 placements of two kings, first in the triangle
+	binomial      [6][64]uint64
+	mapPawns      [64]int       // a2-h7 to 0..47, highest for the leading pawn
+	leadPawnIdx   [6][64]uint64 // index of the leading pawns group, by count and square
+	leadPawnsSize [6][4]uint64  // number of leading pawn placements, by count and file
+)
+
+// offA1H8 is positive above the a1-h8 diagonal, negative below and zero on it.
+func offA1H8(sq core.Position) int {
+	return int(sq>>3) - int(sq&7)
+}
+
+func flipFile(sq core.Position) core.Position { return sq ^ 7 }
+func flipRank(sq core.Position) core.Position { return sq ^ 56 }
+
+func init() {
+	code := 0
+	for sq := range core.Position(64) {
+		if offA1H8(sq) < 0 {
+			mapB1H1H7[sq] = code
+			code++
+		}
+	}
+
+	code = 0
+	var diagonal []core.Position
+	for sq := range core.Position(28) { // a1 to d4
+		switch {
+		case offA1H8(sq) < 0 && sq&7 <= 3:
+			mapA1D1D4[sq] = code
+			code++
+		case offA1H8(sq) == 0 && sq&7 <= 3:
+			diagonal = append(diagonal, sq)
+		}
+	}
+	for _, sq := range diagonal {
+		mapA1D1D4[sq] = code
+		code++
+	}
+
+	// with the first king on the diagonal the second one isn't above it,
+	// and placements with both on the diagonal come last
+	type kk struct {
+		idx int
+		sq  core.Position
+	}
+	var bothOnDiagonal []kk
+	code = 0
+	for idx := range 10 {
+		for s1 := range core.Position(28) {
+			if mapA1D1D4[s1] != idx || (idx == 0 && s1 != 1) { // b1 is 0
+				continue
+			}
+			for s2 := range core.Position(64) {
+				switch {
+				case (core.Attacks(core.PieceTypeKing, s1, 0)|1<<s1)&(1<<s2) != 0:
+					// kings next to each other
+				case offA1H8(s1) == 0 && offA1H8(s2) > 0:
+				case offA1H8(s1) == 0 && offA1H8(s2) == 0:
+					bothOnDiagonal = append(bothOnDiagonal, kk{idx, s2})
+				default:
+					mapKK[idx][s2] = code
+					code++
+				}
+			}
+		}
+	}
+	for _, p := range bothOnDiagonal {
+		mapKK[p.idx][p.sq] = code
+		code++
+	}
+
+	binomial[0][0] = 1
+	for n := 1; n < 64; n++ {
+		for k := 0; k < 6 && k <= n; k++ {
+			if k > 0 {
+				binomial[k][n] += binomial[k-1][n-1]
+			}
+			if k < n {
+				binomial[k][n] += binomial[k][n-1]
+			}
+		}
+	}
+
+	available := 47
+	for leadPawns := 1; leadPawns <= 5; leadPawns++ {
+		for file := range core.Position(4) {
+			// the index restarts for every file, each has its own table
+			var idx uint64
+			for rank := core.Position(1); rank <= 6; rank++ {
+				sq := rank*8 + file
+				if leadPawns == 1 {
+					mapPawns[sq] = available
+					available--
+					mapPawns[flipFile(sq)] = available
+					available--
+				}
+				leadPawnIdx[leadPawns][sq] = idx
+				idx += binomial[leadPawns-1][mapPawns[sq]]
+			}
+			leadPawnsSize[leadPawns][file] = idx
+		}
+	}
+}
+
+// pawnsBefore orders pawns so the leading one, nearest the edge and then
+// lowest, compares last.
+func pawnsBefore(a, b core.Position) bool {
+	return mapPawns[a] < mapPawns[b]
+}
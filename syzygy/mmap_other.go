@@ -0,0 +1,11 @@
+//go:build !unix
+
+package syzygy
+
+import "os"
+
+// mapFile reads a table into memory. Without mmap the whole file is read
+// the first time it's probed.
+func mapFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
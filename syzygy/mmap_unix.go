@@ -0,0 +1,27 @@
+//go:build unix
+
+package syzygy
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps a table into memory read-only, so only the parts probed
+// ever get read off disk. Tables stay mapped for the life of the process.
+func mapFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		return nil, errCorrupt
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+}
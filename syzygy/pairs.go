@@ -0,0 +1,237 @@
+package syzygy
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errCorrupt = errors.New("corrupt table")
+
+// Table values are compressed with recursive pairing: the most frequent
+// pair of adjacent symbols is replaced by a new symbol, over and over, and
+// the result is Huffman coded in fixed size blocks. A sparse index every
+// span values says which block to start looking in.
+
+const (
+	flagSTM         = 1
+	flagMapped      = 2
+	flagWinPlies    = 4
+	flagLossPlies   = 8
+	flagWide        = 16
+	flagSingleValue = 128
+)
+
+type pairsData struct {
+	flags     uint8
+	pieces    [maxPieces]uint8 // in encoding order
+	groupLen  [maxPieces + 1]int
+	groupIdx  [maxPieces + 1]uint64
+	dtzMapIdx [4]int // where the DTZ value maps start, per result
+
+	blockSize       int
+	span            uint64
+	sparseIndexSize int
+	blockLengthSize int
+	numBlocks       int
+	minSymLen       int
+	maxSymLen       int
+
+	lowestSym   []byte // uint16 per symbol length
+	base64      []uint64
+	symLen      []uint8
+	btree       []byte // 3 bytes per symbol, two 12 bit children
+	sparseIndex []byte // 6 bytes per entry: block and offset
+	blockLength []byte // uint16 per block
+	data        []byte
+}
+
+func (d *pairsData) left(sym int) int {
+	return int(d.btree[3*sym]) | int(d.btree[3*sym+1]&0xf)<<8
+}
+
+func (d *pairsData) right(sym int) int {
+	return int(d.btree[3*sym+1]>>4) | int(d.btree[3*sym+2])<<4
+}
+
+func (d *pairsData) lowest(l int) uint64 {
+	return uint64(binary.LittleEndian.Uint16(d.lowestSym[2*l:]))
+}
+
+// setSizes reads the pairs header at pos, returning where it ends.
+func (d *pairsData) setSizes(data []byte, pos int) (int, error) {
+	if pos+1 > len(data) {
+		return 0, errCorrupt
+	}
+	d.flags = data[pos]
+	pos++
+
+	if d.flags&flagSingleValue != 0 {
+		if pos+1 > len(data) {
+			return 0, errCorrupt
+		}
+		d.minSymLen = int(data[pos]) // the value
+		return pos + 1, nil
+	}
+
+	if pos+10 > len(data) {
+		return 0, errCorrupt
+	}
+	n := 0
+	for d.groupLen[n] != 0 {
+		n++
+	}
+	tbSize := d.groupIdx[n]
+
+	d.blockSize = 1 << data[pos]
+	d.span = 1 << data[pos+1]
+	d.sparseIndexSize = int((tbSize + d.span - 1) / d.span)
+	padding := int(data[pos+2])
+	d.numBlocks = int(binary.LittleEndian.Uint32(data[pos+3:]))
+	d.blockLengthSize = d.numBlocks + padding
+	d.maxSymLen = int(data[pos+7])
+	d.minSymLen = int(data[pos+8])
+	pos += 9
+	if d.maxSymLen < d.minSymLen || d.maxSymLen > 32 {
+		return 0, errCorrupt
+	}
+
+	// canonical Huffman codes: longer codes have lower values. base64[l]
+	// is the lowest code of length minSymLen+l, left aligned in 64 bits
+	lengths := d.maxSymLen - d.minSymLen + 1
+	if pos+2*lengths+2 > len(data) {
+		return 0, errCorrupt
+	}
+	d.lowestSym = data[pos : pos+2*lengths]
+	d.base64 = make([]uint64, lengths)
+	for i := lengths - 2; i >= 0; i-- {
+		d.base64[i] = (d.base64[i+1] + d.lowest(i) - d.lowest(i+1)) / 2
+	}
+	for i := range d.base64 {
+		d.base64[i] <<= 64 - i - d.minSymLen
+	}
+	pos += 2 * lengths
+
+	syms := int(binary.LittleEndian.Uint16(data[pos:]))
+	pos += 2
+	if pos+3*syms > len(data) {
+		return 0, errCorrupt
+	}
+	d.btree = data[pos : pos+3*syms]
+	d.symLen = make([]uint8, syms)
+	visited := make([]bool, syms)
+	for sym := range syms {
+		if !visited[sym] {
+			if err := d.setSymLen(sym, visited); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return pos + 3*syms + syms&1, nil
+}
+
+// setSymLen works out how many values sym stands for, less one.
+func (d *pairsData) setSymLen(sym int, visited []bool) error {
+	visited[sym] = true
+	r := d.right(sym)
+	if r == 0xfff {
+		d.symLen[sym] = 0
+		return nil
+	}
+	l := d.left(sym)
+	if l >= len(d.symLen) || r >= len(d.symLen) {
+		return errCorrupt
+	}
+	for _, s := range []int{l, r} {
+		if !visited[s] {
+			if err := d.setSymLen(s, visited); err != nil {
+				return err
+			}
+		}
+	}
+	d.symLen[sym] = d.symLen[l] + d.symLen[r] + 1
+	return nil
+}
+
+// decompress returns the value at idx.
+func (d *pairsData) decompress(idx uint64) (int, error) {
+	if d.flags&flagSingleValue != 0 {
+		return d.minSymLen, nil
+	}
+
+	// the sparse index gives the block and offset of the value in the
+	// middle of each span, walk from there to the block holding idx
+	k := int(idx / d.span)
+	if k >= d.sparseIndexSize {
+		return 0, errCorrupt
+	}
+	block := int(binary.LittleEndian.Uint32(d.sparseIndex[6*k:]))
+	offset := int(binary.LittleEndian.Uint16(d.sparseIndex[6*k+4:]))
+	offset += int(idx%d.span) - int(d.span/2)
+
+	for offset < 0 {
+		block--
+		if block < 0 {
+			return 0, errCorrupt
+		}
+		offset += d.blockLen(block) + 1
+	}
+	for offset > d.blockLen(block) {
+		offset -= d.blockLen(block) + 1
+		block++
+		if block >= d.blockLengthSize {
+			return 0, errCorrupt
+		}
+	}
+
+	start := block * d.blockSize
+	if start+d.blockSize > len(d.data) {
+		return 0, errCorrupt
+	}
+	ptr := d.data[start : start+d.blockSize]
+	buf := binary.BigEndian.Uint64(ptr)
+	ptr = ptr[8:]
+	bufSize := 64
+
+	var sym int
+	for {
+		l := 0
+		for l < len(d.base64)-1 && buf < d.base64[l] {
+			l++
+		}
+		sym = int((buf-d.base64[l])>>(64-l-d.minSymLen)) + int(d.lowest(l))
+		if sym >= len(d.symLen) {
+			return 0, errCorrupt
+		}
+		if offset < int(d.symLen[sym])+1 {
+			break
+		}
+		offset -= int(d.symLen[sym]) + 1
+		l += d.minSymLen
+		buf <<= l
+		bufSize -= l
+		if bufSize <= 32 {
+			if len(ptr) < 4 {
+				return 0, errCorrupt
+			}
+			bufSize += 32
+			buf |= uint64(binary.BigEndian.Uint32(ptr)) << (64 - bufSize)
+			ptr = ptr[4:]
+		}
+	}
+
+	// expand the pair symbols down to the one value we want
+	for d.symLen[sym] != 0 {
+		l := d.left(sym)
+		if offset < int(d.symLen[l])+1 {
+			sym = l
+		} else {
+			offset -= int(d.symLen[l]) + 1
+			sym = d.right(sym)
+		}
+	}
+	return d.left(sym), nil
+}
+
+func (d *pairsData) blockLen(block int) int {
+	return int(binary.LittleEndian.Uint16(d.blockLength[2*block:]))
+}
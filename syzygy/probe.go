@@ -0,0 +1,355 @@
+// Package syzygy probes Syzygy endgame tablebases, the WDL (win/draw/loss)
+// and DTZ (distance to zeroing move) files most engines use.
+package syzygy
+
+import (
+	"cmp"
+	"fmt"
+	"gochess/core"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	wdlExt = ".rtbw"
+	dtzExt = ".rtbz"
+)
+
+// Results for the side to move. Cursed wins and blessed losses are wins
+// and losses that the fifty move rule turns into draws.
+const (
+	Loss        = -2
+	BlessedLoss = -1
+	Draw        = 0
+	CursedWin   = 1
+	Win         = 2
+)
+
+type probeState int
+
+const (
+	stateOK          probeState = iota
+	stateFail                   // no table or it couldn't be read
+	stateChangeSTM              // the DTZ file has the other side to move
+	stateZeroingBest            // the best move is a capture or pawn move
+)
+
+// Tablebases are the tables found in a set of directories. Files are
+// mapped in the first time they're probed.
+type Tablebases struct {
+	MaxPieces int // kings included, of the biggest table found
+
+	tables map[string]*table // under both colourings of the material
+}
+
+// Open looks for tables in path, a list of directories separated like
+// PATH is.
+func Open(path string) (*Tablebases, error) {
+	tb := &Tablebases{tables: map[string]*table{}}
+	count := 0
+	for _, dir := range filepath.SplitList(path) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutSuffix(entry.Name(), wdlExt)
+			if !ok {
+				continue
+			}
+			t, err := newTable(name)
+			if err != nil || tb.tables[t.key] != nil {
+				continue
+			}
+			t.wdlPath = filepath.Join(dir, entry.Name())
+			if _, err := os.Stat(filepath.Join(dir, name+dtzExt)); err == nil {
+				t.dtzPath = filepath.Join(dir, name+dtzExt)
+			}
+			tb.tables[t.key] = t
+			tb.tables[t.key2] = t
+			tb.MaxPieces = max(tb.MaxPieces, t.pieceCount)
+			count++
+		}
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("no Syzygy tables in %s", path)
+	}
+	return tb, nil
+}
+
+// Len is the number of tables found.
+func (tb *Tablebases) Len() int {
+	seen := map[*table]bool{}
+	for _, t := range tb.tables {
+		seen[t] = true
+	}
+	return len(seen)
+}
+
+// probeable is whether the tables could know the position: they don't
+// have castling rights.
+func (tb *Tablebases) probeable(b *core.Board) bool {
+	return b.CastlingRights == core.CastlingRightsNone &&
+		bits.OnesCount64(uint64(b.AllPieces)) <= tb.MaxPieces
+}
+
+// ProbeWDL returns the result of the position on b, false if it isn't in
+// the tables.
+func (tb *Tablebases) ProbeWDL(b *core.Board) (int, bool) {
+	if !tb.probeable(b) {
+		return 0, false
+	}
+	wdl, state := tb.search(b, false)
+	return wdl, state != stateFail
+}
+
+// ProbeDTZ returns the distance in plies to the next capture or pawn move
+// on the way to the result, positive when winning and negative when losing.
+// Draws are 0. It can be off by one ply, the tables round some to moves.
+func (tb *Tablebases) ProbeDTZ(b *core.Board) (int, bool) {
+	if !tb.probeable(b) {
+		return 0, false
+	}
+	dtz, state := tb.probeDTZ(b)
+	return dtz, state != stateFail
+}
+
+func isZeroing(b *core.Board, move core.Move) bool {
+	return isCapture(b, move) || b.Pieces[move.From].Type() == core.PieceTypePawn
+}
+
+func isCapture(b *core.Board, move core.Move) bool {
+	return b.Pieces[move.To] != core.PieceNone ||
+		(move.To == b.EnPassantTarget && b.Pieces[move.From].Type() == core.PieceTypePawn)
+}
+
+// probeTable looks the position up as it is, without trying any moves.
+func (tb *Tablebases) probeTable(b *core.Board, dtz bool, wdl int) (int, probeState) {
+	if bits.OnesCount64(uint64(b.AllPieces)) == 2 {
+		return Draw, stateOK
+	}
+	t := tb.tables[keyOf(b)]
+	if t == nil {
+		return 0, stateFail
+	}
+	return t.probe(b, dtz, wdl)
+}
+
+// search plays out the captures (and with zeroing the pawn moves too)
+// before trusting the table. The tables don't store en passant rights, and
+// with a winning capture the stored value can be a "don't care".
+func (tb *Tablebases) search(b *core.Board, zeroing bool) (int, probeState) {
+	var buf [core.MaxMoves]core.Move
+	moves := b.GenerateLegalMovesInto(&buf)
+
+	best, count := Loss, 0
+	for _, move := range moves {
+		if !isCapture(b, move) && (!zeroing || b.Pieces[move.From].Type() != core.PieceTypePawn) {
+			continue
+		}
+		count++
+
+		b.Push(&move)
+		value, state := tb.search(b, false)
+		b.Pop()
+		if state == stateFail {
+			return Draw, stateFail
+		}
+
+		if -value > best {
+			best = -value
+			if best >= Win {
+				return best, stateZeroingBest
+			}
+		}
+	}
+
+	noMoreMoves := count > 0 && count == len(moves)
+	value := best
+	if !noMoreMoves {
+		var state probeState
+		if value, state = tb.probeTable(b, false, 0); state == stateFail {
+			return Draw, stateFail
+		}
+	}
+
+	if best >= value {
+		if best > Draw || noMoreMoves {
+			return best, stateZeroingBest
+		}
+		return best, stateOK
+	}
+	return value, stateOK
+}
+
+// dtzBeforeZeroing is the DTZ of a position whose best move is a capture
+// or pawn move with the given result.
+func dtzBeforeZeroing(wdl int) int {
+	switch wdl {
+	case Win:
+		return 1
+	case CursedWin:
+		return 101
+	case BlessedLoss:
+		return -101
+	case Loss:
+		return -1
+	}
+	return 0
+}
+
+func sign(x int) int {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
+
+func (tb *Tablebases) probeDTZ(b *core.Board) (int, probeState) {
+	wdl, state := tb.search(b, true)
+	if state == stateFail || wdl == Draw {
+		return 0, state
+	}
+	if state == stateZeroingBest {
+		return dtzBeforeZeroing(wdl), stateOK
+	}
+
+	dtz, state := tb.probeTable(b, true, wdl)
+	if state == stateFail {
+		return 0, stateFail
+	}
+	if state != stateChangeSTM {
+		if wdl == CursedWin || wdl == BlessedLoss {
+			dtz += 100
+		}
+		return dtz * sign(wdl), stateOK
+	}
+
+	// the file only has the other side to move, so try every move and take
+	// the best DTZ one ply further on
+	var buf [core.MaxMoves]core.Move
+	minDTZ := 0xffff
+	for _, move := range b.GenerateLegalMovesInto(&buf) {
+		zeroing := isZeroing(b, move)
+
+		b.Push(&move)
+		if zeroing {
+			// the DTZ of this position, not the next one
+			var v int
+			v, state = tb.search(b, false)
+			dtz = -dtzBeforeZeroing(v)
+		} else {
+			dtz, state = tb.probeDTZ(b)
+			dtz = -dtz
+		}
+
+		if dtz == 1 && b.InCheck(b.WhiteToMove) && len(b.GenerateLegalMoves()) == 0 {
+			minDTZ = 1 // mate
+		}
+		if !zeroing {
+			dtz += sign(dtz)
+		}
+		if dtz < minDTZ && sign(dtz) == sign(wdl) {
+			minDTZ = dtz
+		}
+		b.Pop()
+
+		if state == stateFail {
+			return 0, stateFail
+		}
+	}
+
+	if minDTZ == 0xffff {
+		return -1, stateOK // mated
+	}
+	return minDTZ, stateOK
+}
+
+// RootMove is a move from a probed position with what the tables say
+// about it, for the side making it.
+type RootMove struct {
+	Move core.Move
+	WDL  int
+	DTZ  int // plies to the next zeroing move, with the sign of WDL
+}
+
+// RootMoves probes every legal move of the position on b, best first: the
+// best result, then the quickest progress when winning and the slowest when
+// losing. It needs the DTZ files, and returns false if any move can't be
+// probed.
+func (tb *Tablebases) RootMoves(b *core.Board) ([]RootMove, bool) {
+	if !tb.probeable(b) {
+		return nil, false
+	}
+
+	var buf [core.MaxMoves]core.Move
+	var rootMoves []RootMove
+	for _, move := range b.GenerateLegalMovesInto(&buf) {
+		zeroing := isZeroing(b, move)
+
+		b.Push(&move)
+		wdl, state := tb.search(b, false)
+		wdl = -wdl
+		var dtz int
+		switch {
+		case state == stateFail:
+		case zeroing:
+			dtz = dtzBeforeZeroing(wdl)
+		default:
+			dtz, state = tb.probeDTZ(b)
+			dtz = -dtz
+			dtz += sign(dtz)
+		}
+		if dtz == 2 && b.InCheck(b.WhiteToMove) && len(b.GenerateLegalMoves()) == 0 {
+			dtz = 1
+		}
+		b.Pop()
+
+		if state == stateFail {
+			return nil, false
+		}
+		rootMoves = append(rootMoves, RootMove{Move: move, WDL: wdl, DTZ: dtz})
+	}
+
+	sortRootMoves(rootMoves)
+	return rootMoves, true
+}
+
+// RootMovesWDL is RootMoves for when there are no DTZ files: moves are only
+// ranked by result, and DTZ is left at 0.
+func (tb *Tablebases) RootMovesWDL(b *core.Board) ([]RootMove, bool) {
+	if !tb.probeable(b) {
+		return nil, false
+	}
+
+	var buf [core.MaxMoves]core.Move
+	var rootMoves []RootMove
+	for _, move := range b.GenerateLegalMovesInto(&buf) {
+		b.Push(&move)
+		wdl, state := tb.search(b, false)
+		b.Pop()
+		if state == stateFail {
+			return nil, false
+		}
+		rootMoves = append(rootMoves, RootMove{Move: move, WDL: -wdl})
+	}
+
+	sortRootMoves(rootMoves)
+	return rootMoves, true
+}
+
+func sortRootMoves(rootMoves []RootMove) {
+	// DTZ is negative for losses, so the lowest is the best either way
+	slices.SortStableFunc(rootMoves, func(a, b RootMove) int {
+		if a.WDL != b.WDL {
+			return cmp.Compare(b.WDL, a.WDL)
+		}
+		return cmp.Compare(a.DTZ, b.DTZ)
+	})
+}
@@ -0,0 +1,872 @@
+package syzygy
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"gochess/core"
+	"gochess/fen"
+	"gochess/tablebase"
+	"maps"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// The tests write their own Syzygy files for the 3 man endings, from our
+// DTM tables, and check what's probed back out of them against those.
+// They're compressed the way the generator does it, pairs of symbols and
+// canonical Huffman codes, with the DTZ values going through maps. Because
+// the same reading of the format goes into writing and probing them, they
+// can't catch a misreading of it. TestRealTables runs the same checks, and
+// the hand worked knownValues, on files the generator wrote, but none are
+// checked in: it only runs with SYZYGY_PATH set, and is skipped otherwise.
+
+// KBvK and KNvK are only there for the underpromotions.
+var testTables = []string{"KQvK", "KRvK", "KBvK", "KNvK", "KPvK"}
+
+// fixture is what the tests probe, made once for all of them.
+var fixture struct {
+	once  sync.Once
+	dir   string
+	err   error
+	tb    *Tablebases
+	truth *tablebase.Tablebases
+	refs  map[string]*reference
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if fixture.dir != "" {
+		os.RemoveAll(fixture.dir)
+	}
+	os.Exit(code)
+}
+
+// testSetup generates the DTM tables, works out the DTZ of every position
+// from them and writes the Syzygy files.
+func testSetup(t *testing.T) (*Tablebases, *tablebase.Tablebases, map[string]*reference) {
+	t.Helper()
+	fixture.once.Do(func() {
+		fixture.dir, fixture.err = os.MkdirTemp("", "syzygy")
+		if fixture.err != nil {
+			return
+		}
+		dtmDir, wdlDir := filepath.Join(fixture.dir, "dtm"), filepath.Join(fixture.dir, "syzygy")
+		for _, dir := range []string{dtmDir, wdlDir} {
+			if fixture.err = os.Mkdir(dir, 0o755); fixture.err != nil {
+				return
+			}
+		}
+		fixture.err = writeFixture(dtmDir, wdlDir)
+	})
+	if fixture.err != nil {
+		t.Fatal(fixture.err)
+	}
+	return fixture.tb, fixture.truth, fixture.refs
+}
+
+func writeFixture(dtmDir, dir string) error {
+	truth, err := tablebase.New(dtmDir)
+	if err != nil {
+		return err
+	}
+	for _, m := range tablebase.Endings(3) {
+		if err := truth.Generate(m); err != nil {
+			return err
+		}
+	}
+
+	refs := map[string]*reference{}
+	for _, name := range testTables {
+		tbl, err := newTable(name)
+		if err != nil {
+			return err
+		}
+		ref, err := newReference(tbl, truth)
+		if err != nil {
+			return err
+		}
+		refs[name] = ref
+		for _, dtz := range []bool{false, true} {
+			if err := writeTable(dir, tbl, ref, dtz); err != nil {
+				return err
+			}
+		}
+	}
+
+	tb, err := Open(dir)
+	if err != nil {
+		return err
+	}
+	fixture.tb, fixture.truth, fixture.refs = tb, truth, refs
+	return nil
+}
+
+func TestProbe(t *testing.T) {
+	tb, truth, refs := testSetup(t)
+	if tb.MaxPieces != 3 || tb.Len() != len(testTables) {
+		t.Fatalf("found %d tables up to %d pieces", tb.Len(), tb.MaxPieces)
+	}
+	checkProbes(t, tb, truth, refs)
+}
+
+// TestRealTables probes the 3 man tables as the generator wrote them, from
+// SYZYGY_PATH. testTables all have to be there, KPvK promotes into the
+// others.
+func TestRealTables(t *testing.T) {
+	path := os.Getenv("SYZYGY_PATH")
+	if path == "" {
+		t.Skip("SYZYGY_PATH isn't set, no real tables to probe")
+	}
+	tb, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKnownValues(t, tb)
+	_, truth, refs := testSetup(t)
+	checkProbes(t, tb, truth, refs)
+}
+
+// knownValues can be worked out over the board, they don't come from our
+// DTM tables or from anything that reads or writes Syzygy files.
+var knownValues = []struct {
+	fen      string
+	wdl, dtz int
+}{
+	{"7k/8/6K1/8/8/8/8/R7 w - - 0 1", 2, 1},     // Ra8#
+	{"k7/8/1K6/8/8/8/8/7R b - - 0 1", -2, -2},   // Kb8 Rh8#
+	{"8/8/8/8/8/8/4P3/4K1k1 b - - 0 1", -2, -2}, // any king move, then e4
+	{"4k3/8/4K3/4P3/8/8/8/8 b - - 0 1", -2, -4}, // Kd8 Kf7, any king move, e6
+	{"8/4P3/8/8/8/8/k7/6K1 w - - 0 1", 2, 1},    // e8=Q
+	{"8/8/8/8/4k3/8/4P3/4K3 w - - 0 1", 0, 0},   // the black king is in front
+	{"4k3/8/8/8/8/8/3B4/4K3 w - - 0 1", 0, 0},   // a lone bishop can't mate
+	{"4k3/8/8/8/8/8/3N4/4K3 b - - 0 1", 0, 0},   // nor a knight
+}
+
+func TestKnownValues(t *testing.T) {
+	tb, _, _ := testSetup(t)
+	checkKnownValues(t, tb)
+}
+
+func checkKnownValues(t *testing.T, tb *Tablebases) {
+	for _, tt := range knownValues {
+		b, err := fen.LoadFromFEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wdl, ok := tb.ProbeWDL(b); !ok || wdl != tt.wdl {
+			t.Errorf("%s: WDL %d %v, want %d", tt.fen, wdl, ok, tt.wdl)
+		}
+		if dtz, ok := tb.ProbeDTZ(b); !ok || dtz != tt.dtz {
+			t.Errorf("%s: DTZ %d %v, want %d", tt.fen, dtz, ok, tt.dtz)
+		}
+	}
+}
+
+// checkProbes probes every position of the test tables, and each with the
+// colours swapped, against the reference.
+func checkProbes(t *testing.T, tb *Tablebases, truth *tablebase.Tablebases, refs map[string]*reference) {
+	for _, name := range testTables {
+		ref := refs[name]
+		checked := 0
+		for i := range ref.positions {
+			p := &ref.positions[i]
+			if !p.legal {
+				continue
+			}
+			b := ref.board(i)
+			wantWDL := 2 * p.outcome
+			wantDTZ := int(p.dtz)
+			if r, _ := truth.Probe(b); r.Outcome != p.outcome {
+				t.Fatalf("%s: reference and DTM tables disagree", fen.BoardToFEN(b))
+			}
+
+			// the same position with the colours swapped has to come out
+			// the same, it's found under the table's other key
+			for _, board := range []*core.Board{b, flipColors(b)} {
+				wdl, ok := tb.ProbeWDL(board)
+				if !ok || wdl != wantWDL {
+					t.Fatalf("%s: WDL %d %v, want %d", fen.BoardToFEN(board), wdl, ok, wantWDL)
+				}
+				dtz, ok := tb.ProbeDTZ(board)
+				if !ok || dtz != wantDTZ {
+					t.Fatalf("%s: DTZ %d %v, want %d", fen.BoardToFEN(board), dtz, ok, wantDTZ)
+				}
+			}
+			checked++
+		}
+		t.Logf("%s: %d positions", name, checked)
+	}
+}
+
+// Without pawns nothing zeroes but mate, so DTZ is the distance to mate.
+func TestDTZIsDTMWithoutPawns(t *testing.T) {
+	tb, truth, refs := testSetup(t)
+	for _, name := range []string{"KQvK", "KRvK"} {
+		ref := refs[name]
+		for i := range ref.positions {
+			if !ref.positions[i].legal {
+				continue
+			}
+			b := ref.board(i)
+			r, _ := truth.Probe(b)
+			want := 0
+			switch r.Outcome {
+			case 1:
+				want = r.Plies
+			case -1:
+				want = -max(r.Plies, 1) // mated is -1
+			}
+			if dtz, _ := tb.ProbeDTZ(b); dtz != want {
+				t.Fatalf("%s: DTZ %d, DTM %+v", fen.BoardToFEN(b), dtz, r)
+			}
+		}
+	}
+}
+
+func TestRootMoves(t *testing.T) {
+	tb, truth, _ := testSetup(t)
+	for _, s := range []string{
+		"8/8/3k4/8/8/8/8/4K2Q w - - 0 1",
+		"8/8/8/8/8/2k5/8/K6R b - - 0 1",
+		"8/8/8/8/4k3/8/4P3/4K3 w - - 0 1",
+		"8/8/8/8/8/8/3k1P2/5K2 w - - 0 1",
+	} {
+		b, err := fen.LoadFromFEN(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		moves, ok := tb.RootMoves(b)
+		if !ok || len(moves) != len(b.GenerateLegalMoves()) {
+			t.Fatalf("%s: %d root moves %v", s, len(moves), ok)
+		}
+		for _, rm := range moves {
+			b.Push(&rm.Move)
+			r, _ := truth.Probe(b)
+			b.Pop()
+			if rm.WDL != -2*r.Outcome {
+				t.Errorf("%s: %s WDL %d, DTM %+v", s, b.ToAlgebraNotation(rm.Move), rm.WDL, r)
+			}
+		}
+		if r, _ := truth.Probe(b); moves[0].WDL != 2*r.Outcome {
+			t.Errorf("%s: best move %s WDL %d, DTM %+v", s, b.ToAlgebraNotation(moves[0].Move), moves[0].WDL, r)
+		}
+	}
+}
+
+// reference has every placement of a table's pieces, in the table's
+// colours, with the result from the DTM tables and the DTZ worked out from
+// that.
+type reference struct {
+	pieces    []core.Piece // one of each, as the table names them
+	positions []refPosition
+}
+
+type refPosition struct {
+	legal   bool
+	outcome int // for the side to move
+	dtz     int16
+	next    []int32 // the positions after the moves that don't zero
+	zeroes  bool    // a capture or pawn move gets the result
+	mates   bool
+}
+
+// index numbers a placement: the piece squares in base 64, then the side
+// to move.
+func (r *reference) index(squares []core.Position, whiteToMove bool) int {
+	i := 0
+	for k := len(squares) - 1; k >= 0; k-- {
+		i = i*64 + int(squares[k])
+	}
+	i *= 2
+	if !whiteToMove {
+		i++
+	}
+	return i
+}
+
+func (r *reference) board(i int) *core.Board {
+	b := core.NewBoard()
+	b.CastlingRights = core.CastlingRightsNone
+	b.WhiteToMove = i%2 == 0
+	i /= 2
+	for _, p := range r.pieces {
+		sq := core.Position(i % 64)
+		i /= 64
+		if b.Pieces[sq] != core.PieceNone {
+			return nil
+		}
+		b.AddPiece(sq, p)
+	}
+	return b
+}
+
+// indexOf is the index of the position on b, -1 when it doesn't have the
+// table's material any more.
+func (r *reference) indexOf(b *core.Board) int {
+	if bits.OnesCount64(uint64(b.AllPieces)) != len(r.pieces) {
+		return -1
+	}
+	squares := make([]core.Position, len(r.pieces))
+	for k, p := range r.pieces {
+		bb := b.PieceBitboards[p.Color()>>3][p.Type()-1]
+		if bb == 0 {
+			return -1
+		}
+		squares[k] = core.Position(bits.TrailingZeros64(uint64(bb)))
+	}
+	return r.index(squares, b.WhiteToMove)
+}
+
+func newReference(tbl *table, truth *tablebase.Tablebases) (*reference, error) {
+	white, black, _ := strings.Cut(tbl.name, "v")
+	r := &reference{}
+	for _, c := range white {
+		r.pieces = append(r.pieces, core.Piece(strings.IndexRune(" PNBRQK", c)))
+	}
+	for _, c := range black {
+		r.pieces = append(r.pieces, core.Piece(strings.IndexRune(" PNBRQK", c))|core.PieceColorBlack)
+	}
+
+	n := 2
+	for range r.pieces {
+		n *= 64
+	}
+	r.positions = make([]refPosition, n)
+	for i := range r.positions {
+		b := r.board(i)
+		if b == nil || !legal(b) {
+			continue
+		}
+		p := &r.positions[i]
+		p.legal = true
+		result, ok := truth.Probe(b)
+		if !ok {
+			return nil, fmt.Errorf("%s: no DTM result", fen.BoardToFEN(b))
+		}
+		p.outcome = result.Outcome
+
+		for _, move := range b.GenerateLegalMoves() {
+			zeroing := isZeroing(b, move)
+			b.Push(&move)
+			switch {
+			case b.InCheck(b.WhiteToMove) && len(b.GenerateLegalMoves()) == 0:
+				p.mates = true
+			case zeroing:
+				after, ok := truth.Probe(b)
+				if !ok {
+					return nil, fmt.Errorf("%s: no DTM result", fen.BoardToFEN(b))
+				}
+				if -after.Outcome == p.outcome {
+					p.zeroes = true
+				}
+			default:
+				p.next = append(p.next, int32(r.indexOf(b)))
+			}
+			b.Pop()
+		}
+	}
+	r.solveDTZ()
+	return r, nil
+}
+
+func legal(b *core.Board) bool {
+	for sq := range (b.PieceBitboards[0][core.PieceTypePawn-1] | b.PieceBitboards[1][core.PieceTypePawn-1]).All() {
+		if sq>>3 == 0 || sq>>3 == 7 {
+			return false
+		}
+	}
+	return !b.InCheck(!b.WhiteToMove)
+}
+
+// solveDTZ goes over the positions until nothing changes. The winning side
+// takes the quickest way to a zeroing move or mate, the losing side the
+// slowest, and the positions only get their values once there's a line to
+// back them.
+func (r *reference) solveDTZ() {
+	for i := range r.positions {
+		p := &r.positions[i]
+		switch {
+		case !p.legal:
+		case p.outcome == 1 && (p.zeroes || p.mates):
+			p.dtz = 1
+		case p.outcome == -1 && len(p.next) == 0:
+			p.dtz = -1 // mated, or every move zeroes
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := range r.positions {
+			p := &r.positions[i]
+			if !p.legal || p.outcome == 0 {
+				continue
+			}
+
+			var dtz int16
+			if p.outcome == 1 {
+				dtz = p.dtz
+				for _, j := range p.next {
+					q := r.positions[j]
+					if q.outcome == -1 && q.dtz != 0 && (dtz == 0 || 1-q.dtz < dtz) {
+						dtz = 1 - q.dtz
+					}
+				}
+			} else {
+				dtz = -1
+				for _, j := range p.next {
+					q := r.positions[j]
+					if q.dtz == 0 {
+						dtz = 0 // not known yet
+						break
+					}
+					dtz = min(dtz, -1-q.dtz)
+				}
+			}
+			if dtz != p.dtz {
+				p.dtz, changed = dtz, true
+			}
+		}
+	}
+}
+
+func flipColors(b *core.Board) *core.Board {
+	flipped := core.NewBoard()
+	flipped.CastlingRights = core.CastlingRightsNone
+	flipped.WhiteToMove = !b.WhiteToMove
+	for sq := range b.AllPieces.All() {
+		flipped.AddPiece(sq^56, b.Pieces[sq]^core.PieceColorBlack)
+	}
+	return flipped
+}
+
+// writeTable writes the WDL or DTZ file for tbl, compressed the way the
+// generator does it. DTZ files only have white to move.
+func writeTable(dir string, tbl *table, ref *reference, dtz bool) error {
+	sides := 2
+	if dtz || tbl.symmetric() {
+		sides = 1
+	}
+	files := 1
+	if tbl.hasPawns {
+		files = 4
+	}
+	order := [2]int{0, 0xf}
+
+	// the pieces in the order they're encoded: pawns first, then kings,
+	// then the rest
+	var pieces []core.Piece
+	for _, p := range ref.pieces {
+		if p.Type() == core.PieceTypePawn {
+			pieces = append(pieces, p)
+		}
+	}
+	pieces = append(pieces, core.PieceWhiteKing, core.PieceBlackKing)
+	for _, p := range ref.pieces {
+		if p.Type() != core.PieceTypePawn && p.Type() != core.PieceTypeKing {
+			pieces = append(pieces, p)
+		}
+	}
+
+	f := &tableFile{}
+	var values [2][4][]int // WDL+2, or the DTZ with its sign
+	for file := range files {
+		for i := range sides {
+			d := &f.pairs[i][file]
+			for k, p := range pieces {
+				d.pieces[k] = uint8(p)
+			}
+			if err := tbl.setGroups(d, order, file); err != nil {
+				return err
+			}
+			n := 0
+			for d.groupLen[n] != 0 {
+				n++
+			}
+			values[i][file] = make([]int, d.groupIdx[n])
+			if !dtz {
+				for j := range values[i][file] {
+					values[i][file][j] = 2 // draws where there's no position
+				}
+			}
+		}
+	}
+
+	for idx := range ref.positions {
+		p := ref.positions[idx]
+		if !p.legal || dtz && idx%2 == 1 {
+			continue
+		}
+		b := ref.board(idx)
+		d, i, state := tbl.encode(b, f, dtz)
+		if state != stateOK {
+			return fmt.Errorf("%s: encoding failed", fen.BoardToFEN(b))
+		}
+		side, file := 0, 0
+		for s := range sides {
+			for ff := range files {
+				if d == &f.pairs[s][ff] {
+					side, file = s, ff
+				}
+			}
+		}
+		v := 2*p.outcome + 2
+		if dtz {
+			v = int(p.dtz)
+		}
+		values[side][file][i] = v
+	}
+
+	var dtzMaps [4][4][]byte
+	if dtz {
+		for file := range files {
+			var err error
+			values[0][file], dtzMaps[file], f.pairs[0][file].flags, err = mapDTZValues(values[0][file])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// header, then the piece order of each file
+	var out []byte
+	if dtz {
+		out = append(out, dtzMagic[:]...)
+	} else {
+		out = append(out, wdlMagic[:]...)
+	}
+	flags := byte(0)
+	if !tbl.symmetric() {
+		flags |= 1
+	}
+	if tbl.hasPawns {
+		flags |= 2
+	}
+	out = append(out, flags)
+	for range files {
+		out = append(out, byte(order[0]|order[0]<<4))
+		for _, p := range pieces {
+			out = append(out, byte(p)|byte(p)<<4)
+		}
+	}
+	out = append(out, make([]byte, len(out)&1)...)
+
+	var sections []compressed
+	for file := range files {
+		for i := range sides {
+			c, err := compress(f.pairs[i][file].flags, values[i][file])
+			if err != nil {
+				return fmt.Errorf("%s: %w", tbl.name, err)
+			}
+			sections = append(sections, c)
+			out = append(out, c.header...)
+		}
+	}
+	if dtz {
+		for file := range files {
+			for _, m := range dtzMaps[file] {
+				out = append(out, byte(len(m)))
+				out = append(out, m...)
+			}
+		}
+		out = append(out, make([]byte, len(out)&1)...)
+	}
+	for _, c := range sections {
+		out = append(out, c.sparse...)
+	}
+	for _, c := range sections {
+		out = append(out, c.lengths...)
+	}
+	for _, c := range sections {
+		out = append(out, make([]byte, -len(out)&0x3f)...)
+		out = append(out, c.data...)
+	}
+
+	ext := wdlExt
+	if dtz {
+		ext = dtzExt
+	}
+	return os.WriteFile(filepath.Join(dir, tbl.name+ext), out, 0o644)
+}
+
+// mapDTZValues puts each DTZ through the map for its result, wins or
+// losses, the most common values first, and in moves rather than plies
+// when they're all odd. It returns the stored values, the maps and the
+// flags for them.
+func mapDTZValues(vals []int) ([]int, [4][]byte, uint8, error) {
+	stored := make([]int, len(vals))
+	var dtzMap [4][]byte
+	flags := uint8(flagMapped)
+	for m, sign := range []int{1, -1} {
+		plies := false
+		for _, v := range vals {
+			if v*sign > 0 && v%2 == 0 {
+				plies = true
+			}
+		}
+		if plies && sign > 0 {
+			flags |= flagWinPlies
+		} else if plies {
+			flags |= flagLossPlies
+		}
+		unit := func(v int) int {
+			if plies {
+				return v*sign - 1
+			}
+			return (v*sign - 1) / 2
+		}
+
+		count := map[int]int{}
+		for _, v := range vals {
+			if v*sign > 0 {
+				count[unit(v)]++
+			}
+		}
+		units := slices.Collect(maps.Keys(count))
+		slices.SortFunc(units, func(a, b int) int {
+			if c := cmp.Compare(count[b], count[a]); c != 0 {
+				return c
+			}
+			return cmp.Compare(a, b)
+		})
+		if len(units) > 255 || len(units) > 0 && slices.Max(units) > 255 {
+			return nil, dtzMap, 0, fmt.Errorf("DTZ too long for a byte map")
+		}
+		index := map[int]int{}
+		for i, u := range units {
+			dtzMap[m] = append(dtzMap[m], byte(u))
+			index[u] = i
+		}
+		for i, v := range vals {
+			if v*sign > 0 {
+				stored[i] = index[unit(v)]
+			}
+		}
+	}
+	return stored, dtzMap, flags, nil
+}
+
+// compressed is one table's values as the generator writes them: the pairs
+// header, the sparse index, the block lengths and the blocks.
+type compressed struct {
+	header, sparse, lengths, data []byte
+}
+
+// compress replaces the commonest pair of neighbouring symbols with a new
+// one until no pair is common enough, then writes what's left in Huffman
+// codes, in blocks.
+func compress(flags uint8, vals []int) (compressed, error) {
+	var c compressed
+	if !slices.ContainsFunc(vals, func(v int) bool { return v != vals[0] }) {
+		c.header = []byte{flags | flagSingleValue, byte(vals[0])}
+		return c, nil
+	}
+
+	// a leaf is a value, anything else a pair of other symbols
+	type symbol struct{ left, right, values int }
+	var syms []symbol
+	leaves := map[int]int{}
+	seq := make([]int, len(vals))
+	for i, v := range vals {
+		id, ok := leaves[v]
+		if !ok {
+			id = len(syms)
+			leaves[v] = id
+			syms = append(syms, symbol{v, -1, 1})
+		}
+		seq[i] = id
+	}
+
+	for len(syms) < 256 {
+		counts := map[[2]int]int{}
+		for i := 0; i+1 < len(seq); i++ {
+			if syms[seq[i]].values+syms[seq[i+1]].values <= 256 {
+				counts[[2]int{seq[i], seq[i+1]}]++
+			}
+		}
+		var best [2]int
+		bestCount := 0
+		for pair, n := range counts {
+			if n > bestCount || n == bestCount && slices.Compare(pair[:], best[:]) < 0 {
+				best, bestCount = pair, n
+			}
+		}
+		if bestCount < 8 {
+			break
+		}
+
+		id := len(syms)
+		syms = append(syms, symbol{best[0], best[1], syms[best[0]].values + syms[best[1]].values})
+		paired := seq[:0]
+		for i := 0; i < len(seq); i++ {
+			if i+1 < len(seq) && seq[i] == best[0] && seq[i+1] == best[1] {
+				paired = append(paired, id)
+				i++
+			} else {
+				paired = append(paired, seq[i])
+			}
+		}
+		seq = paired
+	}
+
+	// canonical codes: the longest codes go to the lowest symbols and have
+	// the lowest values, symbols that are only ever part of a pair come
+	// after all the ones with codes
+	freq := make([]int, len(syms))
+	for _, id := range seq {
+		freq[id]++
+	}
+	length := huffmanLengths(freq)
+	var used []int
+	for id, l := range length {
+		if l > 0 {
+			used = append(used, id)
+		}
+	}
+	slices.SortStableFunc(used, func(a, b int) int { return cmp.Compare(length[b], length[a]) })
+	renumbered := make([]int, len(syms))
+	for i := range renumbered {
+		renumbered[i] = -1
+	}
+	for i, id := range used {
+		renumbered[id] = i
+	}
+	next := len(used)
+	for id := range syms {
+		if renumbered[id] < 0 {
+			renumbered[id] = next
+			next++
+		}
+	}
+
+	minLen, maxLen := length[used[len(used)-1]], length[used[0]]
+	if maxLen > 32 {
+		return c, fmt.Errorf("%d bit code", maxLen)
+	}
+	lengths := maxLen - minLen + 1
+	count := make([]int, lengths)
+	for _, id := range used {
+		count[length[id]-minLen]++
+	}
+	lowest := make([]int, lengths)
+	base := make([]uint64, lengths)
+	for i := lengths - 2; i >= 0; i-- {
+		lowest[i] = lowest[i+1] + count[i+1]
+		base[i] = (base[i+1] + uint64(count[i+1])) / 2
+	}
+
+	btree := make([]byte, 3*len(syms))
+	for id, sym := range syms {
+		left, right := sym.left, 0xfff
+		if sym.right >= 0 {
+			left, right = renumbered[sym.left], renumbered[sym.right]
+		}
+		e := btree[3*renumbered[id]:]
+		e[0], e[1], e[2] = byte(left), byte(left>>8&0xf)|byte(right&0xf)<<4, byte(right>>4)
+	}
+
+	// whole symbols to a block, leaving the 64 bits the decoder reads ahead
+	const blockLog, spanLog = 6, 8
+	const blockBits = 8<<blockLog - 64
+	var blockValues []int
+	block := make([]byte, 1<<blockLog)
+	bit, n := 0, 0
+	flush := func() {
+		c.data = append(c.data, block...)
+		blockValues = append(blockValues, n)
+		block = make([]byte, 1<<blockLog)
+		bit, n = 0, 0
+	}
+	for _, id := range seq {
+		l := length[id]
+		code := base[l-minLen] + uint64(renumbered[id]-lowest[l-minLen])
+		if bit+l > blockBits || n+syms[id].values > 1<<16 {
+			flush()
+		}
+		for x := range l {
+			if code>>(l-1-x)&1 != 0 {
+				block[(bit+x)/8] |= 0x80 >> ((bit + x) % 8)
+			}
+		}
+		bit += l
+		n += syms[id].values
+	}
+	flush()
+
+	// the block and offset of the value in the middle of each span; past
+	// the end they're in padding blocks of padValues values
+	const padValues = 256
+	numBlocks := len(blockValues)
+	starts := make([]int, numBlocks)
+	for b := 1; b < numBlocks; b++ {
+		starts[b] = starts[b-1] + blockValues[b-1]
+	}
+	span := 1 << spanLog
+	lastBlock := numBlocks
+	for k := 0; k*span < len(vals); k++ {
+		mid := k*span + span/2
+		var block, offset int
+		if mid < len(vals) {
+			block = sort.SearchInts(starts, mid+1) - 1
+			offset = mid - starts[block]
+		} else {
+			block, offset = numBlocks+(mid-len(vals))/padValues, (mid-len(vals))%padValues
+		}
+		lastBlock = max(lastBlock, block+1)
+		c.sparse = binary.LittleEndian.AppendUint32(c.sparse, uint32(block))
+		c.sparse = binary.LittleEndian.AppendUint16(c.sparse, uint16(offset))
+	}
+	for b := range lastBlock {
+		n := padValues
+		if b < numBlocks {
+			n = blockValues[b]
+		}
+		c.lengths = binary.LittleEndian.AppendUint16(c.lengths, uint16(n-1))
+	}
+
+	h := []byte{flags, blockLog, spanLog, byte(lastBlock - numBlocks)}
+	h = binary.LittleEndian.AppendUint32(h, uint32(numBlocks))
+	h = append(h, byte(maxLen), byte(minLen))
+	for _, l := range lowest {
+		h = binary.LittleEndian.AppendUint16(h, uint16(l))
+	}
+	h = binary.LittleEndian.AppendUint16(h, uint16(len(syms)))
+	h = append(h, btree...)
+	c.header = append(h, make([]byte, len(syms)&1)...)
+	return c, nil
+}
+
+// huffmanLengths gives each symbol with a frequency the length of its
+// Huffman code.
+func huffmanLengths(freq []int) []int {
+	length := make([]int, len(freq))
+	type node struct {
+		weight int
+		syms   []int
+	}
+	var nodes []node
+	for sym, n := range freq {
+		if n > 0 {
+			nodes = append(nodes, node{n, []int{sym}})
+		}
+	}
+	if len(nodes) == 1 {
+		length[nodes[0].syms[0]] = 1
+		return length
+	}
+	for len(nodes) > 1 {
+		slices.SortStableFunc(nodes, func(a, b node) int { return cmp.Compare(a.weight, b.weight) })
+		merged := node{nodes[0].weight + nodes[1].weight, slices.Concat(nodes[0].syms, nodes[1].syms)}
+		for _, sym := range merged.syms {
+			length[sym]++
+		}
+		nodes = append(nodes[2:], merged)
+	}
+	return length
+}
@@ -0,0 +1,581 @@
+package syzygy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"gochess/core"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const maxPieces = 7
+
+var (
+	wdlMagic = [4]byte{0x71, 0xe8, 0x23, 0x5d}
+	dtzMagic = [4]byte{0xd7, 0x66, 0x0c, 0xa5}
+)
+
+// table is one ending, like KRvK. It's stored with the side named first as
+// white; key2 is the same ending with the colours swapped.
+type table struct {
+	name       string
+	key, key2  string
+	pieceCount int
+	hasPawns   bool
+	hasUnique  bool   // some piece other than a king is the only one of its kind
+	pawnCount  [2]int // of the leading colour, then the other one
+
+	wdlPath, dtzPath string
+
+	wdlOnce, dtzOnce sync.Once
+	wdl, dtz         *tableFile
+}
+
+// tableFile is a WDL or DTZ file, read in.
+type tableFile struct {
+	data   []byte
+	pairs  [2][4]pairsData // by side to move and file of the leading pawn
+	dtzMap []byte
+}
+
+func newTable(name string) (*table, error) {
+	white, black, ok := strings.Cut(name, "v")
+	if !ok || !validSide(white) || !validSide(black) {
+		return nil, fmt.Errorf("%s: not a table name", name)
+	}
+	t := &table{
+		name:       name,
+		key:        white + "v" + black,
+		key2:       black + "v" + white,
+		pieceCount: len(white) + len(black),
+	}
+	if t.pieceCount > maxPieces {
+		return nil, fmt.Errorf("%s: too many pieces", name)
+	}
+
+	for _, side := range []string{white, black} {
+		for _, c := range "QRBNP" {
+			if strings.Count(side, string(c)) == 1 {
+				t.hasUnique = true
+			}
+		}
+	}
+
+	// the leading colour is the one with fewer pawns, as long as it has any
+	wp, bp := strings.Count(white, "P"), strings.Count(black, "P")
+	t.hasPawns = wp+bp > 0
+	if bp == 0 || (wp > 0 && bp >= wp) {
+		t.pawnCount = [2]int{wp, bp}
+	} else {
+		t.pawnCount = [2]int{bp, wp}
+	}
+	return t, nil
+}
+
+func validSide(s string) bool {
+	if len(s) == 0 || s[0] != 'K' {
+		return false
+	}
+	order := "KQRBNP"
+	last := 0
+	for i, c := range s {
+		n := strings.IndexRune(order, c)
+		if n < 0 || n < last || (i > 0 && n == 0) {
+			return false
+		}
+		last = n
+	}
+	return true
+}
+
+func (t *table) symmetric() bool {
+	return t.key == t.key2
+}
+
+// keyOf names the material on b the way table keys do.
+func keyOf(b *core.Board) string {
+	var sb strings.Builder
+	for color := range 2 {
+		if color == 1 {
+			sb.WriteByte('v')
+		}
+		sb.WriteByte('K')
+		for pt := core.PieceTypeQueen; pt >= core.PieceTypePawn; pt-- {
+			for range b.PieceBitboards[color][pt-1].All() {
+				sb.WriteByte(" PNBRQ"[pt])
+			}
+		}
+	}
+	return sb.String()
+}
+
+// file loads the WDL or DTZ file the first time it's needed, nil if it
+// isn't there or can't be read.
+func (t *table) file(dtz bool) *tableFile {
+	if dtz {
+		t.dtzOnce.Do(func() { t.dtz = t.load(t.dtzPath, true) })
+		return t.dtz
+	}
+	t.wdlOnce.Do(func() { t.wdl = t.load(t.wdlPath, false) })
+	return t.wdl
+}
+
+func (t *table) load(path string, dtz bool) *tableFile {
+	if path == "" {
+		return nil
+	}
+	data, err := mapFile(path)
+	if err != nil {
+		return nil
+	}
+	f := &tableFile{data: data}
+	if err := t.parse(f, dtz); err != nil {
+		return nil
+	}
+	return f
+}
+
+// parse reads the headers of a table file and finds where everything is.
+func (t *table) parse(f *tableFile, dtz bool) error {
+	data := f.data
+	magic := wdlMagic
+	if dtz {
+		magic = dtzMagic
+	}
+	if len(data) < 5 || [4]byte(data[:4]) != magic {
+		return errCorrupt
+	}
+	if (data[4]&2 != 0) != t.hasPawns {
+		return errCorrupt
+	}
+	pos := 5
+
+	sides := 1
+	if !dtz && !t.symmetric() {
+		sides = 2
+	}
+	files := 1
+	if t.hasPawns {
+		files = 4
+	}
+	pp := 0 // pawns on both sides
+	if t.hasPawns && t.pawnCount[1] > 0 {
+		pp = 1
+	}
+
+	for file := range files {
+		if pos+1+pp+t.pieceCount > len(data) {
+			return errCorrupt
+		}
+		order := [2][2]int{{int(data[pos] & 0xf), 0xf}, {int(data[pos] >> 4), 0xf}}
+		if pp == 1 {
+			order[0][1], order[1][1] = int(data[pos+1]&0xf), int(data[pos+1]>>4)
+		}
+		pos += 1 + pp
+
+		for k := range t.pieceCount {
+			for i := range sides {
+				p := data[pos]
+				if i == 1 {
+					p >>= 4
+				}
+				f.pairs[i][file].pieces[k] = p & 0xf
+			}
+			pos++
+		}
+		for i := range sides {
+			if err := t.setGroups(&f.pairs[i][file], order[i], file); err != nil {
+				return err
+			}
+		}
+	}
+	pos += pos & 1
+
+	var err error
+	for file := range files {
+		for i := range sides {
+			if pos, err = f.pairs[i][file].setSizes(data, pos); err != nil {
+				return err
+			}
+		}
+	}
+
+	if dtz {
+		if pos, err = f.setDTZMap(pos, files); err != nil {
+			return err
+		}
+	}
+
+	for file := range files {
+		for i := range sides {
+			d := &f.pairs[i][file]
+			n := 6 * d.sparseIndexSize
+			if pos+n > len(data) {
+				return errCorrupt
+			}
+			d.sparseIndex = data[pos : pos+n]
+			pos += n
+		}
+	}
+	for file := range files {
+		for i := range sides {
+			d := &f.pairs[i][file]
+			n := 2 * d.blockLengthSize
+			if pos+n > len(data) {
+				return errCorrupt
+			}
+			d.blockLength = data[pos : pos+n]
+			pos += n
+		}
+	}
+	for file := range files {
+		for i := range sides {
+			d := &f.pairs[i][file]
+			pos = (pos + 0x3f) &^ 0x3f
+			n := d.numBlocks * d.blockSize
+			if pos+n > len(data) {
+				return errCorrupt
+			}
+			d.data = data[pos : pos+n]
+			pos += n
+		}
+	}
+	return nil
+}
+
+// setGroups splits the pieces into the groups they're encoded in and works
+// out each group's multiplier. order says where the leading group, and the
+// other side's pawns, come in the encoding.
+func (t *table) setGroups(d *pairsData, order [2]int, file int) error {
+	firstLen := 2
+	switch {
+	case t.hasPawns:
+		firstLen = 0
+	case t.hasUnique:
+		firstLen = 3
+	}
+
+	n := 0
+	d.groupLen[0] = 1
+	for i := 1; i < t.pieceCount; i++ {
+		firstLen--
+		if firstLen > 0 || d.pieces[i] == d.pieces[i-1] {
+			d.groupLen[n]++
+		} else {
+			n++
+			d.groupLen[n] = 1
+		}
+	}
+	n++
+	d.groupLen[n] = 0
+	for _, l := range d.groupLen[:n] {
+		if l > 5 {
+			return errCorrupt
+		}
+	}
+
+	pp := t.hasPawns && t.pawnCount[1] > 0
+	next, free := 1, 64-d.groupLen[0]
+	if pp {
+		next = 2
+		free -= d.groupLen[1]
+	}
+
+	idx := uint64(1)
+	for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+		switch {
+		case k > maxPieces:
+			return errCorrupt
+		case k == order[0]: // the leading group
+			d.groupIdx[0] = idx
+			switch {
+			case t.hasPawns:
+				idx *= leadPawnsSize[d.groupLen[0]][file]
+			case t.hasUnique:
+				idx *= 31332
+			default:
+				idx *= 462
+			}
+		case k == order[1]: // the other side's pawns
+			d.groupIdx[1] = idx
+			idx *= binomial[d.groupLen[1]][48-d.groupLen[0]]
+		default:
+			if next >= n {
+				return errCorrupt
+			}
+			d.groupIdx[next] = idx
+			idx *= binomial[d.groupLen[next]][free]
+			free -= d.groupLen[next]
+			next++
+		}
+	}
+	d.groupIdx[n] = idx
+	return nil
+}
+
+// setDTZMap finds the maps from stored DTZ values to real ones, one for
+// each result, which come after the pairs headers.
+func (f *tableFile) setDTZMap(pos, files int) (int, error) {
+	data := f.data
+	start := pos
+	for file := range files {
+		d := &f.pairs[0][file]
+		if d.flags&flagMapped == 0 {
+			continue
+		}
+		if d.flags&flagWide != 0 {
+			pos += pos & 1
+			for i := range 4 {
+				if pos+2 > len(data) {
+					return 0, errCorrupt
+				}
+				d.dtzMapIdx[i] = (pos-start)/2 + 1
+				pos += 2*int(binary.LittleEndian.Uint16(data[pos:])) + 2
+			}
+		} else {
+			for i := range 4 {
+				if pos+1 > len(data) {
+					return 0, errCorrupt
+				}
+				d.dtzMapIdx[i] = pos - start + 1
+				pos += int(data[pos]) + 1
+			}
+		}
+	}
+	if pos > len(data) {
+		return 0, errCorrupt
+	}
+	f.dtzMap = data[start:pos]
+	pos += pos & 1
+	return pos, nil
+}
+
+// probe looks the position up in the WDL or DTZ file. For DTZ it returns
+// changeSTM when the file only has the other side to move.
+func (t *table) probe(b *core.Board, dtz bool, wdl int) (int, probeState) {
+	f := t.file(dtz)
+	if f == nil {
+		return 0, stateFail
+	}
+	d, idx, state := t.encode(b, f, dtz)
+	if state != stateOK {
+		return 0, state
+	}
+
+	value, err := d.decompress(idx)
+	if err != nil {
+		return 0, stateFail
+	}
+	if !dtz {
+		return value - 2, stateOK
+	}
+	return f.mapDTZ(d, value, wdl), stateOK
+}
+
+// encode works out which part of the file has the position on b, and its
+// index there.
+func (t *table) encode(b *core.Board, f *tableFile, dtz bool) (*pairsData, uint64, probeState) {
+	// the tables have the first named side as white, and if both sides are
+	// the same only white to move
+	symmetricBlackToMove := t.symmetric() && !b.WhiteToMove
+	blackStronger := keyOf(b) != t.key
+	flip := symmetricBlackToMove || blackStronger
+	var flipColor core.Piece
+	var flipSquares core.Position
+	stm := 0
+	if !b.WhiteToMove {
+		stm = 1
+	}
+	if flip {
+		flipColor, flipSquares = 8, 56
+		stm ^= 1
+	}
+
+	var squares [maxPieces]core.Position
+	var pieces [maxPieces]core.Piece
+	size, leadPawns := 0, 0
+	var leadPawnsBB core.Bitboard
+	tbFile := 0
+
+	if t.hasPawns {
+		// the pawns of the leading colour come first, with the one nearest
+		// the edge at the front; its file picks the table
+		pc := core.Piece(f.pairs[0][0].pieces[0]) ^ flipColor
+		leadPawnsBB = b.PieceBitboards[pc.Color()>>3][core.PieceTypePawn-1]
+		for sq := range leadPawnsBB.All() {
+			squares[size] = sq ^ flipSquares
+			size++
+		}
+		leadPawns = size
+		best := 0
+		for i := 1; i < leadPawns; i++ {
+			if pawnsBefore(squares[best], squares[i]) {
+				best = i
+			}
+		}
+		squares[0], squares[best] = squares[best], squares[0]
+		tbFile = int(squares[0] & 7)
+		tbFile = min(tbFile, 7-tbFile)
+	}
+
+	if dtz {
+		flags := f.pairs[0][tbFile].flags
+		if int(flags&flagSTM) != stm && !(t.symmetric() && !t.hasPawns) {
+			return nil, 0, stateChangeSTM
+		}
+	}
+
+	for sq := range (b.AllPieces &^ leadPawnsBB).All() {
+		squares[size] = sq ^ flipSquares
+		pieces[size] = b.Pieces[sq] ^ flipColor
+		size++
+	}
+	if size != t.pieceCount {
+		return nil, 0, stateFail
+	}
+
+	d := &f.pairs[stm][tbFile]
+	if dtz {
+		d = &f.pairs[0][tbFile]
+	}
+
+	// put the pieces in the file's order
+	for i := leadPawns; i < size-1; i++ {
+		for j := i + 1; j < size; j++ {
+			if core.Piece(d.pieces[i]) == pieces[j] {
+				pieces[i], pieces[j] = pieces[j], pieces[i]
+				squares[i], squares[j] = squares[j], squares[i]
+				break
+			}
+		}
+	}
+
+	// mirror so the leading piece is on the a-d files
+	if squares[0]&7 > 3 {
+		for i := range size {
+			squares[i] = flipFile(squares[i])
+		}
+	}
+
+	var idx uint64
+	if t.hasPawns {
+		idx = leadPawnIdx[leadPawns][squares[0]]
+		slices.SortStableFunc(squares[1:leadPawns], func(a, b core.Position) int {
+			return mapPawns[a] - mapPawns[b]
+		})
+		for i := 1; i < leadPawns; i++ {
+			idx += binomial[i][mapPawns[squares[i]]]
+		}
+	} else {
+		// and without pawns in the a1-d1-d4 triangle, with the first
+		// piece of the leading group off the diagonal below it
+		if squares[0]>>3 > 3 {
+			for i := range size {
+				squares[i] = flipRank(squares[i])
+			}
+		}
+		for i := range d.groupLen[0] {
+			off := offA1H8(squares[i])
+			if off == 0 {
+				continue
+			}
+			if off > 0 {
+				for j := i; j < size; j++ {
+					squares[j] = (squares[j]>>3 | squares[j]<<3) & 63
+				}
+			}
+			break
+		}
+		idx = t.leadingIndex(&squares)
+	}
+
+	idx *= d.groupIdx[0]
+	start := d.groupLen[0]
+	remainingPawns := t.hasPawns && t.pawnCount[1] > 0
+	for next := 1; d.groupLen[next] != 0; next++ {
+		group := squares[start : start+d.groupLen[next]]
+		slices.Sort(group)
+		var n uint64
+		for i, sq := range group {
+			// squares taken by earlier groups don't count
+			adjust := 0
+			for _, s := range squares[:start] {
+				if sq > s {
+					adjust++
+				}
+			}
+			v := int(sq) - adjust
+			if remainingPawns {
+				v -= 8
+			}
+			n += binomial[i+1][v]
+		}
+		remainingPawns = false
+		idx += n * d.groupIdx[next]
+		start += d.groupLen[next]
+	}
+	return d, idx, stateOK
+}
+
+// leadingIndex encodes the leading group without pawns: the two kings, or
+// with a unique piece around the first three pieces.
+func (t *table) leadingIndex(squares *[maxPieces]core.Position) uint64 {
+	s := squares
+	if !t.hasUnique {
+		return uint64(mapKK[mapA1D1D4[s[0]]][s[1]])
+	}
+
+	adjust1, adjust2 := 0, 0
+	if s[1] > s[0] {
+		adjust1 = 1
+	}
+	if s[2] > s[0] {
+		adjust2++
+	}
+	if s[2] > s[1] {
+		adjust2++
+	}
+	rank := func(sq core.Position) int { return int(sq >> 3) }
+
+	var idx int
+	switch {
+	case offA1H8(s[0]) != 0:
+		idx = (mapA1D1D4[s[0]]*63+int(s[1])-adjust1)*62 + int(s[2]) - adjust2
+	case offA1H8(s[1]) != 0:
+		idx = (6*63+rank(s[0])*28+mapB1H1H7[s[1]])*62 + int(s[2]) - adjust2
+	case offA1H8(s[2]) != 0:
+		idx = 6*63*62 + 4*28*62 + rank(s[0])*7*28 + (rank(s[1])-adjust1)*28 + mapB1H1H7[s[2]]
+	default:
+		idx = 6*63*62 + 4*28*62 + 4*7*28 + rank(s[0])*7*6 + (rank(s[1])-adjust1)*6 + rank(s[2]) - adjust2
+	}
+	return uint64(idx)
+}
+
+// mapDTZ turns a stored DTZ value into plies, wdl being the position's
+// result.
+func (f *tableFile) mapDTZ(d *pairsData, value, wdl int) int {
+	wdlMap := [5]int{1, 3, 0, 2, 0}
+	if d.flags&flagMapped != 0 {
+		i := d.dtzMapIdx[wdlMap[wdl+2]] + value
+		if d.flags&flagWide != 0 {
+			if 2*i+2 > len(f.dtzMap) {
+				return 0
+			}
+			value = int(binary.LittleEndian.Uint16(f.dtzMap[2*i:]))
+		} else {
+			if i >= len(f.dtzMap) {
+				return 0
+			}
+			value = int(f.dtzMap[i])
+		}
+	}
+
+	// some are stored in moves rather than plies
+	if (wdl == Win && d.flags&flagWinPlies == 0) ||
+		(wdl == Loss && d.flags&flagLossPlies == 0) ||
+		wdl == CursedWin || wdl == BlessedLoss {
+		value *= 2
+	}
+	return value + 1
+}
@@ -0,0 +1,289 @@
+package tablebase
+
+import (
+	"fmt"
+	"gochess/core"
+	"slices"
+)
+
+// Values are distances to mate in plies, stored as plies+1 so 0 is left for
+// draws (and for indices that aren't positions). Odd distances are wins for
+// the side to move, even ones losses: a side can only mate on its own move.
+const maxPlies = 254
+
+// cantLose marks a position in the generator's successor counts that has a
+// move to a draw or a win, so it never turns into a loss.
+const cantLose = 0xff
+
+// generator builds one table by retrograde analysis. A first pass over all
+// positions plays every move forward: captures and promotions leave the
+// table and are looked up in the smaller tables, the other moves are
+// counted. Then positions are resolved in order of distance to mate,
+// starting from the checkmates. Once a position is lost, everything that
+// can move into it is won one ply further out; once a position is won, each
+// position that can move into it has one move fewer that doesn't lose, and
+// when none are left it's lost too.
+type generator struct {
+	t   *table
+	sub *Tablebases
+
+	board *core.Board
+	sqs   [maxMen]core.Position
+
+	// per index, while generating
+	count     []uint8
+	lossFloor []uint8 // the loss can't be any shorter than this
+	buckets   [maxPlies + 1][]int32
+}
+
+// generate builds the table for m, looking up the tables it leads into in sub.
+func generate(m Material, sub *Tablebases) (*table, error) {
+	if !m.canonical() {
+		return nil, fmt.Errorf("%v: tables are built with the stronger side as white", m)
+	}
+	if m.Men() > maxMen {
+		return nil, fmt.Errorf("%v: at most %d men", m, maxMen)
+	}
+
+	g := &generator{
+		t:     newTable(m),
+		sub:   sub,
+		board: core.NewBoard(),
+	}
+	g.board.CastlingRights = core.CastlingRightsNone
+
+	t := g.t
+	t.values = make([]uint8, t.size)
+	g.count = make([]uint8, t.size)
+	g.lossFloor = make([]uint8, t.size)
+
+	for idx := range t.size {
+		if err := g.initial(idx); err != nil {
+			return nil, err
+		}
+	}
+
+	var preds []int
+	for plies := range maxPlies + 1 {
+		for _, idx := range g.buckets[plies] {
+			if t.values[idx] != 0 {
+				continue
+			}
+			t.values[idx] = uint8(plies + 1)
+
+			preds = g.predecessors(int(idx), preds[:0])
+			for _, p := range preds {
+				if t.values[p] != 0 {
+					continue
+				}
+				if plies%2 == 0 {
+					g.push(p, plies+1) // p has a move to a lost position
+					continue
+				}
+				if g.count[p] == cantLose {
+					continue
+				}
+				g.lossFloor[p] = max(g.lossFloor[p], uint8(plies+1))
+				g.count[p]--
+				if g.count[p] == 0 {
+					g.push(p, int(g.lossFloor[p]))
+				}
+			}
+		}
+		g.buckets[plies] = nil
+	}
+
+	return t, nil
+}
+
+func (g *generator) push(idx, plies int) {
+	if plies > maxPlies {
+		// too long to store, it'll come out as a draw
+		return
+	}
+	g.buckets[plies] = append(g.buckets[plies], int32(idx))
+}
+
+// setup puts the position at idx on the generator's board, false if there's
+// no such position or idx isn't its index.
+func (g *generator) setup(idx int) bool {
+	t, b := g.t, g.board
+
+	for sq := range b.AllPieces.All() {
+		b.RemovePiece(sq, b.Pieces[sq])
+	}
+
+	stm := t.decode(idx, &g.sqs)
+	var occ core.Bitboard
+	for i := range t.men {
+		sq := g.sqs[i]
+		piece := t.pieceAt(i)
+		if occ&(1<<sq) != 0 {
+			return false
+		}
+		if piece.Type() == core.PieceTypePawn && (sq>>3 == 0 || sq>>3 == 7) {
+			return false
+		}
+		occ |= 1 << sq
+		b.AddPiece(sq, piece)
+	}
+	b.WhiteToMove = stm == 0
+	b.EnPassantTarget = 64
+
+	// the side that just moved can't be in check
+	if b.IsSquareAttacked(b.KingSquare(!b.WhiteToMove), b.WhiteToMove) {
+		return false
+	}
+
+	var sqs [maxMen]core.Position
+	stm = t.squares(b, false, &sqs)
+	return t.index(&sqs, stm) == idx
+}
+
+// initial plays all the moves of the position at idx forward.
+func (g *generator) initial(idx int) error {
+	if !g.setup(idx) {
+		return nil
+	}
+	b := g.board
+
+	var buf [core.MaxMoves]core.Move
+	moves := b.GenerateLegalMovesInto(&buf)
+	if len(moves) == 0 {
+		if b.InCheck(b.WhiteToMove) {
+			g.push(idx, 0)
+		}
+		return nil // stalemate stays a draw
+	}
+
+	var succ [core.MaxMoves]int
+	nSucc := 0
+	win, lossFloor, cantLoseHere := maxPlies+1, 0, false
+
+	for _, move := range moves {
+		if b.Pieces[move.To] == core.PieceNone && move.Promotion == core.PieceNone {
+			b.Push(&move)
+			var sqs [maxMen]core.Position
+			stm := g.t.squares(b, false, &sqs)
+			s := g.t.index(&sqs, stm)
+			b.Pop()
+			if !slices.Contains(succ[:nSucc], s) {
+				succ[nSucc] = s
+				nSucc++
+			}
+			continue
+		}
+
+		// leaves the table
+		b.Push(&move)
+		v, ok := g.sub.value(b)
+		b.Pop()
+		if !ok {
+			return fmt.Errorf("%v: no table for %v", g.t.material, materialAfter(b, move))
+		}
+
+		switch {
+		case v == 0:
+			cantLoseHere = true
+		case (v-1)%2 == 0:
+			win = min(win, int(v)) // they're lost in v-1 plies
+			cantLoseHere = true
+		default:
+			lossFloor = max(lossFloor, int(v))
+		}
+	}
+
+	if win <= maxPlies {
+		g.push(idx, win)
+	}
+
+	switch {
+	case cantLoseHere:
+		g.count[idx] = cantLose
+	case nSucc == 0:
+		// every move leaves the table into a loss
+		g.push(idx, lossFloor)
+	default:
+		g.count[idx] = uint8(nSucc)
+		g.lossFloor[idx] = uint8(lossFloor)
+	}
+	return nil
+}
+
+// predecessors appends the indices of the positions that can reach the one
+// at idx with a move that stays in the table, each only once.
+func (g *generator) predecessors(idx int, preds []int) []int {
+	g.setup(idx)
+	b := g.board
+
+	mover := !b.WhiteToMove
+	side := 0
+	if !mover {
+		side = 1
+	}
+
+	for pt := uint8(core.PieceTypePawn); pt <= core.PieceTypeKing; pt++ {
+		piece := core.Piece(pt)
+		if !mover {
+			piece |= core.PieceColorBlack
+		}
+
+		for to := range b.PieceBitboards[side][pt-1].All() {
+			var froms core.Bitboard
+			if pt == core.PieceTypePawn {
+				froms = pawnOrigins(b, to, mover)
+			} else {
+				froms = core.Attacks(pt, to, b.AllPieces) &^ b.AllPieces
+			}
+
+			for from := range froms.All() {
+				b.RemovePiece(to, piece)
+				b.AddPiece(from, piece)
+				b.WhiteToMove = mover
+
+				// the side to move in idx mustn't have been left in check
+				if !b.IsSquareAttacked(b.KingSquare(!mover), mover) {
+					var sqs [maxMen]core.Position
+					stm := g.t.squares(b, false, &sqs)
+					if p := g.t.index(&sqs, stm); !slices.Contains(preds, p) {
+						preds = append(preds, p)
+					}
+				}
+
+				b.WhiteToMove = !mover
+				b.RemovePiece(from, piece)
+				b.AddPiece(to, piece)
+			}
+		}
+	}
+	return preds
+}
+
+// pawnOrigins returns where a pawn of the given colour on to could have
+// come from without capturing.
+func pawnOrigins(b *core.Board, to core.Position, white bool) core.Bitboard {
+	rank := to >> 3
+	var froms core.Bitboard
+	if white {
+		if rank >= 2 && b.Pieces[to-8] == core.PieceNone {
+			froms |= 1 << (to - 8)
+			if rank == 3 && b.Pieces[to-16] == core.PieceNone {
+				froms |= 1 << (to - 16)
+			}
+		}
+	} else {
+		if rank <= 5 && b.Pieces[to+8] == core.PieceNone {
+			froms |= 1 << (to + 8)
+			if rank == 4 && b.Pieces[to+16] == core.PieceNone {
+				froms |= 1 << (to + 16)
+			}
+		}
+	}
+	return froms
+}
+
+func materialAfter(b *core.Board, move core.Move) Material {
+	b.Push(&move)
+	defer b.Pop()
+	return materialOf(b)
+}
@@ -0,0 +1,186 @@
+package tablebase
+
+import (
+	"gochess/core"
+	"slices"
+)
+
+const maxMen = 5
+
+// A table index is built from the squares of the pieces in a fixed order:
+// white king, black king, then the rest of white's and black's pieces as
+// listed in the material. The white king only gets a small region of the
+// board, since every position can be mirrored so it lands there: the a1-d1-d4
+// triangle without pawns, the a-d files with them (pawns only allow the
+// left-right mirror). Pieces of the same kind are sorted by square, and of
+// all the mirror images the one with the smallest index is used, so every
+// position has exactly one index however it's reached.
+
+var (
+	triangle     [64]int // index into the triangle, -1 outside it
+	triangleSqs  []core.Position
+	halfBoard    [64]int
+	halfBoardSqs []core.Position
+)
+
+func init() {
+	for sq := range core.Position(64) {
+		file, rank := int(sq&7), int(sq>>3)
+		triangle[sq], halfBoard[sq] = -1, -1
+		if file <= 3 && rank <= file {
+			triangle[sq] = len(triangleSqs)
+			triangleSqs = append(triangleSqs, sq)
+		}
+		if file <= 3 {
+			halfBoard[sq] = len(halfBoardSqs)
+			halfBoardSqs = append(halfBoardSqs, sq)
+		}
+	}
+}
+
+// mirror applies one of the 8 symmetries of the board to sq: bit 2 swaps
+// files and ranks, bit 0 flips the files and bit 1 the ranks.
+func mirror(sq core.Position, sym int) core.Position {
+	if sym&4 != 0 {
+		sq = sq>>3 | sq&7<<3
+	}
+	if sym&1 != 0 {
+		sq ^= 7
+	}
+	if sym&2 != 0 {
+		sq ^= 56
+	}
+	return sq
+}
+
+// group is a run of identical pieces in the piece order.
+type group struct {
+	piece      core.Piece
+	start, end int
+}
+
+type table struct {
+	material Material
+	men      int
+	groups   []group
+	syms     []int
+	region   *[64]int
+	kingSqs  []core.Position
+	size     int
+	values   []uint8
+}
+
+func newTable(m Material) *table {
+	t := &table{material: m, men: m.Men()}
+
+	pieces := []core.Piece{core.PieceWhiteKing, core.PieceBlackKing}
+	for _, pt := range m.White {
+		pieces = append(pieces, core.Piece(pt))
+	}
+	for _, pt := range m.Black {
+		pieces = append(pieces, core.Piece(pt|core.PieceColorBlack))
+	}
+	for i, piece := range pieces {
+		if i > 0 && piece == pieces[i-1] {
+			t.groups[len(t.groups)-1].end++
+		} else {
+			t.groups = append(t.groups, group{piece: piece, start: i, end: i + 1})
+		}
+	}
+
+	if m.pawns() > 0 {
+		t.syms = []int{0, 1}
+		t.region, t.kingSqs = &halfBoard, halfBoardSqs
+	} else {
+		t.syms = []int{0, 1, 2, 3, 4, 5, 6, 7}
+		t.region, t.kingSqs = &triangle, triangleSqs
+	}
+
+	t.size = 2 * len(t.kingSqs)
+	for range t.men - 1 {
+		t.size *= 64
+	}
+	return t
+}
+
+// squares reads the pieces off b in table order. With flip the colours are
+// swapped and the board turned upside down, for positions where black has
+// the material the table was built with for white.
+func (t *table) squares(b *core.Board, flip bool, sqs *[maxMen]core.Position) (stm int) {
+	for _, g := range t.groups {
+		color := g.piece.Color() >> 3
+		if flip {
+			color ^= 1
+		}
+		i := g.start
+		for sq := range b.PieceBitboards[color][g.piece.Type()-1].All() {
+			if flip {
+				sq ^= 56
+			}
+			sqs[i] = sq
+			i++
+		}
+	}
+
+	if b.WhiteToMove == flip {
+		return 1
+	}
+	return 0
+}
+
+// index returns the position's index, from the squares in table order and
+// the side to move (0 white, 1 black).
+func (t *table) index(sqs *[maxMen]core.Position, stm int) int {
+	best := -1
+	for _, sym := range t.syms {
+		region := t.region[mirror(sqs[0], sym)]
+		if region < 0 {
+			continue
+		}
+
+		var m [maxMen]core.Position
+		for i := range t.men {
+			m[i] = mirror(sqs[i], sym)
+		}
+		for _, g := range t.groups {
+			if g.end-g.start > 1 {
+				slices.Sort(m[g.start:g.end])
+			}
+		}
+
+		idx := region
+		for i := 1; i < t.men; i++ {
+			idx = idx*64 + int(m[i])
+		}
+		idx = idx*2 + stm
+
+		if best < 0 || idx < best {
+			best = idx
+		}
+	}
+	return best
+}
+
+// decode is the reverse of index. Not every index decodes to a position
+// with that index, most of them are mirror images or have pieces sharing a
+// square.
+func (t *table) decode(idx int, sqs *[maxMen]core.Position) (stm int) {
+	stm = idx & 1
+	idx >>= 1
+	for i := t.men - 1; i > 0; i-- {
+		sqs[i] = core.Position(idx & 63)
+		idx >>= 6
+	}
+	sqs[0] = t.kingSqs[idx]
+	return stm
+}
+
+// pieceAt returns the piece at position i of the table order.
+func (t *table) pieceAt(i int) core.Piece {
+	for _, g := range t.groups {
+		if i < g.end {
+			return g.piece
+		}
+	}
+	return core.PieceNone
+}
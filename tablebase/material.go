@@ -0,0 +1,155 @@
+package tablebase
+
+import (
+	"cmp"
+	"fmt"
+	"gochess/core"
+	"slices"
+	"strings"
+)
+
+const pieceLetters = " PNBRQK"
+
+var pieceValues = [7]int{0, 1, 3, 3, 5, 9, 0}
+
+// Material is what each side has besides its king, as piece types in
+// descending order. Tables are only built with white as the stronger side,
+// positions with the material the other way around are looked up with the
+// colours swapped.
+type Material struct {
+	White, Black []uint8
+}
+
+// String gives the usual name of the ending, e.g. "KQvKR".
+func (m Material) String() string {
+	return "K" + sideString(m.White) + "vK" + sideString(m.Black)
+}
+
+func sideString(pieces []uint8) string {
+	var sb strings.Builder
+	for _, pt := range pieces {
+		sb.WriteByte(pieceLetters[pt])
+	}
+	return sb.String()
+}
+
+// ParseMaterial reads an ending's name as written by String.
+func ParseMaterial(s string) (Material, error) {
+	white, black, ok := strings.Cut(strings.ToUpper(s), "V")
+	if !ok || !strings.HasPrefix(white, "K") || !strings.HasPrefix(black, "K") {
+		return Material{}, fmt.Errorf("bad material %q, want something like KQvKR", s)
+	}
+
+	var m Material
+	for _, side := range []struct {
+		name   string
+		pieces *[]uint8
+	}{{white[1:], &m.White}, {black[1:], &m.Black}} {
+		for _, c := range side.name {
+			pt := strings.IndexRune(pieceLetters, c)
+			if pt < int(core.PieceTypePawn) || pt == int(core.PieceTypeKing) {
+				return Material{}, fmt.Errorf("bad material %q, want something like KQvKR", s)
+			}
+			*side.pieces = append(*side.pieces, uint8(pt))
+		}
+		slices.SortFunc(*side.pieces, func(a, b uint8) int { return cmp.Compare(b, a) })
+	}
+	return m, nil
+}
+
+// materialOf reads the material off a board.
+func materialOf(b *core.Board) Material {
+	var m Material
+	for pt := uint8(core.PieceTypeQueen); pt >= core.PieceTypePawn; pt-- {
+		for range b.PieceBitboards[0][pt-1].All() {
+			m.White = append(m.White, pt)
+		}
+		for range b.PieceBitboards[1][pt-1].All() {
+			m.Black = append(m.Black, pt)
+		}
+	}
+	return m
+}
+
+// Men counts the pieces, kings included.
+func (m Material) Men() int {
+	return 2 + len(m.White) + len(m.Black)
+}
+
+func (m Material) pawns() int {
+	n := 0
+	for _, pt := range slices.Concat(m.White, m.Black) {
+		if pt == core.PieceTypePawn {
+			n++
+		}
+	}
+	return n
+}
+
+// canonical reports whether white is the side the table is built for.
+func (m Material) canonical() bool {
+	return compareSides(m.White, m.Black) >= 0
+}
+
+func (m Material) flip() Material {
+	return Material{White: m.Black, Black: m.White}
+}
+
+func compareSides(a, b []uint8) int {
+	value := func(pieces []uint8) (v int) {
+		for _, pt := range pieces {
+			v += pieceValues[pt]
+		}
+		return v
+	}
+	if c := cmp.Compare(value(a), value(b)); c != 0 {
+		return c
+	}
+	return slices.Compare(a, b)
+}
+
+// Endings returns every ending with up to men pieces that has a table, in
+// an order where each one only depends on tables earlier in the list:
+// fewer men first, then fewer pawns, since pawns promote.
+func Endings(men int) []Material {
+	var endings []Material
+	for n := 3; n <= men; n++ {
+		for white := 0; white <= n-2; white++ {
+			for _, w := range pieceSets(white) {
+				for _, b := range pieceSets(n - 2 - white) {
+					if m := (Material{White: w, Black: b}); m.canonical() {
+						endings = append(endings, m)
+					}
+				}
+			}
+		}
+	}
+
+	slices.SortStableFunc(endings, func(a, b Material) int {
+		if c := cmp.Compare(a.Men(), b.Men()); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.pawns(), b.pawns())
+	})
+	return endings
+}
+
+// pieceSets returns all the ways to pick n pieces, in descending order.
+func pieceSets(n int) [][]uint8 {
+	if n == 0 {
+		return [][]uint8{nil}
+	}
+	var sets [][]uint8
+	var pick func(set []uint8, top uint8)
+	pick = func(set []uint8, top uint8) {
+		if len(set) == n {
+			sets = append(sets, slices.Clone(set))
+			return
+		}
+		for pt := top; pt >= core.PieceTypePawn; pt-- {
+			pick(append(set, pt), pt)
+		}
+	}
+	pick(nil, core.PieceTypeQueen)
+	return sets
+}
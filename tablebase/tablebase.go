@@ -0,0 +1,338 @@
+package tablebase
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gochess/core"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Ext is the file extension of our tables.
+const Ext = ".dtm"
+
+const magic = "GCTB\x01"
+
+// Tablebases gives access to the tables in a directory. Tables are read
+// into memory the first time a position needs them.
+type Tablebases struct {
+	dir    string
+	maxMen int
+
+	mu     sync.Mutex
+	files  map[string]bool
+	tables map[string]*table
+}
+
+// Open looks for tables in dir.
+func Open(dir string) (*Tablebases, error) {
+	tb, err := New(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(tb.files) == 0 {
+		return nil, fmt.Errorf("no tablebases in %s", dir)
+	}
+	return tb, nil
+}
+
+// New is Open for a directory that may not have any tables yet, to
+// generate them into.
+func New(dir string) (*Tablebases, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	tb := &Tablebases{dir: dir, files: map[string]bool{}, tables: map[string]*table{}}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), Ext)
+		if !ok {
+			continue
+		}
+		m, err := ParseMaterial(name)
+		if err != nil || !m.canonical() || m.Men() > maxMen {
+			continue
+		}
+		tb.files[m.String()] = true
+		tb.maxMen = max(tb.maxMen, m.Men())
+	}
+	return tb, nil
+}
+
+// Has reports whether there's a table for m.
+func (tb *Tablebases) Has(m Material) bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	name := m.String()
+	return tb.files[name] || tb.tables[name] != nil
+}
+
+// MaxMen is the most pieces, kings included, of any table there is.
+func (tb *Tablebases) MaxMen() int {
+	return tb.maxMen
+}
+
+// Generate builds the table for m and saves it in the directory. The
+// tables m can turn into through a capture or promotion have to be there
+// already, Endings gives an order that makes sure of that.
+func (tb *Tablebases) Generate(m Material) error {
+	t, err := generate(m, tb)
+	if err != nil {
+		return err
+	}
+	if err := t.save(tb.dir); err != nil {
+		return err
+	}
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.files[m.String()] = true
+	tb.tables[m.String()] = t
+	tb.maxMen = max(tb.maxMen, t.men)
+	return nil
+}
+
+func (tb *Tablebases) table(m Material) (*table, error) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	name := m.String()
+	if t, ok := tb.tables[name]; ok {
+		return t, nil
+	}
+	if !tb.files[name] {
+		return nil, nil
+	}
+
+	t, err := load(filepath.Join(tb.dir, name+Ext), m)
+	if err != nil {
+		// don't try again
+		delete(tb.files, name)
+		return nil, err
+	}
+	tb.tables[name] = t
+	return t, nil
+}
+
+// value looks up the stored value of the position on b, ignoring castling
+// rights and en passant.
+func (tb *Tablebases) value(b *core.Board) (uint8, bool) {
+	m := materialOf(b)
+	if m.Men() == 2 {
+		return 0, true
+	}
+
+	flip := !m.canonical()
+	if flip {
+		m = m.flip()
+	}
+	t, _ := tb.table(m)
+	if t == nil {
+		return 0, false
+	}
+
+	var sqs [maxMen]core.Position
+	stm := t.squares(b, flip, &sqs)
+	return t.values[t.index(&sqs, stm)], true
+}
+
+// Result is what a table says about a position, for the side to move.
+type Result struct {
+	Outcome int // 1 won, 0 drawn, -1 lost
+	Plies   int // to mate, either way
+}
+
+// Probe looks the position on b up, false when there's no table for it.
+// The tables don't know about castling, and nor about the fifty move rule.
+func (tb *Tablebases) Probe(b *core.Board) (Result, bool) {
+	if bits.OnesCount64(uint64(b.AllPieces)) > tb.maxMen || b.CastlingRights != core.CastlingRightsNone {
+		return Result{}, false
+	}
+
+	// positions are stored without en passant rights, which is only right
+	// if the capture can't actually be played
+	if b.EnPassantTarget != 64 {
+		var buf [core.MaxMoves]core.Move
+		for _, move := range b.GenerateLegalMovesInto(&buf) {
+			if move.To == b.EnPassantTarget && b.Pieces[move.From].Type() == core.PieceTypePawn {
+				return Result{}, false
+			}
+		}
+	}
+
+	v, ok := tb.value(b)
+	if !ok {
+		return Result{}, false
+	}
+	return resultOf(v), true
+}
+
+func resultOf(v uint8) Result {
+	switch {
+	case v == 0:
+		return Result{}
+	case (v-1)%2 == 1:
+		return Result{Outcome: 1, Plies: int(v) - 1}
+	default:
+		return Result{Outcome: -1, Plies: int(v) - 1}
+	}
+}
+
+// better reports whether a is a better result than b for the side it's for.
+func better(a, b Result) bool {
+	if a.Outcome != b.Outcome {
+		return a.Outcome > b.Outcome
+	}
+	switch a.Outcome {
+	case 1:
+		return a.Plies < b.Plies // mate sooner
+	case -1:
+		return a.Plies > b.Plies // and get mated as late as possible
+	}
+	return false
+}
+
+// BestMove picks the move that mates soonest when winning, holds the draw
+// when drawn, and lasts longest when losing. It returns false if any of
+// the moves leads to a position without a table.
+func (tb *Tablebases) BestMove(b *core.Board) (core.Move, Result, bool) {
+	root, ok := tb.Probe(b)
+	if !ok {
+		return core.Move{}, Result{}, false
+	}
+
+	var best core.Move
+	var bestResult Result
+	found := false
+	for _, move := range b.GenerateLegalMoves() {
+		b.Push(&move)
+		child, ok := tb.Probe(b)
+		b.Pop()
+		if !ok {
+			return core.Move{}, Result{}, false
+		}
+
+		// one ply further out, for the other side
+		r := Result{Outcome: -child.Outcome}
+		if child.Outcome != 0 {
+			r.Plies = child.Plies + 1
+		}
+		if !found || better(r, bestResult) {
+			best, bestResult, found = move, r, true
+		}
+	}
+
+	if !found {
+		return core.Move{}, root, false
+	}
+	return best, bestResult, true
+}
+
+// save writes the table to dir.
+func (t *table) save(dir string) error {
+	f, err := os.Create(filepath.Join(dir, t.material.String()+Ext))
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	w.WriteString(magic)
+	binary.Write(w, binary.LittleEndian, uint32(t.size))
+
+	zw, err := flate.NewWriter(w, flate.BestCompression)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := zw.Write(t.values); err != nil {
+		f.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func load(path string, m Material) (*table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, header); err != nil || string(header) != magic {
+		return nil, fmt.Errorf("%s: not a tablebase file", path)
+	}
+
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+
+	t := newTable(m)
+	if int(size) != t.size {
+		return nil, fmt.Errorf("%s: has %d positions, expected %d", path, size, t.size)
+	}
+
+	t.values = make([]uint8, t.size)
+	if _, err := io.ReadFull(flate.NewReader(r), t.values); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%s: truncated", path)
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// Stats sums up a table.
+type Stats struct {
+	Wins, Losses int // positions, for the side to move
+	Longest      int // mate, in plies
+	Example      int // index of a position with the longest mate
+}
+
+func (t *table) stats() Stats {
+	var s Stats
+	for idx, v := range t.values {
+		if v == 0 {
+			continue
+		}
+		if r := resultOf(v); r.Outcome > 0 {
+			s.Wins++
+		} else {
+			s.Losses++
+		}
+		if int(v)-1 > s.Longest {
+			s.Longest, s.Example = int(v)-1, idx
+		}
+	}
+	return s
+}
+
+// Stats sums up the table for m.
+func (tb *Tablebases) Stats(m Material) (Stats, error) {
+	t, err := tb.table(m)
+	if err != nil {
+		return Stats{}, err
+	}
+	if t == nil {
+		return Stats{}, fmt.Errorf("no table for %v", m)
+	}
+	return t.stats(), nil
+}
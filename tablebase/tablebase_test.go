@@ -0,0 +1,98 @@
+package tablebase
+
+import (
+	"bytes"
+	"gochess/fen"
+	"path/filepath"
+	"testing"
+)
+
+// the longest mates, in plies, as other DTM tables have them
+var longest = []struct {
+	material string
+	plies    int
+}{
+	{"KQvK", 20},
+	{"KRvK", 32},
+	{"KBvK", 0},
+	{"KNvK", 0},
+	{"KPvK", 56},
+	{"KBNvK", 66},
+	{"KBBvK", 38},
+	{"KQvKR", 70},
+}
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	tb, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range longest {
+		m, err := ParseMaterial(tt.material)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Men() > 3 && testing.Short() {
+			continue
+		}
+		if err := tb.Generate(m); err != nil {
+			t.Fatalf("%v: %v", m, err)
+		}
+
+		generated, err := tb.table(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := generated.stats(); s.Longest != tt.plies {
+			t.Errorf("%v: longest mate %d plies, want %d", m, s.Longest, tt.plies)
+		}
+
+		loaded, err := load(filepath.Join(dir, m.String()+Ext), m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(loaded.values, generated.values) {
+			t.Errorf("%v: loaded table isn't the one saved", m)
+		}
+	}
+
+	opened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.MaxMen() != tb.MaxMen() {
+		t.Errorf("opened tables go up to %d men, generated %d", opened.MaxMen(), tb.MaxMen())
+	}
+
+	for _, tt := range []struct {
+		fen  string
+		want Result
+	}{
+		{"7k/8/6K1/8/8/8/8/1Q6 w - - 0 1", Result{Outcome: 1, Plies: 1}},
+		{"1Q5k/8/6K1/8/8/8/8/8 b - - 0 1", Result{Outcome: -1}},
+		{"k7/2Q5/1K6/8/8/8/8/8 b - - 0 1", Result{}}, // stalemate
+		{"8/8/8/8/8/8/6k1/K6R b - - 0 1", Result{}},  // the rook is lost
+		{"k7/8/8/8/8/8/P7/K7 w - - 0 1", Result{}},   // rook pawn
+		{"8/8/8/8/8/8/k1K5/1R6 w - - 0 1", Result{Outcome: 1, Plies: 3}},
+	} {
+		b, err := fen.LoadFromFEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r, ok := opened.Probe(b); !ok || r != tt.want {
+			t.Errorf("%s: %+v, %v, want %+v", tt.fen, r, ok, tt.want)
+		}
+	}
+
+	b, _ := fen.LoadFromFEN("7k/8/6K1/8/8/8/8/1Q6 w - - 0 1")
+	move, r, ok := opened.BestMove(b)
+	if !ok || r != (Result{Outcome: 1, Plies: 1}) {
+		t.Fatalf("best move %s with %+v, %v, want a mate in 1", b.ToAlgebraNotation(move), r, ok)
+	}
+	b.Push(&move)
+	if len(b.GenerateLegalMoves()) != 0 || !b.InCheck(b.WhiteToMove) {
+		t.Errorf("best move %s doesn't mate", fen.BoardToFEN(b))
+	}
+}
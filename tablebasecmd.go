@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gochess/fen"
+	"gochess/tablebase"
+	"os"
+	"strings"
+	"time"
+)
+
+func tablebaseMain(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: gochess tablebase generate|probe [options]")
+		os.Exit(2)
+	}
+
+	var err error
+	switch args[0] {
+	case "generate":
+		err = tablebaseGenerate(args[1:])
+	case "probe":
+		err = tablebaseProbe(args[1:])
+	default:
+		err = fmt.Errorf("unknown tablebase command %q", args[0])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tablebase:", err)
+		os.Exit(1)
+	}
+}
+
+func tablebaseGenerate(args []string) error {
+	fs := flag.NewFlagSet("tablebase generate", flag.ExitOnError)
+	dir := fs.String("dir", "tablebases", "directory to write the tables to")
+	men := fs.Int("men", 4, "generate every ending with up to this many pieces, 5 takes hours and gigabytes")
+	force := fs.Bool("force", false, "generate tables again even if they're there already")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gochess tablebase generate [options] [endings, e.g. KQvKR]")
+		fmt.Fprintln(os.Stderr, "endings given by name need the tables they lead into to be there already")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+	tb, err := tablebase.New(*dir)
+	if err != nil {
+		return err
+	}
+
+	endings := tablebase.Endings(*men)
+	if fs.NArg() > 0 {
+		endings = nil
+		for _, name := range fs.Args() {
+			m, err := tablebase.ParseMaterial(name)
+			if err != nil {
+				return err
+			}
+			endings = append(endings, m)
+		}
+	}
+
+	for _, m := range endings {
+		if tb.Has(m) && !*force {
+			continue
+		}
+
+		start := time.Now()
+		if err := tb.Generate(m); err != nil {
+			return err
+		}
+		stats, err := tb.Stats(m)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-8v %8d won %8d lost, longest mate %3d plies, %v\n",
+			m, stats.Wins, stats.Losses, stats.Longest, time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+func tablebaseProbe(args []string) error {
+	fs := flag.NewFlagSet("tablebase probe", flag.ExitOnError)
+	dir := fs.String("dir", "tablebases", "directory with the tables")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gochess tablebase probe [options] fen")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	tb, err := tablebase.Open(*dir)
+	if err != nil {
+		return err
+	}
+	board, err := fen.LoadFromFEN(strings.Join(fs.Args(), " "))
+	if err != nil {
+		return err
+	}
+
+	r, ok := tb.Probe(board)
+	if !ok {
+		return fmt.Errorf("no table for this position")
+	}
+	switch r.Outcome {
+	case 1:
+		fmt.Printf("win, mate in %d\n", (r.Plies+1)/2)
+	case -1:
+		fmt.Printf("loss, mated in %d\n", r.Plies/2)
+	default:
+		fmt.Println("draw")
+	}
+
+	if move, _, ok := tb.BestMove(board); ok {
+		fmt.Println("best move", board.ToAlgebraNotation(move))
+	}
+	return nil
+}
@@ -3,10 +3,14 @@ package uci
 import (
 	"bufio"
 	"fmt"
+	"gochess/book"
 	"gochess/core"
 	"gochess/engine"
 	"gochess/fen"
+	"gochess/syzygy"
+	"gochess/tablebase"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,12 +18,19 @@ import (
 )
 
 type UCIEngine struct {
-	engine     *engine.Engine
-	board      *core.Board
-	searching  bool
-	stopSearch chan struct{}
-	mutex      sync.RWMutex
-	options    map[string]UCIOption
+	engine       *engine.Engine
+	board        *core.Board
+	searching    bool
+	pondering    bool
+	stopSearch   chan struct{}
+	ponderHit    chan struct{}
+	searchEngine *engine.Engine
+	tuning       engine.Tuning
+	mutex        sync.RWMutex
+	options      map[string]UCIOption
+	book         *book.Book
+	tablebases   *tablebase.Tablebases
+	syzygy       *syzygy.Tablebases
 }
 
 type UCIOption struct {
@@ -40,6 +51,7 @@ func NewUCIEngine() *UCIEngine {
 		board:      board,
 		searching:  false,
 		stopSearch: make(chan struct{}),
+		tuning:     engine.DefaultTuning(),
 		options:    make(map[string]UCIOption),
 	}
 
@@ -72,6 +84,98 @@ func (uci *UCIEngine) initializeOptions() {
 		Type:    "check",
 		Default: false,
 	}
+
+	// Time reserved per move for GUI and communication lag
+	overheadMin, overheadMax := 0, 5000
+	uci.options["Move Overhead"] = UCIOption{
+		Name:    "Move Overhead",
+		Type:    "spin",
+		Default: 10,
+		Min:     &overheadMin,
+		Max:     &overheadMax,
+	}
+
+	// Number of best lines reported while analysing
+	multiPVMin, multiPVMax := 1, 64
+	uci.options["MultiPV"] = UCIOption{
+		Name:    "MultiPV",
+		Type:    "spin",
+		Default: 1,
+		Min:     &multiPVMin,
+		Max:     &multiPVMax,
+	}
+
+	// Playing strength
+	skillMin, skillMax := 0, engine.MaxSkillLevel
+	uci.options["Skill Level"] = UCIOption{
+		Name:    "Skill Level",
+		Type:    "spin",
+		Default: engine.MaxSkillLevel,
+		Min:     &skillMin,
+		Max:     &skillMax,
+	}
+
+	// Evaluation function used by the search
+	uci.options["Evaluator"] = UCIOption{
+		Name:         "Evaluator",
+		Type:         "combo",
+		Default:      engine.DefaultEvaluator,
+		ComboOptions: engine.EvaluatorNames(),
+	}
+
+	// Opening book, in Polyglot format
+	uci.options["OwnBook"] = UCIOption{
+		Name:    "OwnBook",
+		Type:    "check",
+		Default: false,
+	}
+
+	uci.options["BookFile"] = UCIOption{
+		Name:    "BookFile",
+		Type:    "string",
+		Default: "book.bin",
+	}
+
+	uci.options["Best Book Move"] = UCIOption{
+		Name:    "Best Book Move",
+		Type:    "check",
+		Default: false,
+	}
+
+	// Directory with the endgame tables made by "gochess tablebase generate"
+	uci.options["TablebasePath"] = UCIOption{
+		Name:    "TablebasePath",
+		Type:    "string",
+		Default: "",
+	}
+
+	// Syzygy tables, a list of directories like PATH
+	uci.options["SyzygyPath"] = UCIOption{
+		Name:    "SyzygyPath",
+		Type:    "string",
+		Default: "<empty>",
+	}
+
+	probeLimitMin, probeLimitMax := 0, 7
+	uci.options["SyzygyProbeLimit"] = UCIOption{
+		Name:    "SyzygyProbeLimit",
+		Type:    "spin",
+		Default: 7,
+		Min:     &probeLimitMin,
+		Max:     &probeLimitMax,
+	}
+
+	// Search parameters, exposed for tuning
+	for _, param := range uci.tuning.Params() {
+		paramMin, paramMax := param.Min, param.Max
+		uci.options[param.Name] = UCIOption{
+			Name:    param.Name,
+			Type:    "spin",
+			Default: *param.Value,
+			Min:     &paramMin,
+			Max:     &paramMax,
+		}
+	}
 }
 
 func (uci *UCIEngine) Run() {
@@ -118,6 +222,8 @@ func (uci *UCIEngine) processCommand(line string) {
 		uci.handlePonderHit()
 	case "quit":
 		uci.handleQuit()
+	case "bench":
+		uci.handleBench(parts[1:])
 	default:
 		// Unknown command - UCI engines should ignore unknown commands
 	}
@@ -197,6 +303,8 @@ func (uci *UCIEngine) handleSetOption(args []string) {
 	// Extract option value (everything after "value")
 	optionValue := strings.Join(args[valueIndex+1:], " ")
 
+	uci.mutex.Lock()
+	defer uci.mutex.Unlock()
 	uci.setOption(optionName, optionValue)
 }
 
@@ -206,6 +314,12 @@ func (uci *UCIEngine) setOption(name, value string) {
 		return
 	}
 
+	// The search is probing the table, it can't be swapped or cleared under
+	// it. GUIs aren't meant to send these mid-search anyway
+	if uci.searching && (name == "Hash" || name == "Clear Hash") {
+		return
+	}
+
 	switch name {
 	case "Hash":
 		if hashSize, err := strconv.Atoi(value); err == nil {
@@ -219,6 +333,63 @@ func (uci *UCIEngine) setOption(name, value string) {
 		// Handle ponder setting
 		option.Default = (value == "true")
 		uci.options[name] = option
+	case "OwnBook", "Best Book Move":
+		option.Default = (value == "true")
+		uci.options[name] = option
+		if uci.book != nil {
+			uci.book.Best = uci.options["Best Book Move"].Default.(bool)
+		}
+	case "TablebasePath":
+		option.Default = value
+		uci.options[name] = option
+		uci.tablebases = nil
+		if value != "" && value != "<empty>" {
+			tb, err := tablebase.Open(value)
+			if err != nil {
+				fmt.Printf("info string can't use tablebases: %v\n", err)
+				return
+			}
+			fmt.Printf("info string tablebases up to %d men found in %s\n", tb.MaxMen(), value)
+			uci.tablebases = tb
+		}
+	case "SyzygyPath":
+		option.Default = value
+		uci.options[name] = option
+		uci.syzygy = nil
+		if value != "" && value != "<empty>" {
+			tb, err := syzygy.Open(value)
+			if err != nil {
+				fmt.Printf("info string can't use Syzygy tables: %v\n", err)
+				return
+			}
+			fmt.Printf("info string %d Syzygy tables up to %d pieces found\n", tb.Len(), tb.MaxPieces)
+			uci.syzygy = tb
+		}
+	case "BookFile":
+		option.Default = value
+		uci.options[name] = option
+		uci.book = nil // opened again when next needed
+	case "Move Overhead", "MultiPV", "Skill Level", "SyzygyProbeLimit":
+		if ms, err := strconv.Atoi(value); err == nil && ms >= *option.Min && ms <= *option.Max {
+			option.Default = ms
+			uci.options[name] = option
+		}
+	case "Evaluator":
+		if _, ok := engine.NewEvaluator(value); ok {
+			option.Default = value
+			uci.options[name] = option
+		}
+	default:
+		for _, param := range uci.tuning.Params() {
+			if param.Name != name {
+				continue
+			}
+			if v, err := strconv.Atoi(value); err == nil && v >= param.Min && v <= param.Max {
+				*param.Value = v
+				option.Default = v
+				uci.options[name] = option
+			}
+		}
 	}
 }
 
@@ -233,13 +404,17 @@ func (uci *UCIEngine) handleNewGame() {
 	uci.mutex.Lock()
 	defer uci.mutex.Unlock()
 
+	// Clearing the engine would pull its tables out from under the search
+	if uci.searching {
+		return
+	}
+
 	// Reset to starting position
 	board, _ := fen.LoadFromFEN(fen.DefaultFEN())
 	uci.board = board
-	uci.engine = engine.NewEngine(board)
 
-	// Clear transposition table for new game
-	uci.engine.TT.NewGeneration()
+	// Nothing from the last game should carry over
+	uci.engine.Clear()
 }
 
 func (uci *UCIEngine) handlePosition(args []string) {
@@ -259,13 +434,12 @@ func (uci *UCIEngine) handlePosition(args []string) {
 		board, err = fen.LoadFromFEN(fen.DefaultFEN())
 		moveIndex = 1
 	case "fen":
-		if len(args) < 7 {
-			return
+		// the FEN runs up to the moves, some GUIs leave the clocks off
+		moveIndex = slices.Index(args, "moves")
+		if moveIndex < 0 {
+			moveIndex = len(args)
 		}
-		// FEN string is typically 6 parts
-		fenString := strings.Join(args[1:7], " ")
-		board, err = fen.LoadFromFEN(fenString)
-		moveIndex = 7
+		board, err = fen.LoadFromFEN(strings.Join(args[1:moveIndex], " "))
 	default:
 		return
 	}
@@ -285,8 +459,6 @@ func (uci *UCIEngine) handlePosition(args []string) {
 			}
 		}
 	}
-
-	uci.engine.Board = uci.board.Clone()
 }
 
 func (uci *UCIEngine) parseMove(moveStr string) *core.Move {
@@ -340,19 +512,42 @@ func (uci *UCIEngine) parseMove(moveStr string) *core.Move {
 }
 
 func (uci *UCIEngine) handleGo(args []string) {
+	// Parse go command parameters
+	searchParams := uci.parseGoCommand(args)
+
 	uci.mutex.Lock()
+	defer uci.mutex.Unlock()
+
 	if uci.searching {
-		uci.mutex.Unlock()
 		return
 	}
 	uci.searching = true
+	uci.pondering = searchParams.Ponder
 	uci.stopSearch = make(chan struct{})
-	uci.mutex.Unlock()
-
-	// Parse go command parameters
-	searchParams := uci.parseGoCommand(args)
-
-	go uci.search(searchParams)
+	uci.ponderHit = make(chan struct{})
+
+	// Set the search engine up before returning so that a stop or ponderhit
+	// right behind this command can't miss it
+	// The same engine every move, so the TT (sized by Hash) and the move
+	// ordering history carry over, and there's no table to allocate
+	searchEngine := uci.engine
+	searchEngine.Board = uci.board.Clone()
+	searchEngine.Eval, _ = engine.NewEvaluator(uci.options["Evaluator"].Default.(string))
+	searchEngine.OnInfo = uci.sendInfo
+	searchEngine.Skill = uci.skill()
+	searchEngine.Tuning = uci.tuning
+	searchEngine.Tablebases = uci.tablebases
+	searchEngine.Syzygy = uci.syzygy
+	searchEngine.SyzygyProbeLimit = uci.options["SyzygyProbeLimit"].Default.(int)
+	searchEngine.Book = nil
+	if !searchParams.Ponder && !searchParams.Infinite && searchParams.Mate == nil {
+		searchEngine.Book = uci.openingBook()
+	}
+	uci.searchEngine = searchEngine
+
+	limits := uci.searchLimits(searchParams)
+
+	go uci.search(searchEngine, limits, searchParams, uci.stopSearch, uci.ponderHit)
 }
 
 type SearchParams struct {
@@ -466,75 +661,198 @@ func (uci *UCIEngine) parseGoCommand(args []string) SearchParams {
 	return params
 }
 
-func (uci *UCIEngine) search(params SearchParams) {
-	defer func() {
-		uci.mutex.Lock()
-		uci.searching = false
-		uci.mutex.Unlock()
+func (uci *UCIEngine) search(searchEngine *engine.Engine, limits engine.SearchLimits, params SearchParams, stop, ponderHit chan struct{}) {
+	done := make(chan struct{})
+	stopperDone := make(chan struct{})
+	go func() {
+		defer close(stopperDone)
+		select {
+		case <-stop:
+			searchEngine.Stop()
+		case <-done:
+		}
 	}()
 
-	// Calculate time budget
-	timeBudget := uci.calculateTimeBudget(params)
+	// Perform the search
+	var bestMove *core.Move
+	if params.Mate != nil {
+		bestMove = uci.searchMate(searchEngine, *params.Mate, limits)
+	} else {
+		bestMove = searchEngine.Search(limits)
+	}
+	close(done)
 
-	// Clone the board for searching
-	searchBoard := uci.board.Clone()
-	searchEngine := engine.NewEngine(searchBoard)
+	// When pondering or searching infinitely the GUI only wants a bestmove
+	// once it has told us to stop (or, for ponder, that the move was played)
+	if params.Ponder || params.Infinite {
+		select {
+		case <-stop:
+		case <-ponderHit:
+		}
+	}
 
-	// Perform the search
-	bestMove := searchEngine.FindBestMove(timeBudget, true)
+	// A stop or ponderhit that raced the end of the search may only just have
+	// landed, and the engine is reused, so neither may be left for the next go
+	<-stopperDone
+	uci.mutex.Lock()
+	searchEngine.ClearSignals()
+	uci.searching = false
+	uci.pondering = false
+	uci.searchEngine = nil
+	uci.mutex.Unlock()
 
 	if bestMove != nil {
 		moveStr := uci.moveToString(*bestMove)
-		fmt.Printf("bestmove %s\n", moveStr)
+		if ponderMove, ok := searchEngine.PonderMove(*bestMove); ok {
+			fmt.Printf("bestmove %s ponder %s\n", moveStr, uci.moveToString(ponderMove))
+		} else {
+			fmt.Printf("bestmove %s\n", moveStr)
+		}
 	} else {
 		// No legal moves (checkmate or stalemate)
 		fmt.Println("bestmove 0000")
 	}
 }
 
-func (uci *UCIEngine) calculateTimeBudget(params SearchParams) time.Duration {
-	// If movetime is specified, use it directly
-	if params.MoveTime != nil {
-		return *params.MoveTime
+func (uci *UCIEngine) searchMate(searchEngine *engine.Engine, n int, limits engine.SearchLimits) *core.Move {
+	result := searchEngine.SearchMate(n, limits)
+	if result.Found {
+		return &result.PV[0]
 	}
 
-	// If infinite search, use a very long time
-	if params.Infinite {
-		return time.Hour * 24 // 24 hours
+	if result.Aborted {
+		// the GUI wants its move now, a few plies are enough not to blunder
+		fmt.Printf("info string mate search stopped before finding a mate in %d\n", n)
+		return searchEngine.Search(engine.SearchLimits{Depth: 4})
 	}
 
-	// Simple time management based on remaining time
-	var ourTime *time.Duration
-	var ourInc *time.Duration
+	// Still owe the GUI a move, take it from a short regular search
+	fmt.Printf("info string no forced mate in %d\n", n)
+	return searchEngine.Search(engine.SearchLimits{Depth: min(2*n, 8)})
+}
 
-	if uci.board.WhiteToMove {
-		ourTime = params.WTime
-		ourInc = params.WInc
-	} else {
-		ourTime = params.BTime
-		ourInc = params.BInc
+// openingBook returns the book to play from, nil when OwnBook is off or the
+// book can't be read.
+func (uci *UCIEngine) openingBook() *book.Book {
+	if !uci.options["OwnBook"].Default.(bool) {
+		return nil
 	}
 
-	if ourTime != nil {
-		// Basic time management: use 1/30th of remaining time plus increment
-		budget := *ourTime / 30
-		if ourInc != nil {
-			budget += *ourInc
+	if uci.book == nil {
+		path := uci.options["BookFile"].Default.(string)
+		bk, err := book.Open(path)
+		if err != nil {
+			fmt.Printf("info string can't open book: %v\n", err)
+			// don't try again on every move
+			option := uci.options["OwnBook"]
+			option.Default = false
+			uci.options["OwnBook"] = option
+			return nil
 		}
+		fmt.Printf("info string book %s loaded, %d entries\n", path, bk.Len())
+		uci.book = bk
+	}
 
-		// Don't use less than 1ms or more than remaining time
-		if budget < time.Millisecond {
-			budget = time.Millisecond
-		}
-		if budget > *ourTime {
-			budget = *ourTime
-		}
+	uci.book.Best = uci.options["Best Book Move"].Default.(bool)
+	return uci.book
+}
+
+func (uci *UCIEngine) skill() engine.Skill {
+	return engine.Skill{Level: uci.options["Skill Level"].Default.(int)}
+}
+
+func (uci *UCIEngine) searchLimits(params SearchParams) engine.SearchLimits {
+	limits := engine.SearchLimits{
+		Time:    uci.timeControl(params),
+		MultiPV: uci.options["MultiPV"].Default.(int),
+	}
+
+	if params.Depth != nil {
+		limits.Depth = *params.Depth
+	}
+	if params.Nodes != nil {
+		limits.Nodes = *params.Nodes
+	}
+
+	return limits
+}
+
+func (uci *UCIEngine) timeControl(params SearchParams) engine.TimeControl {
+	tc := engine.TimeControl{
+		Overhead: time.Duration(uci.options["Move Overhead"].Default.(int)) * time.Millisecond,
+		Infinite: params.Infinite,
+		Ponder:   params.Ponder,
+	}
+
+	if params.MoveTime != nil {
+		tc.MoveTime = *params.MoveTime
+	}
+	if params.MovesToGo != nil {
+		tc.MovesToGo = *params.MovesToGo
+	}
+
+	ourTime, ourInc := params.WTime, params.WInc
+	if !uci.board.WhiteToMove {
+		ourTime, ourInc = params.BTime, params.BInc
+	}
+
+	if ourTime != nil {
+		// a flagged or nearly flagged clock still needs a (tiny) budget
+		tc.Time = max(*ourTime, time.Millisecond)
+	}
+	if ourInc != nil {
+		tc.Inc = *ourInc
+	}
 
-		return budget
+	// Nothing to go by at all, don't think forever
+	if !tc.Infinite && tc.MoveTime == 0 && ourTime == nil && params.Depth == nil && params.Nodes == nil && params.Mate == nil {
+		tc.MoveTime = time.Second
 	}
 
-	// Default fallback
-	return time.Second
+	return tc
+}
+
+func (uci *UCIEngine) sendInfo(info engine.SearchInfo) {
+	var sb strings.Builder
+
+	nps := uint64(0)
+	if ms := info.Time.Milliseconds(); ms > 0 {
+		nps = info.Nodes * 1000 / uint64(ms)
+	}
+
+	fmt.Fprintf(&sb, "info depth %d", info.Depth)
+	if info.SelDepth > 0 {
+		fmt.Fprintf(&sb, " seldepth %d", info.SelDepth)
+	}
+	fmt.Fprintf(&sb, " multipv %d score %s", info.MultiPV, formatScore(info.Score))
+	switch info.Bound {
+	case engine.FlagLower:
+		sb.WriteString(" lowerbound")
+	case engine.FlagUpper:
+		sb.WriteString(" upperbound")
+	}
+	fmt.Fprintf(&sb, " nodes %d nps %d", info.Nodes, nps)
+	if info.TBHits > 0 {
+		fmt.Fprintf(&sb, " tbhits %d", info.TBHits)
+	}
+	fmt.Fprintf(&sb, " time %d pv", info.Time.Milliseconds())
+	for _, move := range info.PV {
+		sb.WriteByte(' ')
+		sb.WriteString(uci.moveToString(move))
+	}
+
+	fmt.Println(sb.String())
+}
+
+func formatScore(score int) string {
+	switch {
+	case score >= engine.MateThreshold:
+		return fmt.Sprintf("mate %d", (engine.MateScore-score+1)/2)
+	case score <= -engine.MateThreshold:
+		return fmt.Sprintf("mate %d", -(engine.MateScore+score)/2)
+	default:
+		return fmt.Sprintf("cp %d", score)
+	}
 }
 
 func (uci *UCIEngine) moveToString(move core.Move) string {
@@ -567,14 +885,47 @@ func (uci *UCIEngine) moveToString(move core.Move) string {
 func (uci *UCIEngine) handleStop() {
 	uci.mutex.RLock()
 	if uci.searching {
-		close(uci.stopSearch)
+		select {
+		case <-uci.stopSearch:
+			// already stopping
+		default:
+			close(uci.stopSearch)
+		}
 	}
 	uci.mutex.RUnlock()
 }
 
 func (uci *UCIEngine) handlePonderHit() {
+	uci.mutex.Lock()
+	defer uci.mutex.Unlock()
+
+	if !uci.searching || !uci.pondering {
+		return
+	}
+
 	// Convert ponder search to normal search
-	// This is a simplified implementation
+	uci.pondering = false
+	uci.searchEngine.PonderHit()
+	close(uci.ponderHit)
+}
+
+// handleBench runs the bench, "bench [depth]", an extension to UCI that
+// testing frameworks use to check the node count of a build.
+func (uci *UCIEngine) handleBench(args []string) {
+	uci.mutex.RLock()
+	searching := uci.searching
+	uci.mutex.RUnlock()
+	if searching {
+		return
+	}
+
+	depth := engine.DefaultBenchDepth
+	if len(args) > 0 {
+		if d, err := strconv.Atoi(args[0]); err == nil && d > 0 {
+			depth = d
+		}
+	}
+	engine.Bench(os.Stdout, depth)
 }
 
 func (uci *UCIEngine) handleQuit() {
@@ -0,0 +1,261 @@
+// Package uciclient drives external engines over UCI, the other end of what
+// package uci does: it runs the binary, goes through the handshake, sets
+// options and sends positions, and reads info and bestmove back into
+// structs.
+package uciclient
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrExited is returned once the engine has gone away, crashed or not.
+	ErrExited = errors.New("engine exited")
+
+	// ErrTimeout is returned when the engine didn't answer in time. It may
+	// still be running, Close kills it if need be. A bestmove that comes
+	// after Go gave up is thrown away by the next Go.
+	ErrTimeout = errors.New("engine didn't answer in time")
+)
+
+const (
+	// HandshakeTimeout is how long uciok and readyok may take.
+	HandshakeTimeout = 10 * time.Second
+
+	// StopTimeout is how long a bestmove may take after a stop.
+	StopTimeout = time.Second
+)
+
+// Engine is a running engine.
+type Engine struct {
+	Name    string // from "id name"
+	Author  string
+	Options map[string]Option // as the engine announced them
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	lines  chan string // closed when the engine's output ends
+	stderr *tailBuffer
+
+	// Log, if set, gets every line sent (prefixed ">") and received ("<")
+	Log io.Writer
+
+	closeOnce sync.Once
+	exitErr   error
+
+	// searches Go gave up on, whose bestmove hasn't come yet
+	late int
+}
+
+// Option is an option the engine supports.
+type Option struct {
+	Name     string
+	Type     string // check, spin, combo, button or string
+	Default  string
+	Min, Max int      // for spin
+	Vars     []string // for combo
+}
+
+// Start runs the engine binary at path with args and goes through the uci
+// handshake.
+func Start(path string, args ...string) (*Engine, error) {
+	e := &Engine{
+		Options: map[string]Option{},
+		cmd:     exec.Command(path, args...),
+		lines:   make(chan string, 256),
+		stderr:  &tailBuffer{},
+	}
+	e.cmd.Stderr = e.stderr
+	stdout, err := e.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if e.stdin, err = e.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if err := e.cmd.Start(); err != nil {
+		return nil, err
+	}
+	go e.read(stdout)
+
+	if err := e.handshake(); err != nil {
+		e.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Engine) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // long PVs
+	for scanner.Scan() {
+		e.lines <- strings.TrimSpace(scanner.Text())
+	}
+	close(e.lines)
+}
+
+func (e *Engine) handshake() error {
+	e.Send("uci")
+	timer := time.NewTimer(HandshakeTimeout)
+	defer timer.Stop()
+	for {
+		line, err := e.next(timer.C)
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "uciok":
+			return nil
+		case strings.HasPrefix(line, "id name "):
+			e.Name = strings.TrimPrefix(line, "id name ")
+		case strings.HasPrefix(line, "id author "):
+			e.Author = strings.TrimPrefix(line, "id author ")
+		case strings.HasPrefix(line, "option "):
+			if option, ok := parseOption(line); ok {
+				e.Options[option.Name] = option
+			}
+		}
+	}
+}
+
+// Send writes one command line to the engine. A dead engine isn't noticed
+// here but on the next read.
+func (e *Engine) Send(line string) {
+	if e.Log != nil {
+		fmt.Fprintln(e.Log, ">", line)
+	}
+	fmt.Fprintln(e.stdin, line)
+}
+
+// next returns the next line from the engine, or an error if it exits or
+// timeout fires first.
+func (e *Engine) next(timeout <-chan time.Time) (string, error) {
+	select {
+	case line, ok := <-e.lines:
+		if !ok {
+			return "", e.exited()
+		}
+		if e.Log != nil {
+			fmt.Fprintln(e.Log, "<", line)
+		}
+		return line, nil
+	case <-timeout:
+		return "", ErrTimeout
+	}
+}
+
+// exited waits for the process and says how it ended, with the last of
+// what it wrote to stderr.
+func (e *Engine) exited() error {
+	e.closeOnce.Do(func() { e.exitErr = e.cmd.Wait() })
+	err := fmt.Errorf("%w", ErrExited)
+	if e.exitErr != nil {
+		err = fmt.Errorf("%w: %v", ErrExited, e.exitErr)
+	}
+	if tail := e.stderr.String(); tail != "" {
+		err = fmt.Errorf("%w: %s", err, tail)
+	}
+	return err
+}
+
+// SetOption sets an option, which needn't be one the engine announced.
+// Buttons take no value.
+func (e *Engine) SetOption(name, value string) {
+	if value == "" {
+		e.Send("setoption name " + name)
+		return
+	}
+	e.Send("setoption name " + name + " value " + value)
+}
+
+// IsReady waits until the engine has dealt with everything sent so far.
+func (e *Engine) IsReady() error {
+	e.Send("isready")
+	timer := time.NewTimer(HandshakeTimeout)
+	defer timer.Stop()
+	for {
+		line, err := e.next(timer.C)
+		if err != nil {
+			return err
+		}
+		if line == "readyok" {
+			return nil
+		}
+	}
+}
+
+// NewGame tells the engine the next position is from another game.
+func (e *Engine) NewGame() error {
+	e.Send("ucinewgame")
+	return e.IsReady()
+}
+
+// Position sets the position to search: fen, or the starting position if
+// it's empty, then moves in coordinate notation.
+func (e *Engine) Position(fen string, moves []string) {
+	cmd := "position startpos"
+	if fen != "" {
+		cmd = "position fen " + fen
+	}
+	if len(moves) > 0 {
+		cmd += " moves " + strings.Join(moves, " ")
+	}
+	e.Send(cmd)
+}
+
+// Close asks the engine to quit, and kills it if it doesn't in time.
+func (e *Engine) Close() error {
+	e.Send("quit")
+	e.stdin.Close()
+
+	// the reader has to be able to get rid of what's left for Wait to return
+	go func() {
+		for range e.lines {
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		e.closeOnce.Do(func() { e.exitErr = e.cmd.Wait() })
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(HandshakeTimeout):
+		e.cmd.Process.Kill()
+		<-done
+	}
+	return nil
+}
+
+// tailBuffer keeps the last bit of what an engine writes to stderr, for the
+// error when it dies.
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+const tailSize = 512
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > tailSize {
+		t.buf = t.buf[len(t.buf)-tailSize:]
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return strings.TrimSpace(string(t.buf))
+}
@@ -0,0 +1,182 @@
+package uciclient
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"gochess/uci"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the test binary runs as the engine when this is set: "gochess" for the
+// real thing, or one of the scripted engines in fakeEngine
+const engineEnv = "UCICLIENT_TEST_ENGINE"
+
+func TestMain(m *testing.M) {
+	switch mode := os.Getenv(engineEnv); mode {
+	case "":
+		os.Exit(m.Run())
+	case "gochess":
+		uci.RunUCI()
+	default:
+		fakeEngine(mode)
+	}
+	os.Exit(0)
+}
+
+// fakeEngine goes through the handshake and then misbehaves on go: "crash"
+// dies, "late" doesn't answer until well after a stop, then plays a2a3,
+// and plays h2h3 straight away on any go after that.
+func fakeEngine(mode string) {
+	searches := 0
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		switch strings.Fields(scanner.Text() + " ")[0] {
+		case "uci":
+			fmt.Println("id name Fake " + mode)
+			fmt.Println("option name Hash type spin default 16 min 1 max 1024")
+			fmt.Println("uciok")
+		case "isready":
+			fmt.Println("readyok")
+		case "go":
+			searches++
+			switch {
+			case mode == "crash":
+				fmt.Fprintln(os.Stderr, "fatal: out of cheese")
+				os.Exit(3)
+			case searches > 1:
+				fmt.Println("info depth 1 score cp 5 pv h2h3")
+				fmt.Println("bestmove h2h3")
+			}
+		case "stop":
+			if mode == "late" && searches == 1 {
+				time.Sleep(StopTimeout + time.Second/2)
+				fmt.Println("info depth 9 score cp -40 pv a2a3")
+				fmt.Println("bestmove a2a3")
+			}
+		case "quit":
+			return
+		}
+	}
+}
+
+// start runs the test binary as the engine for mode.
+func start(t *testing.T, mode string) *Engine {
+	t.Helper()
+	t.Setenv(engineEnv, mode)
+	e, err := Start(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { e.Close() })
+	return e
+}
+
+func TestHandshake(t *testing.T) {
+	e := start(t, "gochess")
+	if e.Name != "GoChess" || e.Author == "" {
+		t.Errorf("id name %q author %q", e.Name, e.Author)
+	}
+	hash, ok := e.Options["Hash"]
+	if !ok || hash.Type != "spin" || hash.Min < 1 || hash.Max <= hash.Min {
+		t.Errorf("Hash option %+v", hash)
+	}
+	e.SetOption("Hash", "8")
+	if err := e.NewGame(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGo(t *testing.T) {
+	e := start(t, "gochess")
+
+	e.Position("", []string{"e2e4", "e7e5"})
+	infos := 0
+	best, err := e.Go(Go{Depth: 4}, 10*time.Second, func(Info) { infos++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(best.Move) < 4 || infos == 0 || best.Info.Depth == 0 || !best.Info.HasScore || len(best.Info.PV) == 0 {
+		t.Errorf("depth 4 from the open game: %+v after %d infos", best, infos)
+	}
+
+	e.Position("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", nil)
+	best, err = e.Go(Go{Depth: 3}, 10*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best.Move != "a1a8" || !best.Info.Score.IsMate || best.Info.Score.Mate != 1 {
+		t.Errorf("back rank mate: %s with %v", best.Move, best.Info.Score)
+	}
+
+	// a stop ends an infinite search with a move
+	e.Position("", nil)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		e.Stop()
+	}()
+	best, err = e.Go(Go{Infinite: true}, 10*time.Second, nil)
+	if err != nil || best.Move == "" {
+		t.Errorf("stopped infinite search: %+v, %v", best, err)
+	}
+}
+
+func TestCrash(t *testing.T) {
+	e := start(t, "crash")
+	_, err := e.Go(Go{Depth: 1}, 10*time.Second, nil)
+	if !errors.Is(err, ErrExited) || !strings.Contains(err.Error(), "out of cheese") || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("Go on an engine that crashes: %v", err)
+	}
+	if err := e.IsReady(); !errors.Is(err, ErrExited) {
+		t.Errorf("IsReady after the crash: %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	e := start(t, "late")
+	if _, err := e.Go(Go{Infinite: true}, 50*time.Millisecond, nil); err != ErrTimeout {
+		t.Fatalf("Go on an engine that ignores stop: %v", err)
+	}
+
+	// the late bestmove is for the search that timed out, not this one
+	var pvs []string
+	best, err := e.Go(Go{Depth: 1}, 10*time.Second, func(info Info) { pvs = append(pvs, info.PV...) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best.Move != "h2h3" || best.Info.Score.CP != 5 || !reflect.DeepEqual(pvs, []string{"h2h3"}) {
+		t.Errorf("after the timeout got %s with %v, pvs %v", best.Move, best.Info.Score, pvs)
+	}
+}
+
+func TestParseOption(t *testing.T) {
+	for _, tt := range []struct {
+		line   string
+		option Option
+	}{
+		{"option name Hash type spin default 16 min 1 max 1024", Option{Name: "Hash", Type: "spin", Default: "16", Min: 1, Max: 1024}},
+		{"option name Clear Hash type button", Option{Name: "Clear Hash", Type: "button"}},
+		{"option name UCI_Chess960 type check default false", Option{Name: "UCI_Chess960", Type: "check", Default: "false"}},
+		{"option name SyzygyPath type string default <empty>", Option{Name: "SyzygyPath", Type: "string"}},
+		{"option name Book File type string default C:\\my books\\main.bin", Option{Name: "Book File", Type: "string", Default: "C:\\my books\\main.bin"}},
+		{
+			"option name Style type combo default Normal var Solid var Normal var Risky Play",
+			Option{Name: "Style", Type: "combo", Default: "Normal", Vars: []string{"Solid", "Normal", "Risky Play"}},
+		},
+	} {
+		option, ok := parseOption(tt.line)
+		if !ok || !reflect.DeepEqual(option, tt.option) {
+			t.Errorf("%q: %+v, %v, want %+v", tt.line, option, ok, tt.option)
+		}
+	}
+
+	for _, line := range []string{"option", "option name Hash", "option type spin default 1"} {
+		if option, ok := parseOption(line); ok {
+			t.Errorf("%q: %+v, want nothing", line, option)
+		}
+	}
+}
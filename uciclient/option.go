@@ -0,0 +1,45 @@
+package uciclient
+
+import (
+	"strconv"
+	"strings"
+)
+
+// the words that end an option's name or value, which can have spaces
+var optionKeywords = map[string]bool{
+	"name": true, "type": true, "default": true, "min": true, "max": true, "var": true,
+}
+
+// parseOption reads an "option name ... type ..." line.
+func parseOption(line string) (Option, bool) {
+	fields := strings.Fields(line)
+	var option Option
+	for i := 1; i < len(fields); {
+		key := fields[i]
+		j := i + 1
+		for j < len(fields) && !optionKeywords[fields[j]] {
+			j++
+		}
+		value := strings.Join(fields[i+1:j], " ")
+		i = j
+
+		switch key {
+		case "name":
+			option.Name = value
+		case "type":
+			option.Type = value
+		case "default":
+			option.Default = value
+		case "min":
+			option.Min, _ = strconv.Atoi(value)
+		case "max":
+			option.Max, _ = strconv.Atoi(value)
+		case "var":
+			option.Vars = append(option.Vars, value)
+		}
+	}
+	if option.Default == "<empty>" {
+		option.Default = ""
+	}
+	return option, option.Name != "" && option.Type != ""
+}
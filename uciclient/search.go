@@ -0,0 +1,259 @@
+package uciclient
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Go is what to search for. Zero values are left out of the go command.
+type Go struct {
+	SearchMoves []string
+	Ponder      bool
+	WTime       time.Duration
+	BTime       time.Duration
+	WInc        time.Duration
+	BInc        time.Duration
+	MovesToGo   int
+	Depth       int
+	Nodes       uint64
+	Mate        int
+	MoveTime    time.Duration
+	Infinite    bool
+}
+
+func (g Go) String() string {
+	var sb strings.Builder
+	sb.WriteString("go")
+	if len(g.SearchMoves) > 0 {
+		sb.WriteString(" searchmoves " + strings.Join(g.SearchMoves, " "))
+	}
+	if g.Ponder {
+		sb.WriteString(" ponder")
+	}
+	ms := func(name string, d time.Duration) {
+		if d > 0 {
+			fmt.Fprintf(&sb, " %s %d", name, d.Milliseconds())
+		}
+	}
+	ms("wtime", g.WTime)
+	ms("btime", g.BTime)
+	ms("winc", g.WInc)
+	ms("binc", g.BInc)
+	if g.MovesToGo > 0 {
+		fmt.Fprintf(&sb, " movestogo %d", g.MovesToGo)
+	}
+	if g.Depth > 0 {
+		fmt.Fprintf(&sb, " depth %d", g.Depth)
+	}
+	if g.Nodes > 0 {
+		fmt.Fprintf(&sb, " nodes %d", g.Nodes)
+	}
+	if g.Mate > 0 {
+		fmt.Fprintf(&sb, " mate %d", g.Mate)
+	}
+	ms("movetime", g.MoveTime)
+	if g.Infinite {
+		sb.WriteString(" infinite")
+	}
+	return sb.String()
+}
+
+// Score is an info line's score, from the side to move's point of view.
+type Score struct {
+	CP     int // centipawns, when not a mate
+	Mate   int // moves to mate, negative when getting mated, when IsMate
+	IsMate bool
+	Lower  bool // only a lower bound
+	Upper  bool // only an upper bound
+}
+
+func (s Score) String() string {
+	str := fmt.Sprintf("cp %d", s.CP)
+	if s.IsMate {
+		str = fmt.Sprintf("mate %d", s.Mate)
+	}
+	switch {
+	case s.Lower:
+		str += " lowerbound"
+	case s.Upper:
+		str += " upperbound"
+	}
+	return str
+}
+
+// Info is an info line. Fields the engine left out stay zero, HasScore
+// tells a missing score from a 0.00 one.
+type Info struct {
+	Depth          int
+	SelDepth       int
+	MultiPV        int
+	Score          Score
+	HasScore       bool
+	Nodes          uint64
+	NPS            uint64
+	TBHits         uint64
+	HashFull       int
+	Time           time.Duration
+	PV             []string
+	CurrMove       string
+	CurrMoveNumber int
+	String         string // "info string ..." text
+}
+
+// ParseInfo reads an info line.
+func ParseInfo(line string) (Info, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != "info" {
+		return Info{}, false
+	}
+
+	var info Info
+	for i := 1; i < len(fields); i++ {
+		key := fields[i]
+		if key == "string" {
+			info.String = strings.Join(fields[i+1:], " ")
+			break
+		}
+		if key == "pv" {
+			info.PV = fields[i+1:]
+			break
+		}
+		if key == "lowerbound" || key == "upperbound" {
+			info.Score.Lower = info.Score.Lower || key == "lowerbound"
+			info.Score.Upper = info.Score.Upper || key == "upperbound"
+			continue
+		}
+		if i+1 >= len(fields) {
+			break
+		}
+		value := fields[i+1]
+		i++
+
+		switch key {
+		case "depth":
+			info.Depth, _ = strconv.Atoi(value)
+		case "seldepth":
+			info.SelDepth, _ = strconv.Atoi(value)
+		case "multipv":
+			info.MultiPV, _ = strconv.Atoi(value)
+		case "nodes":
+			info.Nodes, _ = strconv.ParseUint(value, 10, 64)
+		case "nps":
+			info.NPS, _ = strconv.ParseUint(value, 10, 64)
+		case "tbhits":
+			info.TBHits, _ = strconv.ParseUint(value, 10, 64)
+		case "hashfull":
+			info.HashFull, _ = strconv.Atoi(value)
+		case "time":
+			ms, _ := strconv.Atoi(value)
+			info.Time = time.Duration(ms) * time.Millisecond
+		case "currmove":
+			info.CurrMove = value
+		case "currmovenumber":
+			info.CurrMoveNumber, _ = strconv.Atoi(value)
+		case "score":
+			// "score cp 20" or "score mate -3", the value is one further on
+			if i+1 >= len(fields) {
+				break
+			}
+			n, err := strconv.Atoi(fields[i+1])
+			if err != nil {
+				break
+			}
+			switch value {
+			case "cp":
+				info.Score.CP, info.HasScore = n, true
+			case "mate":
+				info.Score.Mate, info.Score.IsMate, info.HasScore = n, true, true
+			}
+			i++
+		}
+	}
+	return info, true
+}
+
+// BestMove is the answer to a go. Info is the last info line with a score
+// for the main line, the one the move came from.
+type BestMove struct {
+	Move   string
+	Ponder string
+	Info   Info
+}
+
+// Go starts a search and waits for the bestmove. onInfo, if not nil, gets
+// every info line on the way. After timeout (0 for no limit) the engine is
+// sent a stop, and given StopTimeout more to answer before Go gives up
+// with ErrTimeout. The output of searches Go gave up on is skipped, so a
+// late bestmove isn't taken for this one's.
+func (e *Engine) Go(params Go, timeout time.Duration, onInfo func(Info)) (BestMove, error) {
+	e.Send(params.String())
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	var best BestMove
+	stopped := false
+	for {
+		line, err := e.next(deadline)
+		if err == ErrTimeout && !stopped {
+			e.Stop()
+			stopped = true
+			timer := time.NewTimer(StopTimeout)
+			defer timer.Stop()
+			deadline = timer.C
+			continue
+		}
+		if err == ErrTimeout {
+			e.late++
+		}
+		if err != nil {
+			return best, err
+		}
+
+		if info, ok := ParseInfo(line); ok {
+			if e.late > 0 {
+				continue
+			}
+			if info.HasScore && info.MultiPV <= 1 {
+				best.Info = info
+			}
+			if onInfo != nil {
+				onInfo(info)
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "bestmove" {
+			continue
+		}
+		if e.late > 0 {
+			e.late--
+			continue
+		}
+		if len(fields) < 2 {
+			return best, fmt.Errorf("bestmove without a move")
+		}
+		best.Move = fields[1]
+		if len(fields) >= 4 && fields[2] == "ponder" {
+			best.Ponder = fields[3]
+		}
+		return best, nil
+	}
+}
+
+// Stop ends a search early, for Go to return its bestmove.
+func (e *Engine) Stop() {
+	e.Send("stop")
+}
+
+// PonderHit tells a pondering engine its move was played.
+func (e *Engine) PonderHit() {
+	e.Send("ponderhit")
+}
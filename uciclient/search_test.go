@@ -0,0 +1,62 @@
+package uciclient
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseInfo(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		info Info
+	}{
+		{
+			"info depth 12 seldepth 18 multipv 1 score cp 34 nodes 123456 nps 987654 tbhits 3 hashfull 250 time 125 pv e2e4 e7e5 g1f3",
+			Info{
+				Depth: 12, SelDepth: 18, MultiPV: 1, Score: Score{CP: 34}, HasScore: true,
+				Nodes: 123456, NPS: 987654, TBHits: 3, HashFull: 250, Time: 125 * time.Millisecond,
+				PV: []string{"e2e4", "e7e5", "g1f3"},
+			},
+		},
+		{"info depth 20 score mate -3 pv e1e2", Info{Depth: 20, Score: Score{Mate: -3, IsMate: true}, HasScore: true, PV: []string{"e1e2"}}},
+		{"info depth 7 score cp 0 upperbound nodes 10", Info{Depth: 7, Score: Score{Upper: true}, HasScore: true, Nodes: 10}},
+		{"info depth 7 score cp 80 lowerbound", Info{Depth: 7, Score: Score{CP: 80, Lower: true}, HasScore: true}},
+		{"info currmove g1f3 currmovenumber 2", Info{CurrMove: "g1f3", CurrMoveNumber: 2}},
+		{"info string depth 3 isn't a depth here", Info{String: "depth 3 isn't a depth here"}},
+		{"info depth 5 score", Info{Depth: 5}},
+		{"info depth 5 score cp", Info{Depth: 5}},
+	} {
+		info, ok := ParseInfo(tt.line)
+		if !ok || !reflect.DeepEqual(info, tt.info) {
+			t.Errorf("%q:\n got %+v\nwant %+v", tt.line, info, tt.info)
+		}
+	}
+
+	for _, line := range []string{"", "bestmove e2e4", "information"} {
+		if _, ok := ParseInfo(line); ok {
+			t.Errorf("%q taken for an info line", line)
+		}
+	}
+}
+
+func TestGoString(t *testing.T) {
+	for _, tt := range []struct {
+		params Go
+		want   string
+	}{
+		{Go{}, "go"},
+		{Go{Infinite: true}, "go infinite"},
+		{Go{Depth: 10, Nodes: 5000}, "go depth 10 nodes 5000"},
+		{
+			Go{WTime: time.Minute, BTime: 59500 * time.Millisecond, WInc: time.Second, BInc: time.Second, MovesToGo: 20},
+			"go wtime 60000 btime 59500 winc 1000 binc 1000 movestogo 20",
+		},
+		{Go{SearchMoves: []string{"e2e4", "d2d4"}, Ponder: true, MoveTime: 250 * time.Millisecond}, "go searchmoves e2e4 d2d4 ponder movetime 250"},
+		{Go{Mate: 3}, "go mate 3"},
+	} {
+		if got := tt.params.String(); got != tt.want {
+			t.Errorf("%+v: %q, want %q", tt.params, got, tt.want)
+		}
+	}
+}